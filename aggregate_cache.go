@@ -0,0 +1,135 @@
+package ess
+
+import (
+	"container/list"
+	"reflect"
+	"sync"
+)
+
+// aggregateCache is a least recently used cache of aggregates,
+// keyed by their type and stream id.  Along with every aggregate, the
+// number of events applied to it is kept as the aggregate's version.
+//
+// Aggregates are taken out of the cache while commands are processed
+// by them, so that no two commands share an aggregate.  Commands for
+// the same aggregate are serialised using Lock, so that an aggregate
+// put back into the cache has seen all events of its stream.
+type aggregateCache struct {
+	mutex   sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]map[reflect.Type]*list.Element
+	locks   map[string]*aggregateLock
+}
+
+// aggregateLock serialises the commands processed by an aggregate.
+// Users counts the commands holding or waiting for the lock, so that
+// the lock can be discarded once it is not used anymore.
+type aggregateLock struct {
+	mutex sync.Mutex
+	users int
+}
+
+// cachedAggregate is an entry in an aggregateCache.
+type cachedAggregate struct {
+	aggregate Aggregate
+	version   int
+}
+
+// newAggregateCache returns a new cache holding up to size
+// aggregates.
+func newAggregateCache(size int) *aggregateCache {
+	return &aggregateCache{
+		size:    size,
+		order:   list.New(),
+		entries: map[string]map[reflect.Type]*list.Element{},
+		locks:   map[string]*aggregateLock{},
+	}
+}
+
+// Lock waits until no other command is processed by the aggregate
+// identified by id and returns a function releasing the lock.
+func (self *aggregateCache) Lock(id string) func() {
+	self.mutex.Lock()
+	lock, found := self.locks[id]
+	if !found {
+		lock = &aggregateLock{}
+		self.locks[id] = lock
+	}
+	lock.users++
+	self.mutex.Unlock()
+
+	lock.mutex.Lock()
+	return func() {
+		lock.mutex.Unlock()
+
+		self.mutex.Lock()
+		defer self.mutex.Unlock()
+		lock.users--
+		if lock.users == 0 {
+			delete(self.locks, id)
+		}
+	}
+}
+
+// Take removes the aggregate cached for the type and id of aggregate
+// from the cache and returns it with its version.
+func (self *aggregateCache) Take(aggregate Aggregate) (Aggregate, int, bool) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	element, found := self.entries[aggregate.Id()][reflect.TypeOf(aggregate)]
+	if !found {
+		return nil, 0, false
+	}
+
+	self.remove(element)
+	entry := element.Value.(*cachedAggregate)
+	return entry.aggregate, entry.version, true
+}
+
+// Put caches aggregate at version, evicting the least recently used
+// aggregate if the cache is full.
+func (self *aggregateCache) Put(aggregate Aggregate, version int) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	id, kind := aggregate.Id(), reflect.TypeOf(aggregate)
+	entry := &cachedAggregate{aggregate: aggregate, version: version}
+	if element, found := self.entries[id][kind]; found {
+		element.Value = entry
+		self.order.MoveToFront(element)
+		return
+	}
+
+	if self.entries[id] == nil {
+		self.entries[id] = map[reflect.Type]*list.Element{}
+	}
+	self.entries[id][kind] = self.order.PushFront(entry)
+	for self.order.Len() > self.size {
+		self.remove(self.order.Back())
+	}
+}
+
+// Remove removes all aggregates cached for id, if any.
+func (self *aggregateCache) Remove(id string) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	for _, element := range self.entries[id] {
+		self.remove(element)
+	}
+}
+
+// remove removes element from the cache.  The cache's mutex needs to
+// be held when calling this method.
+func (self *aggregateCache) remove(element *list.Element) {
+	aggregate := element.Value.(*cachedAggregate).aggregate
+	id := aggregate.Id()
+
+	self.order.Remove(element)
+	delete(self.entries[id], reflect.TypeOf(aggregate))
+	if len(self.entries[id]) == 0 {
+		delete(self.entries, id)
+	}
+}
@@ -1,8 +1,71 @@
 package ess
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
 	"log"
 	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrAggregateNotFound is returned when loading an aggregate
+	// which has not emitted any events yet or sending a command
+	// which requires an existing aggregate to such an aggregate.
+	ErrAggregateNotFound = errors.New("not_found")
+
+	// ErrUnknownQuery is returned when asking a query for which
+	// no handler has been registered.
+	ErrUnknownQuery = errors.New("unknown_query")
+
+	// ErrMisroutedEvent is returned when an aggregate emits an
+	// event for a stream other than its own, including events
+	// without a stream id.  Receivers without an id, which do
+	// not represent an aggregate, may emit events without a
+	// stream id.
+	ErrMisroutedEvent = errors.New("misrouted_event")
+
+	// ErrCommandNotHandled is returned when an aggregate neither
+	// emits events nor returns an error for a command it does not
+	// know about.
+	ErrCommandNotHandled = errors.New("command_not_handled")
+
+	// ErrConcurrencyConflict is returned by event stores when
+	// events cannot be stored, because other events have been
+	// stored for the same stream concurrently.
+	ErrConcurrencyConflict = errors.New("concurrency_conflict")
+
+	// ErrStreamDeletionNotSupported is returned when deleting a
+	// stream from an event store which does not implement
+	// StreamDeleter.
+	ErrStreamDeletionNotSupported = errors.New("stream_deletion_not_supported")
+
+	// ErrCheckpointNotFound is returned by Application.Init if the
+	// checkpoint of a durable projection is not found in the
+	// history.
+	ErrCheckpointNotFound = errors.New("checkpoint_not_found")
+)
+
+// TombstoneStream is the id of the stream holding the
+// "stream.deleted" events recorded by Application.DeleteStream.
+const TombstoneStream = "stream.deleted"
+
+const (
+	// ReplayCheckpoint is the name under which the sequence of the
+	// first event Init needs to replay is recorded in the
+	// checkpoint store configured using WithCheckpoints.
+	ReplayCheckpoint = "ess.replay"
+
+	// CheckpointInterval is the number of events projected
+	// between recording checkpoints.
+	CheckpointInterval = 100
 )
 
 // Application represents an event sourced application.
@@ -42,7 +105,30 @@ type Application struct {
 	clock       Clock
 	store       EventStore
 	logger      *log.Logger
-	projections map[string]EventHandler
+	projections map[string]*projection
+	queries     map[reflect.Type]QueryHandler
+	subscribers *subscriptions
+	schemas     map[string][]string
+	cache       *aggregateCache
+	middlewares []CommandMiddleware
+	checkpoints CheckpointStore
+	authorizer  Authorizer
+
+	// checkpointMutex serialises recording checkpoints.  Projected
+	// counts the events projected since the application started.
+	checkpointMutex sync.Mutex
+	projected       int
+
+	snapshots        SnapshotStore
+	snapshotInterval int
+
+	projectionTimeout time.Duration
+
+	progressInterval int
+	progress         func(count int)
+
+	allowCrossAggregateEvents bool
+	strictCommands            bool
 }
 
 // NewApplication creates a new application instance with reasonable
@@ -54,7 +140,9 @@ func NewApplication(name string) *Application {
 		logger:      log.New(os.Stderr, name+" ", log.LstdFlags),
 		store:       NewEventsInMemory(),
 		clock:       SystemClock,
-		projections: map[string]EventHandler{},
+		projections: map[string]*projection{},
+		queries:     map[reflect.Type]QueryHandler{},
+		subscribers: newSubscriptions(),
 	}
 }
 
@@ -64,6 +152,14 @@ func (self *Application) WithLogger(logger *log.Logger) *Application {
 	return self
 }
 
+// WithAuthorizer sets the authorizer consulted for every command
+// before the command's receiver is loaded.  Commands which are not
+// authorized fail with the error returned by authorizer.
+func (self *Application) WithAuthorizer(authorizer Authorizer) *Application {
+	self.authorizer = authorizer
+	return self
+}
+
 // WithStore sets the application's event store to store.  Do not call
 // this method after Init has been called.
 func (self *Application) WithStore(store EventStore) *Application {
@@ -71,58 +167,1112 @@ func (self *Application) WithStore(store EventStore) *Application {
 	return self
 }
 
+// WithSnapshots configures the application to load aggregates
+// implementing SnapshottableAggregate from their latest snapshot in
+// snapshots, replaying only the events stored after it.  A new
+// snapshot is saved whenever at least interval events have been
+// replayed onto an aggregate.
+//
+// Aggregates are snapshotted by their type and id.  If the stored
+// state cannot be restored by an aggregate, e.g. because its type has
+// changed incompatibly, loading the aggregate fails; remove the
+// snapshots in that case.
+func (self *Application) WithSnapshots(snapshots SnapshotStore, interval int) *Application {
+	self.snapshots = snapshots
+	self.snapshotInterval = interval
+	return self
+}
+
+// WithClock sets the clock used for acknowledging commands and
+// marking events as having occurred to clock.
+func (self *Application) WithClock(clock Clock) *Application {
+	self.clock = clock
+	return self
+}
+
+// Clock returns the clock used by the application.  Use it for
+// obtaining the current time consistently with the application,
+// e.g. in projections.
+func (self *Application) Clock() Clock {
+	return self.clock
+}
+
+// RegisterEventSchema registers an event type called name whose
+// payload needs to contain all of requiredKeys.
+//
+// Once any event schema has been registered, events emitted by
+// aggregates are checked before they are stored.  Events of an
+// unregistered type or missing required payload keys cause the
+// command to fail with a ValidationError, using the event's name as
+// the field name.  If no schema has been registered, all events are
+// accepted.
+func (self *Application) RegisterEventSchema(name string, requiredKeys ...string) *Application {
+	if self.schemas == nil {
+		self.schemas = map[string][]string{}
+	}
+	self.schemas[name] = requiredKeys
+	return self
+}
+
+// WithAggregateCache enables caching up to size aggregates between
+// commands.  When a command is sent to a cached aggregate, its
+// history is not replayed.  Instead the aggregate is advanced by
+// applying the events it emits once they have been stored.  The least
+// recently used aggregate is evicted once the cache is full.
+//
+// Aggregates are cached by their type and id, so that commands
+// targeting different aggregate types with the same id do not share
+// aggregates.  While a command is processed, its receiver is taken
+// out of the cache and only put back once the emitted events have
+// been stored.  Commands sent concurrently to the same aggregate are
+// processed one after the other, so that every command sees the
+// events emitted while processing the previous one.
+//
+// Aggregates are removed from the cache if processing a command fails
+// and if other aggregates emit events for them.  Events stored
+// without using the application are not seen by cached aggregates.
+func (self *Application) WithAggregateCache(size int) *Application {
+	self.cache = newAggregateCache(size)
+	return self
+}
+
+// WithStrictCommands causes commands which are processed without
+// emitting any events or returning an error to fail with
+// ErrCommandNotHandled.  This detects commands that are silently
+// ignored by aggregates, e.g. because of a typo in the command's name.
+//
+// Without this option, only aggregates implementing CommandLister are
+// checked, and only for commands they do not list.
+func (self *Application) WithStrictCommands() *Application {
+	self.strictCommands = true
+	return self
+}
+
+// WithInitProgress configures Init to call progress with the number
+// of events replayed so far after every n events and once after
+// replaying has finished.
+func (self *Application) WithInitProgress(n int, progress func(count int)) *Application {
+	self.progressInterval = n
+	self.progress = progress
+	return self
+}
+
+// WithCrossAggregateEvents allows aggregates to emit events for
+// streams other than their own.  Such events are logged as a warning
+// instead of causing the command to fail with ErrMisroutedEvent.
+func (self *Application) WithCrossAggregateEvents() *Application {
+	self.allowCrossAggregateEvents = true
+	return self
+}
+
+// Use adds middleware to the middlewares wrapping Send.  Middlewares
+// are run in the order in which they have been added, before the
+// command's receiver is loaded.
+func (self *Application) Use(middleware CommandMiddleware) *Application {
+	self.middlewares = append(self.middlewares, middleware)
+	return self
+}
+
 // WithProjection registers projection with name at the application.
 func (self *Application) WithProjection(name string, projection EventHandler) *Application {
-	self.projections[name] = projection
+	self.projections[name] = newProjection(name, projection)
+	return self
+}
+
+// WithAsyncProjection registers projection with name at the
+// application.  Events are passed to projection on a separate
+// goroutine, so that a slow projection does not delay processing
+// commands.  Use this for projections which do not need to reflect
+// the effects of a command immediately, e.g. search indexes.
+//
+// Up to ProjectionBufferSize events are buffered for the projection.
+// Once the buffer is full, projecting events blocks until the
+// projection catches up.  Close waits for buffered events to be
+// handled.
+func (self *Application) WithAsyncProjection(name string, projection EventHandler) *Application {
+	self.projections[name] = newAsyncProjection(name, projection)
+	return self
+}
+
+// WithDurableProjection registers projection with name at the
+// application and guarantees that every event stored after its
+// registration is passed to it at least once.
+//
+// The id of the last event handled by projection is recorded in
+// checkpoints.  Events stored after that event are pending delivery:
+// if the application stops after storing events but before
+// projecting them, Init passes the pending events to projection
+// instead of replaying the whole history.  Since an event might be
+// handled again if the application stops before its checkpoint has
+// been recorded, projection should tolerate duplicate events.
+//
+// If no checkpoint has been recorded yet, projection starts at the
+// head of the history: Init does not pass the events stored so far
+// to projection, but records the last of them as its checkpoint.  If
+// the recorded checkpoint is not found in the history, Init fails
+// with ErrCheckpointNotFound instead of passing every event ever
+// stored to projection.  Save an empty checkpoint for the projection
+// in checkpoints to start at the head again.
+//
+// Use this for projections with side effects outside of the
+// application, e.g. sending emails or calling webhooks.
+func (self *Application) WithDurableProjection(name string, checkpoints CheckpointStore, projection EventHandler) *Application {
+	self.projections[name] = newProjection(name, newDurableProjection(name, checkpoints, projection, self.logger))
+	return self
+}
+
+// WithCheckpoints configures the application to record the
+// checkpoints of projections implementing CheckpointedProjection in
+// checkpoints, so that Init does not replay events which these
+// projections have handled already.
+//
+// Checkpoints are recorded by Init, by Close and after every
+// CheckpointInterval projected events.  If the application stops
+// without calling Close, events handled after the last recorded
+// checkpoint are replayed again, so projections need to tolerate
+// handling an event more than once.
+//
+// If every projection not implementing LiveProjection has a
+// checkpoint, Init replays only the events stored since the earliest
+// checkpoint, using ReplaySince with the sequence recorded under
+// ReplayCheckpoint.  The event store still reads the events before
+// the checkpoint, but they are not passed to any projection.
+func (self *Application) WithCheckpoints(checkpoints CheckpointStore) *Application {
+	self.checkpoints = checkpoints
+	return self
+}
+
+// WithProjectionTimeout limits the time synchronous projections may
+// take for handling an event to timeout.  Projections exceeding the
+// timeout are logged and skipped for ProjectionCooldown, so that a
+// hung projection does not stall sending commands.  The timeout does
+// not apply while Init replays the history.
+//
+// Events arriving while a projection is skipped are queued and passed
+// to the projection along with the first event arriving after the
+// cooldown, so the projection's state is outdated until then.  Once
+// ProjectionPendingLimit events have been queued, further events are
+// dropped and logged.
+func (self *Application) WithProjectionTimeout(timeout time.Duration) *Application {
+	self.projectionTimeout = timeout
+	return self
+}
+
+// ProjectionNames returns the names of all registered projections in
+// alphabetical order.
+func (self *Application) ProjectionNames() []string {
+	names := []string{}
+	for name := range self.projections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ProjectionStatus returns the id of the last event handled by the
+// projection registered as name.  If no such projection exists, ok
+// is false.
+func (self *Application) ProjectionStatus(name string) (lastEventId string, ok bool) {
+	projection, found := self.projections[name]
+	if !found {
+		return "", false
+	}
+
+	return projection.Status().LastEventId, true
+}
+
+// Projections returns the status of all registered projections,
+// ordered by name.
+func (self *Application) Projections() []ProjectionStatus {
+	statuses := []ProjectionStatus{}
+	for _, projection := range self.projections {
+		statuses = append(statuses, projection.Status())
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+
+	return statuses
+}
+
+// WithQueryHandler registers handler for answering queries of the
+// same type as query.  Only the type of query is used, e.g.:
+//
+//	app.WithQueryHandler(RecentPosts{}, posts)
+func (self *Application) WithQueryHandler(query Query, handler QueryHandler) *Application {
+	self.queries[reflect.TypeOf(query)] = handler
 	return self
 }
 
+// Ask passes query to the handler registered for the query's type
+// and returns the handler's answer.  If no handler has been
+// registered, ErrUnknownQuery is returned.
+func (self *Application) Ask(query Query) (interface{}, error) {
+	handler, found := self.queries[reflect.TypeOf(query)]
+	if !found {
+		return nil, ErrUnknownQuery
+	}
+
+	return handler.HandleQuery(query)
+}
+
 // Project passes event to all of the application's projections.
 func (self *Application) Project(event *Event) {
-	for name, handler := range self.projections {
+	self.project(event, false)
+}
+
+// replayEvent passes event from the application's history to all
+// projections, except for projections implementing LiveProjection
+// which skip replaying.
+func (self *Application) replayEvent(event *Event) {
+	self.project(event, true)
+}
+
+// project passes event to the application's projections.  If
+// replaying is true, live projections are left out and projections
+// are not subject to the projection timeout, since replaying history
+// takes as long as it takes.
+func (self *Application) project(event *Event, replaying bool) {
+	timeout := self.projectionTimeout
+	if replaying {
+		timeout = 0
+	}
+
+	for name, projection := range self.projections {
+		if replaying && projection.live() {
+			continue
+		}
+		if projection.skip(event) {
+			continue
+		}
 		self.logger.Printf("PROJECT %s TO %s", event.Name, name)
-		handler.HandleEvent(event)
+		if err := projection.HandleEventWithin(event, timeout); err != nil {
+			self.logger.Printf("WARN %s: %s skipped by %s", err, event.Name, name)
+		}
+	}
+
+	if !replaying {
+		self.countProjected()
+	}
+}
+
+// ExportAll writes the state of all registered projections
+// implementing ExportableProjection to w.
+//
+// The data is written as a single JSON object, mapping the name of
+// each projection to the data exported by the projection.
+func (self *Application) ExportAll(w io.Writer) error {
+	exported := map[string]json.RawMessage{}
+	for name, registered := range self.projections {
+		projection, ok := registered.handler.(ExportableProjection)
+		if !ok {
+			continue
+		}
+
+		out := new(bytes.Buffer)
+		if err := projection.Export(out); err != nil {
+			return err
+		}
+		exported[name] = json.RawMessage(out.Bytes())
+	}
+
+	return json.NewEncoder(w).Encode(exported)
+}
+
+// ImportAll restores the state of all registered projections
+// implementing ImportableProjection from data written by ExportAll.
+//
+// Data for projections that are not registered with the application
+// or are not importable is ignored.
+func (self *Application) ImportAll(r io.Reader) error {
+	exported := map[string]json.RawMessage{}
+	if err := json.NewDecoder(r).Decode(&exported); err != nil {
+		return err
 	}
+
+	for name, data := range exported {
+		registered, found := self.projections[name]
+		if !found {
+			continue
+		}
+		projection, ok := registered.handler.(ImportableProjection)
+		if !ok {
+			continue
+		}
+
+		self.logger.Printf("IMPORT %s", name)
+		if err := projection.Import(bytes.NewReader(data)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Subscribe returns a channel receiving all events stored by Send
+// from now on, after they have been projected.  Call the returned
+// function to cancel the subscription and close the channel.
+//
+// Up to SubscriptionBufferSize events are buffered for each
+// subscriber.  Events are dropped for subscribers whose buffer is
+// full instead of blocking Send.
+func (self *Application) Subscribe() (<-chan *Event, func()) {
+	return self.subscribers.Subscribe()
 }
 
 // Init reconstructs application state from history.  Call this method
 // once initially after configuring your application.
+//
+// Use WithInitProgress for reporting the progress of replaying the
+// history.  Use WithCheckpoints for skipping events handled already
+// by projections persisting their state.  Projections implementing
+// PersistentProjection skip the events up to their own checkpoint.
+// Projections implementing LiveProjection are not passed the history.
+//
+// If the checkpoint of a projection is not found in the history, e.g.
+// because its stream has been deleted, a warning is logged and the
+// whole history is replayed through the projection once more.
+// Projections implementing ResettableProjection are reset before.
 func (self *Application) Init() error {
-	return self.store.Replay("*", EventHandlerFunc(self.Project))
+	if err := self.loadCheckpoints(); err != nil {
+		return err
+	}
+	position, err := self.replayPosition()
+	if err != nil {
+		return err
+	}
+
+	missed, err := self.replayHistory(position)
+	if err == nil && position > 0 && len(missed) > 0 {
+		self.logger.Printf("WARN checkpoints not found after sequence %d, replaying full history", position)
+		if err = self.loadCheckpoints(); err == nil {
+			missed, err = self.replayHistory(0)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, projection := range missed {
+		if _, ok := projection.handler.(*durableProjection); !ok {
+			self.logger.Printf("WARN checkpoint %s of %s not found, replaying full history", projection.skipper.checkpoint, projection.name)
+		}
+	}
+	if err := self.startDurableProjections(missed); err != nil {
+		return err
+	}
+	if err := self.replayFully(missed); err != nil {
+		return err
+	}
+
+	return self.saveCheckpoints()
+}
+
+// replayPosition returns the sequence of the first event to replay
+// through the application's projections.  Unless every projection
+// replaying history has a checkpoint, the whole history is replayed.
+func (self *Application) replayPosition() (int, error) {
+	if self.checkpoints == nil {
+		return 0, nil
+	}
+	for _, projection := range self.projections {
+		if !projection.live() && projection.skipper.checkpoint == "" {
+			return 0, nil
+		}
+	}
+
+	position, err := self.checkpoints.LoadCheckpoint(ReplayCheckpoint)
+	if err != nil || position == "" {
+		return 0, err
+	}
+	return strconv.Atoi(position)
+}
+
+// replayHistory replays the events stored since the sequence position
+// through the application's projections and returns the projections
+// whose checkpoint has not been encountered.
+func (self *Application) replayHistory(position int) ([]*projection, error) {
+	store := self.store
+	if position > 0 {
+		store = &eventsSince{EventStore: self.store, since: position}
+	}
+
+	var err error
+	if self.progress != nil {
+		err = ReplayWithProgress(store, "*", EventHandlerFunc(self.replayEvent), self.progressInterval, self.progress)
+	} else {
+		err = store.Replay("*", EventHandlerFunc(self.replayEvent))
+	}
+
+	return self.endReplay(), err
+}
+
+// endReplay stops all projections from skipping events and returns
+// the projections whose checkpoint has not been encountered while
+// replaying history.
+func (self *Application) endReplay() []*projection {
+	missed := []*projection{}
+	for _, projection := range self.projections {
+		if durable, ok := projection.handler.(*durableProjection); ok {
+			durable.endReplay()
+		}
+
+		if checkpoint := projection.skipper.stop(); checkpoint != "" {
+			missed = append(missed, projection)
+		}
+	}
+
+	return missed
+}
+
+// startDurableProjections records the checkpoints of durable
+// projections starting at the head of the history.  If the
+// checkpoint of a durable projection is among the missed ones,
+// ErrCheckpointNotFound is returned, since the events pending
+// delivery cannot be determined.
+func (self *Application) startDurableProjections(missed []*projection) error {
+	for _, projection := range missed {
+		if _, ok := projection.handler.(*durableProjection); ok {
+			self.logger.Printf("FAIL checkpoint of %s: %s", projection.name, ErrCheckpointNotFound)
+			return ErrCheckpointNotFound
+		}
+	}
+
+	for _, projection := range self.projections {
+		if durable, ok := projection.handler.(*durableProjection); ok {
+			if err := durable.saveHead(); err != nil {
+				return err
+			}
+			projection.updateCheckpoint()
+		}
+	}
+
+	return nil
 }
 
-// Send sends command to the application for processing.  Send is not
+// replayFully resets projections and replays the whole history
+// through them.
+func (self *Application) replayFully(projections []*projection) error {
+	if len(projections) == 0 {
+		return nil
+	}
+
+	for _, projection := range projections {
+		if err := projection.reset(); err != nil {
+			return err
+		}
+	}
+
+	return self.store.Replay("*", EventHandlerFunc(func(event *Event) {
+		for _, projection := range projections {
+			projection.HandleEvent(event)
+		}
+	}))
+}
+
+// loadCheckpoints configures all checkpointed and persistent
+// projections to skip the events up to their recorded checkpoints.
+func (self *Application) loadCheckpoints() error {
+	for name, projection := range self.projections {
+		checkpoint := ""
+		var err error
+		switch handler := projection.handler.(type) {
+		case PersistentProjection:
+			checkpoint, err = handler.LoadCheckpoint()
+		case CheckpointedProjection:
+			if self.checkpoints == nil {
+				continue
+			}
+			checkpoint, err = self.checkpoints.LoadCheckpoint(name)
+		}
+		if err != nil {
+			return err
+		}
+		projection.skipper.skipUntil(checkpoint)
+	}
+
+	return nil
+}
+
+// saveCheckpoints records the checkpoints of all checkpointed
+// projections not persisting their checkpoints themselves, followed
+// by the sequence of the earliest checkpoint of all projections
+// replaying history.
+func (self *Application) saveCheckpoints() error {
+	if self.checkpoints == nil {
+		return nil
+	}
+
+	self.checkpointMutex.Lock()
+	defer self.checkpointMutex.Unlock()
+
+	position := int64(0)
+	complete := true
+	for name, projection := range self.projections {
+		if projection.live() {
+			continue
+		}
+
+		checkpoint, sequence := projection.Checkpoint()
+		if sequence == 0 {
+			complete = false
+		} else if position == 0 || sequence < position {
+			position = sequence
+		}
+
+		if _, persistent := projection.handler.(PersistentProjection); persistent || checkpoint == "" {
+			continue
+		}
+		if err := self.checkpoints.SaveCheckpoint(name, checkpoint); err != nil {
+			return err
+		}
+	}
+
+	if !complete {
+		position = 0
+	}
+	return self.checkpoints.SaveCheckpoint(ReplayCheckpoint, strconv.FormatInt(position, 10))
+}
+
+// countProjected records checkpoints after every CheckpointInterval
+// events projected.
+func (self *Application) countProjected() {
+	if self.checkpoints == nil {
+		return
+	}
+
+	self.checkpointMutex.Lock()
+	self.projected++
+	due := self.projected%CheckpointInterval == 0
+	self.checkpointMutex.Unlock()
+
+	if !due {
+		return
+	}
+	if err := self.saveCheckpoints(); err != nil {
+		self.logger.Printf("FAIL checkpoints: %s", err)
+	}
+}
+
+// Replay passes all events of the stream identified by streamId from
+// the application's event store to handler, without registering
+// handler as a projection.  Use "*" as the stream id to replay all
+// events.
+//
+// Use this method for one-off analyses of the application's history.
+func (self *Application) Replay(streamId string, handler EventHandler) error {
+	return self.store.Replay(streamId, handler)
+}
+
+// Close releases the resources held by the application.  Events
+// queued for asynchronous projections are handled before Close
+// returns; no commands may be sent afterwards, and events projected
+// afterwards are dropped by asynchronous projections.  The
+// checkpoints of projections are recorded if the application has
+// been configured using WithCheckpoints.  If the application's event
+// store implements io.Closer, the store is closed.  Call this method
+// when shutting down the application.
+func (self *Application) Close() error {
+	for _, projection := range self.projections {
+		projection.drain()
+	}
+	if err := self.saveCheckpoints(); err != nil {
+		return err
+	}
+	if closer, ok := self.store.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Exists returns true if any events have been stored for the stream
+// identified by streamId.  Use it for guard clauses which need to
+// know whether an aggregate exists without constructing it.
+//
+// If the application's event store implements IterableEventStore,
+// only the first event of the stream is read.  Otherwise the whole
+// stream is replayed.
+func (self *Application) Exists(streamId string) (bool, error) {
+	if store, ok := self.store.(IterableEventStore); ok {
+		events, err := store.Iterate(streamId)
+		if err != nil {
+			return false, err
+		}
+		defer events.Close()
+
+		found := events.Next()
+		return found, events.Err()
+	}
+
+	found := false
+	err := self.store.Replay(streamId, EventHandlerFunc(func(*Event) {
+		found = true
+	}))
+	return found, err
+}
+
+// Load returns the aggregate identified by id in its current state.
+// The aggregate is constructed using definition's target function and
+// its history is replayed onto it.
+//
+// If the aggregate has not emitted any events yet,
+// ErrAggregateNotFound is returned.  Composite ids are split at
+// CompositeIdSeparator into the values of the definition's id
+// fields; ErrAggregateNotFound is returned as well if id does not
+// consist of exactly that many parts.  If id cannot be parsed by the
+// id fields, a *ValidationError is returned without replaying any
+// events.
+//
+// Use this method for accessing a single domain object for reading.
+func (self *Application) Load(definition *CommandDefinition, id string) (Aggregate, error) {
+	command := definition.NewCommand()
+	if len(definition.IdFields) > 0 {
+		parts := strings.Split(id, CompositeIdSeparator)
+		if len(parts) != len(definition.IdFields) {
+			return nil, ErrAggregateNotFound
+		}
+		for i, part := range parts {
+			command.Set(definition.IdFields[i], part)
+		}
+	} else {
+		command.Set(definition.IdField, id)
+	}
+	if err := command.Validate(); err != nil {
+		return nil, err
+	}
+	receiver := command.Receiver()
+
+	seen, err := self.replay(receiver)
+	if err != nil {
+		return nil, err
+	}
+
+	if seen == 0 {
+		return nil, ErrAggregateNotFound
+	}
+
+	return receiver, nil
+}
+
+// replay replays the history of receiver onto receiver and returns
+// the number of events replayed.
+//
+// If snapshots are enabled and receiver implements
+// SnapshottableAggregate, it is restored from its latest snapshot and
+// only the events stored after the snapshot are replayed.  The
+// returned number includes the events contained in the snapshot.
+func (self *Application) replay(receiver Aggregate) (int, error) {
+	if snapshottable, ok := receiver.(SnapshottableAggregate); ok && self.snapshots != nil {
+		return self.replaySnapshot(snapshottable)
+	}
+
+	seen := 0
+	err := self.store.Replay(receiver.Id(), EventHandlerFunc(func(event *Event) {
+		seen++
+		receiver.HandleEvent(event)
+	}))
+
+	return seen, err
+}
+
+// replaySnapshot restores receiver from its latest snapshot, replays
+// the events stored after it and returns the number of events applied
+// to receiver.  If enough events have been replayed, a new snapshot
+// is saved.
+func (self *Application) replaySnapshot(receiver SnapshottableAggregate) (int, error) {
+	kind := aggregateType(receiver)
+	snapshot, err := self.snapshots.LoadSnapshot(kind, receiver.Id())
+	if err != nil {
+		return 0, err
+	}
+
+	version := 0
+	if snapshot != nil {
+		if err := receiver.UnmarshalSnapshot(snapshot.Data); err != nil {
+			return 0, err
+		}
+		version = snapshot.Version
+	}
+
+	replayed := 0
+	err = ReplaySince(self.store, receiver.Id(), version, EventHandlerFunc(func(event *Event) {
+		replayed++
+		receiver.HandleEvent(event)
+	}))
+	if err != nil {
+		return 0, err
+	}
+
+	if replayed > 0 && replayed >= self.snapshotInterval {
+		self.saveSnapshot(receiver, kind, version+replayed)
+	}
+
+	return version + replayed, nil
+}
+
+// saveSnapshot saves the state of receiver at version.  Since the
+// snapshot can be taken again later, failures are logged instead of
+// being returned.
+func (self *Application) saveSnapshot(receiver SnapshottableAggregate, kind string, version int) {
+	data, err := receiver.MarshalSnapshot()
+	if err == nil {
+		err = self.snapshots.SaveSnapshot(&Snapshot{
+			AggregateType: kind,
+			StreamId:      receiver.Id(),
+			Version:       version,
+			Data:          data,
+		})
+	}
+	if err != nil {
+		self.logger.Printf("FAIL snapshot %s %s: %s", kind, receiver.Id(), err)
+	}
+}
+
+// aggregateType returns the name of the type of aggregate, qualified
+// by its package path.
+func aggregateType(aggregate Aggregate) string {
+	kind := reflect.TypeOf(aggregate)
+	for kind.Kind() == reflect.Ptr {
+		kind = kind.Elem()
+	}
+	return kind.PkgPath() + "." + kind.Name()
+}
+
+// Send sends command to the application for processing, passing it
+// through all middlewares registered with Use first.  Send is not
 // thread safe.
 func (self *Application) Send(command *Command) *CommandResult {
-	command.Acknowledge(self.clock)
+	send := self.send
+	for i := len(self.middlewares) - 1; i >= 0; i-- {
+		send = self.middlewares[i](send)
+	}
 
-	receiver := command.Receiver()
+	return send(command)
+}
 
-	if err := self.store.Replay(receiver.Id(), receiver); err != nil {
+// send processes command, storing and projecting the events emitted
+// by its receiver.
+func (self *Application) send(command *Command) *CommandResult {
+	unlock := self.lock(command)
+	receiver, version, events, err := self.execute(command)
+	if err != nil {
+		self.uncache(command.AggregateId())
+		unlock()
 		return NewErrorResult(err)
 	}
 
+	for _, event := range events {
+		self.logger.Printf("EVENT %s", event.Name)
+	}
+	if err := self.store.Store(events); err != nil {
+		self.uncache(receiver.Id())
+		unlock()
+		return NewErrorResult(err)
+	}
+	self.advance(receiver, version, events)
+	unlock()
+
+	for _, event := range events {
+		self.Project(event)
+		self.subscribers.HandleEvent(event)
+	}
+
+	result := NewSuccessResult(receiver, events...)
+	result.version = version
+	for _, event := range events {
+		if event.StreamId == receiver.Id() {
+			result.version++
+		}
+	}
+	return result
+}
+
+// SendWithRetry sends command to the application like Send.  If
+// storing the emitted events fails with ErrConcurrencyConflict, the
+// command is processed again by a fresh receiver, up to maxAttempts
+// times in total.
+//
+// Every attempt after the first one uses a copy of command, taken
+// before the first attempt, so that no state is carried over between
+// attempts.
+func (self *Application) SendWithRetry(command *Command, maxAttempts int) *CommandResult {
+	original := command.Copy()
+	result := self.Send(command)
+	for attempt := 1; attempt < maxAttempts && result.Error() == ErrConcurrencyConflict; attempt++ {
+		self.logger.Printf("RETRY %s: %s", command.Name, ErrConcurrencyConflict)
+		result = self.Send(original.Copy())
+	}
+
+	return result
+}
+
+// Seed stores events in the given order as a single batch and
+// projects them, e.g. for importing data of a legacy system once.
+// Events without an id are assigned one, events without an
+// occurrence or persistence time are stamped using the application's
+// clock.  Cached aggregates of the affected streams are discarded.
+//
+// Seeding the same events twice stores them twice; make sure to seed
+// an application only once.
+func (self *Application) Seed(events []*Event) error {
+	for _, event := range events {
+		if event.Id == "" {
+			event.Id = generateId()
+		}
+		if event.OccurredOn.IsZero() {
+			event.Occur(self.clock)
+		}
+		event.Persist(self.clock)
+		self.uncache(event.StreamId)
+		self.logger.Printf("SEED %s", event.Name)
+	}
+
+	if err := self.store.Store(events); err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		self.Project(event)
+		self.subscribers.HandleEvent(event)
+	}
+
+	return nil
+}
+
+// DeleteStream removes all events of the stream identified by
+// streamId from the application's event store and records a
+// "stream.deleted" event, so that projections can remove any data
+// derived from the deleted events.  The stream id is passed in the
+// event's payload as "stream_id"; the event itself is stored in the
+// stream identified by TombstoneStream.
+//
+// ErrStreamDeletionNotSupported is returned if the application's
+// event store does not implement StreamDeleter.
+//
+// This intentionally breaks the immutability of the event log.  Use
+// it only when data has to be forgotten, e.g. for legal reasons.
+func (self *Application) DeleteStream(streamId string) error {
+	deleter, ok := self.store.(StreamDeleter)
+	if !ok {
+		return ErrStreamDeletionNotSupported
+	}
+
+	self.uncache(streamId)
+	if snapshots, ok := self.snapshots.(StreamDeleter); ok {
+		if err := snapshots.DeleteStream(streamId); err != nil {
+			return err
+		}
+	}
+	if err := deleter.DeleteStream(streamId); err != nil {
+		return err
+	}
+
+	tombstone := NewEvent("stream.deleted").Add("stream_id", streamId)
+	tombstone.Id = generateId()
+	tombstone.StreamId = TombstoneStream
+	tombstone.Occur(self.clock)
+
+	self.logger.Printf("EVENT %s", tombstone.Name)
+	if err := self.store.Store([]*Event{tombstone}); err != nil {
+		return err
+	}
+
+	self.Project(tombstone)
+	self.subscribers.HandleEvent(tombstone)
+	return nil
+}
+
+// Preview processes command like Send, but returns the events that
+// would have been emitted instead of storing and projecting them.
+//
+// Use this method to find out what would happen when sending command
+// to the application without changing application state.  Command is
+// processed by a copy, so that it can be sent afterwards.
+func (self *Application) Preview(command *Command) ([]*Event, error) {
+	_, _, events, err := self.execute(command.Copy())
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// handlesCommand returns false if command, which did not cause any
+// events, is not known to receiver.
+func (self *Application) handlesCommand(receiver Aggregate, command *Command) bool {
+	if self.strictCommands {
+		return false
+	}
+
+	lister, ok := receiver.(CommandLister)
+	if !ok {
+		return true
+	}
+
+	for _, name := range lister.KnownCommands() {
+		if name == command.Name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkSchemas returns a ValidationError if any of events does not
+// match the registered event schemas.
+func (self *Application) checkSchemas(events []*Event) error {
+	if len(self.schemas) == 0 {
+		return nil
+	}
+
+	invalid := NewValidationError()
+	for _, event := range events {
+		requiredKeys, found := self.schemas[event.Name]
+		if !found {
+			invalid.AddCode(event.Name, "unknown_event")
+			continue
+		}
+
+		for _, key := range requiredKeys {
+			if _, found := event.Payload[key]; !found {
+				invalid.AddCode(event.Name, "missing_payload_key", key)
+			}
+		}
+	}
+
+	return invalid.Return()
+}
+
+// cachedReceiver takes the cached aggregate of the same type and id
+// as the command's receiver out of the cache, sets it as the
+// command's receiver and returns it with its version.  If caching is
+// disabled, the command's receiver has been set already or the
+// aggregate is not cached, false is returned.
+func (self *Application) cachedReceiver(command *Command) (Aggregate, int, bool) {
+	if self.cache == nil || command.receiver != nil || command.AggregateId() == "" {
+		return nil, 0, false
+	}
+
+	receiver, version, found := self.cache.Take(command.Receiver())
+	if found {
+		command.receiver = receiver
+	}
+	return receiver, version, found
+}
+
+// advance applies the events emitted by receiver to it and caches
+// it.  Cached aggregates receiving events from receiver are removed
+// from the cache.
+func (self *Application) advance(receiver Aggregate, version int, events []*Event) {
+	if self.cache == nil {
+		return
+	}
+
+	for _, event := range events {
+		if event.StreamId == receiver.Id() {
+			receiver.HandleEvent(event)
+			version++
+		} else {
+			self.cache.Remove(event.StreamId)
+		}
+	}
+
+	self.cache.Put(receiver, version)
+}
+
+// lock waits until no other command is processed by the receiver of
+// command and returns a function releasing the lock.  Commands are
+// only serialised if the aggregate cache is enabled.
+func (self *Application) lock(command *Command) func() {
+	if self.cache == nil || command.AggregateId() == "" {
+		return func() {}
+	}
+	return self.cache.Lock(command.AggregateId())
+}
+
+// uncache removes the aggregate identified by id from the cache.
+func (self *Application) uncache(id string) {
+	if self.cache != nil {
+		self.cache.Remove(id)
+	}
+}
+
+// execute acknowledges command, replays the history of the command's
+// receiver and passes command to the receiver.  The receiver, the
+// number of events replayed onto it and the events emitted by the
+// receiver are returned without storing the events.
+//
+// If the receiver is cached, its history is not replayed.
+func (self *Application) execute(command *Command) (Aggregate, int, []*Event, error) {
+	command.Acknowledge(self.clock)
+
+	if self.authorizer != nil {
+		if err := self.authorizer.Authorize(command); err != nil {
+			self.logger.Printf("DENY %s: %s", command.Name, err)
+			return nil, 0, nil, err
+		}
+	}
+
+	receiver, seen, cached := self.cachedReceiver(command)
+	if !cached {
+		receiver = command.Receiver()
+
+		var err error
+		seen, err = self.replay(receiver)
+		if err != nil {
+			return nil, 0, nil, err
+		}
+	}
+
+	if seen == 0 && command.requireExisting {
+		self.logger.Printf("DENY %s: %s", receiver.Id(), ErrAggregateNotFound)
+		return nil, 0, nil, ErrAggregateNotFound
+	}
+
 	transaction := NewEventsInMemory()
 	receiver.PublishWith(transaction)
 
 	self.logger.Printf("EXECUTE %s", command)
 	if err := command.Execute(); err != nil {
 		self.logger.Printf("DENY %s", err)
-		return NewErrorResult(err)
+		return nil, 0, nil, err
 	}
 
 	events := transaction.Events()
+	if len(events) == 0 && !self.handlesCommand(receiver, command) {
+		self.logger.Printf("DENY %s: %s", ErrCommandNotHandled, command.Name)
+		return nil, 0, nil, ErrCommandNotHandled
+	}
+
 	for _, event := range events {
-		event.Occur(self.clock)
-		self.logger.Printf("EVENT %s", event.Name)
+		if event.StreamId == receiver.Id() {
+			continue
+		}
+
+		if !self.allowCrossAggregateEvents {
+			self.logger.Printf("DENY %s: %s emitted by %s", ErrMisroutedEvent, event.Name, receiver.Id())
+			return nil, 0, nil, ErrMisroutedEvent
+		}
+		self.logger.Printf("WARN %s: %s emitted by %s", ErrMisroutedEvent, event.Name, receiver.Id())
 	}
-	if err := self.store.Store(events); err != nil {
-		return NewErrorResult(err)
+
+	if err := self.checkSchemas(events); err != nil {
+		self.logger.Printf("DENY %s", err)
+		return nil, 0, nil, err
 	}
 
 	for _, event := range events {
-		self.Project(event)
+		if event.Id == "" {
+			event.Id = generateId()
+		}
+		event.Occur(self.clock).CausedBy(command)
+		for key, value := range command.Metadata {
+			if _, found := event.Metadata[key]; !found {
+				event.WithMeta(key, value)
+			}
+		}
 	}
 
-	return NewSuccessResult(receiver)
+	return receiver, seen, events, nil
 }
@@ -1,7 +1,14 @@
 package ess
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -44,7 +51,7 @@ func (self *LineWriter) Write(data []byte) (n int, err error) {
 func NewTestApp() *Application {
 	CurrentLines = []string{}
 	app := NewApplication("test")
-	app.clock = &StaticClock{TheTime}
+	app.WithClock(&StaticClock{TheTime})
 	app.WithLogger(log.New(NewLineWriter(&CurrentLines), "test ", 0))
 	return app
 }
@@ -63,6 +70,55 @@ func TestApplication_Send_acknowledgesCommand(t *testing.T) {
 	}
 }
 
+func TestApplication_WithClock_setsTimeOfCommands(t *testing.T) {
+	now := time.Date(2015, 6, 7, 8, 9, 10, 0, time.UTC)
+	clock := &StaticClock{now}
+	app := NewTestApp().WithClock(clock)
+	cmd := TestCommand.NewCommand()
+	if err := app.Send(cmd).Error(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := app.Clock(), Clock(clock); got != want {
+		t.Errorf(`app.Clock() = %v; want %v`, got, want)
+	}
+
+	if got, want := cmd.Get("now").(*Time).Time, now; !got.Equal(want) {
+		t.Errorf(`cmd.Get("now").(*Time).Time = %q; want %q`, got, want)
+	}
+}
+
+type closingStore struct {
+	*EventsInMemory
+	closed bool
+}
+
+func (self *closingStore) Close() error {
+	self.closed = true
+	return nil
+}
+
+func TestApplication_Close_closesStore(t *testing.T) {
+	store := &closingStore{EventsInMemory: NewEventsInMemory()}
+	app := NewTestApp().WithStore(store)
+
+	if err := app.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := store.closed, true; got != want {
+		t.Errorf("store.closed = %v; want %v", got, want)
+	}
+}
+
+func TestApplication_Close_ignoresStoresWithoutClose(t *testing.T) {
+	app := NewTestApp()
+
+	if err := app.Close(); err != nil {
+		t.Errorf("app.Close() = %v; want %v", err, nil)
+	}
+}
+
 func TestApplication_Send_replaysHistoryOnReceiver(t *testing.T) {
 	app := NewTestApp()
 	seen := 0
@@ -120,6 +176,25 @@ func TestApplication_Send_marksOccurrenceOnEvents(t *testing.T) {
 	}
 }
 
+func TestApplication_Send_assignsIdsToEvents(t *testing.T) {
+	app := NewTestApp()
+	cmd := TestCommand.NewCommand()
+	receiver := newTestAggregate("test")
+	cmd.receiver = receiver
+	event := NewEvent("test.run").For(cmd.receiver)
+	receiver.onCommand = func(agg *testAggregate) {
+		agg.events.PublishEvent(event)
+	}
+
+	if err := app.Send(cmd).Error(); err != nil {
+		t.Fatal(err)
+	}
+
+	if event.Id == "" {
+		t.Errorf("event.Id is empty")
+	}
+}
+
 func TestApplication_Send_storesEvents(t *testing.T) {
 	transaction := NewEventsInMemory()
 	app := NewTestApp().WithStore(transaction)
@@ -137,7 +212,7 @@ func TestApplication_Send_storesEvents(t *testing.T) {
 	}
 
 	if got, want := transaction.Events()[0], event; got != want {
-		t.Errorf("transaction.Events()[0] = %q; want %q", got, want)
+		t.Errorf("transaction.Events()[0] = %v; want %v", got, want)
 	}
 }
 
@@ -199,3 +274,1536 @@ func TestApplication_Init_replaysHistoryThroughProjections(t *testing.T) {
 	}
 
 }
+
+func TestApplication_Replay_passesHistoryToHandler(t *testing.T) {
+	store := NewEventsInMemory()
+	store.Store([]*Event{
+		NewEvent("user.signed-up"),
+		NewEvent("user.logged-in"),
+		NewEvent("user.logged-in"),
+	})
+	app := NewTestApp().WithStore(store)
+
+	counts := map[string]int{}
+	err := app.Replay("*", EventHandlerFunc(func(event *Event) {
+		counts[event.Name]++
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := counts, map[string]int{"user.signed-up": 1, "user.logged-in": 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("counts = %v; want %v", got, want)
+	}
+}
+
+func TestApplication_Preview_doesNotStoreEvents(t *testing.T) {
+	store := NewEventsInMemory()
+	app := NewTestApp().WithStore(store)
+	cmd := TestCommand.NewCommand()
+	cmd.receiverFunc = func(*Command) Aggregate {
+		receiver := newTestAggregate("test")
+		receiver.onCommand = func(agg *testAggregate) {
+			agg.events.PublishEvent(NewEvent("test.run").For(agg).Add("param", "value"))
+		}
+		return receiver
+	}
+
+	events, err := app.Preview(cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(store.Events()), 0; got != want {
+		t.Errorf("len(store.Events()) = %d; want %d", got, want)
+	}
+	if cmd.receiver != nil {
+		t.Errorf("cmd.receiver = %v; want nil", cmd.receiver)
+	}
+
+	if err := app.Send(cmd).Error(); err != nil {
+		t.Fatal(err)
+	}
+
+	stored := store.Events()
+	if got, want := len(events), len(stored); got != want {
+		t.Fatalf("len(events) = %d; want %d", got, want)
+	}
+
+	for i, event := range events {
+		if got, want := event.Name, stored[i].Name; got != want {
+			t.Errorf("events[%d].Name = %q; want %q", i, got, want)
+		}
+		if got, want := event.StreamId, stored[i].StreamId; got != want {
+			t.Errorf("events[%d].StreamId = %q; want %q", i, got, want)
+		}
+		if got, want := event.Payload["param"], stored[i].Payload["param"]; got != want {
+			t.Errorf(`events[%d].Payload["param"] = %q; want %q`, i, got, want)
+		}
+		if got, want := event.OccurredOn, stored[i].OccurredOn; !got.Equal(want) {
+			t.Errorf("events[%d].OccurredOn = %q; want %q", i, got, want)
+		}
+	}
+}
+
+func TestApplication_Preview_returnsErrorIfExecutingCommandFails(t *testing.T) {
+	cmd := TestCommand.NewCommand()
+	failure := NewValidationError().Add("param", "invalid")
+	cmd.receiverFunc = func(*Command) Aggregate {
+		return newTestAggregate("test").FailWith(failure.Return())
+	}
+	app := NewTestApp()
+
+	if _, err := app.Preview(cmd); err != failure {
+		t.Errorf("app.Preview(cmd) = %q; want %q", err, failure)
+	}
+}
+
+type countingProjection struct {
+	Count int `json:"count"`
+}
+
+func (self *countingProjection) HandleEvent(*Event) { self.Count++ }
+
+func (self *countingProjection) Export(w io.Writer) error {
+	return json.NewEncoder(w).Encode(self)
+}
+
+func (self *countingProjection) Import(r io.Reader) error {
+	return json.NewDecoder(r).Decode(self)
+}
+
+func TestApplication_ExportAll_ImportAll_roundTripsProjections(t *testing.T) {
+	a, b := &countingProjection{}, &countingProjection{}
+	app := NewTestApp().
+		WithProjection("a", a).
+		WithProjection("b", b)
+	app.Project(NewEvent("test.run"))
+	a.HandleEvent(NewEvent("test.run"))
+
+	backup := new(bytes.Buffer)
+	if err := app.ExportAll(backup); err != nil {
+		t.Fatal(err)
+	}
+
+	restoredA, restoredB := &countingProjection{}, &countingProjection{}
+	restored := NewTestApp().
+		WithProjection("a", restoredA).
+		WithProjection("b", restoredB)
+	if err := restored.ImportAll(backup); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := restoredA.Count, a.Count; got != want {
+		t.Errorf("restoredA.Count = %d; want %d", got, want)
+	}
+
+	if got, want := restoredB.Count, b.Count; got != want {
+		t.Errorf("restoredB.Count = %d; want %d", got, want)
+	}
+}
+
+func TestApplication_Send_stampsEventsWithCorrelationAndCausation(t *testing.T) {
+	app := NewTestApp()
+	cmd := TestCommand.NewCommand().CorrelateWith("request")
+	receiver := newTestAggregate("test")
+	cmd.receiver = receiver
+	event := NewEvent("test.run").For(cmd.receiver)
+	receiver.onCommand = func(agg *testAggregate) {
+		agg.events.PublishEvent(event)
+	}
+
+	result := app.Send(cmd)
+	if err := result.Error(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := event.CorrelationId, "request"; got != want {
+		t.Errorf("event.CorrelationId = %q; want %q", got, want)
+	}
+
+	if got, want := event.CausationId, cmd.Id; got != want {
+		t.Errorf("event.CausationId = %q; want %q", got, want)
+	}
+}
+
+func TestApplication_Send_correlatesEventsWithCommandByDefault(t *testing.T) {
+	app := NewTestApp()
+	cmd := TestCommand.NewCommand()
+	receiver := newTestAggregate("test")
+	cmd.receiver = receiver
+	event := NewEvent("test.run").For(cmd.receiver)
+	receiver.onCommand = func(agg *testAggregate) {
+		agg.events.PublishEvent(event)
+	}
+
+	result := app.Send(cmd)
+	if err := result.Error(); err != nil {
+		t.Fatal(err)
+	}
+
+	if cmd.Id == "" {
+		t.Fatalf("cmd.Id is empty")
+	}
+
+	if got, want := event.CorrelationId, cmd.Id; got != want {
+		t.Errorf("event.CorrelationId = %q; want %q", got, want)
+	}
+}
+
+func TestApplication_Send_stampsEventsWithCommandMetadata(t *testing.T) {
+	app := NewTestApp()
+	cmd := TestCommand.NewCommand().
+		WithMeta("client_ip", "127.0.0.1").
+		WithMeta("request_id", "request")
+	receiver := newTestAggregate("test")
+	cmd.receiver = receiver
+	event := NewEvent("test.run").For(cmd.receiver).WithMeta("request_id", "own")
+	receiver.onCommand = func(agg *testAggregate) {
+		agg.events.PublishEvent(event)
+	}
+
+	result := app.Send(cmd)
+	if err := result.Error(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{"client_ip": "127.0.0.1", "request_id": "own"}
+	if got := event.Metadata; !reflect.DeepEqual(got, want) {
+		t.Errorf("event.Metadata = %v; want %v", got, want)
+	}
+	if _, found := event.Payload["client_ip"]; found {
+		t.Errorf("event.Payload contains metadata")
+	}
+}
+
+func TestApplication_Init_reportsProgress(t *testing.T) {
+	store := NewEventsInMemory()
+	for i := 0; i < 25; i++ {
+		store.Store([]*Event{NewEvent("test.event")})
+	}
+
+	reported := []int{}
+	app := NewTestApp().WithStore(store).WithInitProgress(10, func(count int) {
+		reported = append(reported, count)
+	})
+
+	if err := app.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := reported, []int{10, 20, 25}; !reflect.DeepEqual(got, want) {
+		t.Errorf("reported = %v; want %v", got, want)
+	}
+}
+
+func TestApplication_Load_replaysHistoryOnAggregate(t *testing.T) {
+	app := NewTestApp()
+	app.store.Store([]*Event{
+		NewEvent("test.run").For(newTestAggregate("other")),
+		NewEvent("test.run").For(newTestAggregate("test")),
+		NewEvent("test.run").For(newTestAggregate("test")),
+	})
+	seen := 0
+	definition := NewCommandDefinition("test").
+		Target(func(command *Command) Aggregate {
+			aggregate := newTestAggregateFromCommand(command).(*testAggregate)
+			aggregate.onEvent = func(*Event) { seen++ }
+			return aggregate
+		})
+
+	aggregate, err := app.Load(definition, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := aggregate.Id(), "test"; got != want {
+		t.Errorf("aggregate.Id() = %q; want %q", got, want)
+	}
+
+	if got, want := seen, 2; got != want {
+		t.Errorf("seen = %d; want %d", got, want)
+	}
+}
+
+func TestApplication_Load_returnsErrorIfIdIsMalformed(t *testing.T) {
+	app := NewTestApp()
+
+	_, err := app.Load(TestCommand, "Not Valid")
+	invalid, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("app.Load(TestCommand, %q) = %v; want *ValidationError", "Not Valid", err)
+	}
+	if got, want := len(invalid.Errors["id"]), 1; got != want {
+		t.Errorf(`len(invalid.Errors["id"]) = %d; want %d`, got, want)
+	}
+}
+
+func TestApplication_Load_returnsErrorIfAggregateDoesNotExist(t *testing.T) {
+	app := NewTestApp()
+
+	if _, err := app.Load(TestCommand, "test"); err != ErrAggregateNotFound {
+		t.Errorf("app.Load(TestCommand, %q) = %v; want %v", "test", err, ErrAggregateNotFound)
+	}
+}
+
+func TestApplication_Subscribe_receivesStoredEvents(t *testing.T) {
+	app := NewTestApp()
+	events, unsubscribe := app.Subscribe()
+	defer unsubscribe()
+	cmd := TestCommand.NewCommand()
+	receiver := newTestAggregate("test")
+	cmd.receiver = receiver
+	event := NewEvent("test.run").For(cmd.receiver)
+	receiver.onCommand = func(agg *testAggregate) {
+		agg.events.PublishEvent(event)
+	}
+
+	if err := app.Send(cmd).Error(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case got := <-events:
+		if want := event; got != want {
+			t.Errorf("<-events = %v; want %v", got, want)
+		}
+	default:
+		t.Fatal("no event received")
+	}
+}
+
+func TestApplication_Subscribe_dropsEventsForSlowSubscribers(t *testing.T) {
+	app := NewTestApp()
+	events, unsubscribe := app.Subscribe()
+	for i := 0; i < SubscriptionBufferSize+1; i++ {
+		app.subscribers.HandleEvent(NewEvent("test.run"))
+	}
+	unsubscribe()
+
+	received := 0
+	for range events {
+		received++
+	}
+
+	if got, want := received, SubscriptionBufferSize; got != want {
+		t.Errorf("received = %d; want %d", got, want)
+	}
+}
+
+func TestApplication_Send_returnsErrorIfRequiredAggregateDoesNotExist(t *testing.T) {
+	app := NewTestApp()
+	handled := false
+	definition := NewCommandDefinition("test").
+		Target(newTestAggregateFromCommand).
+		MustExist()
+	cmd := definition.NewCommand()
+	receiver := newTestAggregate("test")
+	receiver.onCommand = func(*testAggregate) { handled = true }
+	cmd.receiver = receiver
+
+	if err := app.Send(cmd).Error(); err != ErrAggregateNotFound {
+		t.Errorf("app.Send(cmd).Error() = %v; want %v", err, ErrAggregateNotFound)
+	}
+
+	if handled {
+		t.Errorf("command has been handled")
+	}
+}
+
+func TestApplication_Send_handlesCommandIfRequiredAggregateExists(t *testing.T) {
+	app := NewTestApp()
+	handled := false
+	definition := NewCommandDefinition("test").
+		Target(newTestAggregateFromCommand).
+		MustExist()
+	cmd := definition.NewCommand()
+	receiver := newTestAggregate("test")
+	receiver.onCommand = func(*testAggregate) { handled = true }
+	cmd.receiver = receiver
+	app.store.Store([]*Event{NewEvent("test.run").For(receiver)})
+
+	if err := app.Send(cmd).Error(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !handled {
+		t.Errorf("command has not been handled")
+	}
+}
+
+func TestApplication_Send_rejectsEventsForOtherStreams(t *testing.T) {
+	store := NewEventsInMemory()
+	app := NewTestApp().WithStore(store)
+	cmd := TestCommand.NewCommand()
+	receiver := newTestAggregate("test")
+	cmd.receiver = receiver
+	receiver.onCommand = func(agg *testAggregate) {
+		agg.events.PublishEvent(NewEvent("test.run").For(newTestAggregate("other")))
+	}
+
+	if err := app.Send(cmd).Error(); err != ErrMisroutedEvent {
+		t.Errorf("app.Send(cmd).Error() = %v; want %v", err, ErrMisroutedEvent)
+	}
+
+	if got, want := len(store.Events()), 0; got != want {
+		t.Errorf("len(store.Events()) = %d; want %d", got, want)
+	}
+}
+
+func TestApplication_Send_acceptsEventsWithoutStreamFromReceiversWithoutId(t *testing.T) {
+	store := NewEventsInMemory()
+	app := NewTestApp().WithStore(store)
+	cmd := TestCommand.NewCommand()
+	receiver := newTestAggregate("")
+	cmd.receiver = receiver
+	receiver.onCommand = func(agg *testAggregate) {
+		agg.events.PublishEvent(NewEvent("test.announced"))
+	}
+
+	if err := app.Send(cmd).Error(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(store.Events()), 1; got != want {
+		t.Errorf("len(store.Events()) = %d; want %d", got, want)
+	}
+}
+
+func TestApplication_Send_rejectsEventsWithoutStreamFromAggregates(t *testing.T) {
+	store := NewEventsInMemory()
+	app := NewTestApp().WithStore(store)
+	cmd := TestCommand.NewCommand()
+	receiver := newTestAggregate("test")
+	cmd.receiver = receiver
+	receiver.onCommand = func(agg *testAggregate) {
+		agg.events.PublishEvent(NewEvent("test.announced"))
+	}
+
+	if err := app.Send(cmd).Error(); err != ErrMisroutedEvent {
+		t.Errorf("app.Send(cmd).Error() = %v; want %v", err, ErrMisroutedEvent)
+	}
+
+	if got, want := len(store.Events()), 0; got != want {
+		t.Errorf("len(store.Events()) = %d; want %d", got, want)
+	}
+}
+
+func TestApplication_Send_storesEventsForOtherStreamsIfAllowed(t *testing.T) {
+	store := NewEventsInMemory()
+	app := NewTestApp().WithStore(store).WithCrossAggregateEvents()
+	cmd := TestCommand.NewCommand()
+	receiver := newTestAggregate("test")
+	cmd.receiver = receiver
+	receiver.onCommand = func(agg *testAggregate) {
+		agg.events.PublishEvent(NewEvent("test.run").For(newTestAggregate("other")))
+	}
+
+	if err := app.Send(cmd).Error(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(store.Events()), 1; got != want {
+		t.Errorf("len(store.Events()) = %d; want %d", got, want)
+	}
+}
+
+func TestApplication_Send_returnsStoredEventsInResult(t *testing.T) {
+	store := NewEventsInMemory()
+	app := NewTestApp().WithStore(store)
+	cmd := TestCommand.NewCommand()
+	receiver := newTestAggregate("test")
+	cmd.receiver = receiver
+	receiver.onCommand = func(agg *testAggregate) {
+		agg.events.PublishEvent(NewEvent("test.run").For(agg).Add("param", "value"))
+	}
+
+	result := app.Send(cmd)
+	if err := result.Error(); err != nil {
+		t.Fatal(err)
+	}
+
+	events := result.Events()
+	if got, want := len(events), len(store.Events()); got != want {
+		t.Fatalf("len(events) = %d; want %d", got, want)
+	}
+
+	if got, want := events[0], store.Events()[0]; !reflect.DeepEqual(got, want) {
+		t.Errorf("events[0] = %#v; want %#v", got, want)
+	}
+
+	events[0].Payload["param"] = "changed"
+	if got, want := store.Events()[0].Payload["param"], "value"; got != want {
+		t.Errorf(`store.Events()[0].Payload["param"] = %v; want %v`, got, want)
+	}
+}
+
+type testQuery struct{ param string }
+
+type otherQuery struct{ param string }
+
+func TestApplication_Ask_passesQueryToRegisteredHandler(t *testing.T) {
+	app := NewTestApp().
+		WithQueryHandler(&testQuery{}, QueryHandlerFunc(func(query Query) (interface{}, error) {
+			return "answer to " + query.(*testQuery).param, nil
+		})).
+		WithQueryHandler(&otherQuery{}, QueryHandlerFunc(func(query Query) (interface{}, error) {
+			return "other answer", nil
+		}))
+
+	answer, err := app.Ask(&testQuery{param: "question"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := answer, "answer to question"; got != want {
+		t.Errorf("answer = %v; want %v", got, want)
+	}
+}
+
+func TestApplication_Ask_returnsErrorForUnknownQuery(t *testing.T) {
+	app := NewTestApp()
+
+	if _, err := app.Ask(&testQuery{}); err != ErrUnknownQuery {
+		t.Errorf("app.Ask(&testQuery{}) = %v; want %v", err, ErrUnknownQuery)
+	}
+
+	app.WithQueryHandler(testQuery{}, QueryHandlerFunc(func(Query) (interface{}, error) {
+		return nil, nil
+	}))
+	if _, err := app.Ask(&testQuery{}); err != ErrUnknownQuery {
+		t.Errorf("app.Ask(&testQuery{}) = %v; want %v", err, ErrUnknownQuery)
+	}
+}
+
+func TestApplication_Send_preservesOrderOfEmittedEvents(t *testing.T) {
+	store := NewEventsInMemory()
+	projected := []string{}
+	app := NewTestApp().
+		WithStore(store).
+		WithProjection("test", EventHandlerFunc(func(event *Event) {
+			projected = append(projected, event.Name)
+		}))
+	cmd := TestCommand.NewCommand()
+	receiver := newTestAggregate("test")
+	cmd.receiver = receiver
+	receiver.onCommand = func(agg *testAggregate) {
+		agg.events.PublishEvent(NewEvent("test.first").For(agg))
+		agg.events.PublishEvent(NewEvent("test.second").For(agg))
+		agg.events.PublishEvent(NewEvent("test.third").For(agg))
+	}
+
+	if err := app.Send(cmd).Error(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"test.first", "test.second", "test.third"}
+	stored := []string{}
+	for _, event := range store.Events() {
+		stored = append(stored, event.Name)
+	}
+
+	if got := stored; !reflect.DeepEqual(got, want) {
+		t.Errorf("stored = %q; want %q", got, want)
+	}
+
+	if got := projected; !reflect.DeepEqual(got, want) {
+		t.Errorf("projected = %q; want %q", got, want)
+	}
+}
+
+func TestApplication_Projections_returnsStatusOfRegisteredProjections(t *testing.T) {
+	app := NewTestApp().
+		WithProjection("b", EventHandlerFunc(func(*Event) {})).
+		WithProjection("a", EventHandlerFunc(func(*Event) {}))
+	event := NewEvent("test.run")
+	event.Id = "event"
+	app.Project(event)
+
+	statuses := app.Projections()
+	if got, want := len(statuses), 2; got != want {
+		t.Fatalf("len(statuses) = %d; want %d", got, want)
+	}
+
+	if got, want := statuses[0], (ProjectionStatus{Name: "a", Processed: 1, LastEventId: "event"}); got != want {
+		t.Errorf("statuses[0] = %#v; want %#v", got, want)
+	}
+	if got, want := statuses[1], (ProjectionStatus{Name: "b", Processed: 1, LastEventId: "event"}); got != want {
+		t.Errorf("statuses[1] = %#v; want %#v", got, want)
+	}
+}
+
+func TestApplication_Projections_reportsAsyncProjections(t *testing.T) {
+	delivered := make(chan bool, 1)
+	app := NewTestApp().
+		WithProjection("sync", EventHandlerFunc(func(*Event) {})).
+		WithAsyncProjection("async", EventHandlerFunc(func(*Event) { delivered <- true }))
+	event := NewEvent("test.run")
+	event.Id = "event"
+	app.Project(event)
+	<-delivered
+
+	if got, want := app.Projections()[1], (ProjectionStatus{Name: "sync", Async: false, Processed: 1, LastEventId: "event"}); got != want {
+		t.Errorf("app.Projections()[1] = %#v; want %#v", got, want)
+	}
+
+	for i := 0; i < 100 && app.Projections()[0].Processed == 0; i++ {
+		time.Sleep(time.Millisecond)
+	}
+
+	if got, want := app.Projections()[0], (ProjectionStatus{Name: "async", Async: true, Processed: 1, LastEventId: "event"}); got != want {
+		t.Errorf("app.Projections()[0] = %#v; want %#v", got, want)
+	}
+}
+
+func TestApplication_Close_drainsAsyncProjections(t *testing.T) {
+	handled := []string{}
+	app := NewTestApp().
+		WithAsyncProjection("slow", EventHandlerFunc(func(event *Event) {
+			time.Sleep(time.Millisecond)
+			handled = append(handled, event.Id)
+		}))
+	for i := 0; i < 10; i++ {
+		event := NewEvent("test.run")
+		event.Id = fmt.Sprintf("event-%d", i)
+		app.Project(event)
+	}
+
+	if err := app.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Close(); err != nil {
+		t.Fatalf("second Close: %s", err)
+	}
+
+	if got, want := len(handled), 10; got != want {
+		t.Fatalf("len(handled) = %d; want %d", got, want)
+	}
+	if got, want := handled[9], "event-9"; got != want {
+		t.Errorf("handled[9] = %q; want %q", got, want)
+	}
+}
+
+func TestApplication_Close_dropsEventsProjectedAfterwards(t *testing.T) {
+	handled := 0
+	app := NewTestApp().
+		WithAsyncProjection("async", EventHandlerFunc(func(*Event) { handled++ }))
+	if err := app.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	app.Project(NewEvent("test.run"))
+
+	if got, want := handled, 0; got != want {
+		t.Errorf("handled = %d; want %d", got, want)
+	}
+}
+
+func TestApplication_ProjectionNames_listsRegisteredProjections(t *testing.T) {
+	app := NewTestApp().
+		WithProjection("b", EventHandlerFunc(func(*Event) {})).
+		WithProjection("a", EventHandlerFunc(func(*Event) {}))
+
+	if got, want := app.ProjectionNames(), []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("app.ProjectionNames() = %v; want %v", got, want)
+	}
+}
+
+func TestApplication_ProjectionStatus_returnsLastEventId(t *testing.T) {
+	app := NewTestApp().WithProjection("a", EventHandlerFunc(func(*Event) {}))
+	event := NewEvent("test.run")
+	event.Id = "event"
+	app.Project(event)
+
+	lastEventId, ok := app.ProjectionStatus("a")
+	if got, want := ok, true; got != want {
+		t.Fatalf(`app.ProjectionStatus("a"): ok = %v; want %v`, got, want)
+	}
+	if got, want := lastEventId, "event"; got != want {
+		t.Errorf(`app.ProjectionStatus("a"): lastEventId = %q; want %q`, got, want)
+	}
+
+	if _, ok := app.ProjectionStatus("unknown"); ok {
+		t.Errorf(`app.ProjectionStatus("unknown"): ok = %v; want %v`, ok, false)
+	}
+}
+
+func TestApplication_Seed_storesAndProjectsEventsOnce(t *testing.T) {
+	app := NewTestApp()
+	projected := []string{}
+	app.WithProjection("seeded", EventHandlerFunc(func(event *Event) {
+		projected = append(projected, event.Id)
+	}))
+
+	earlier := TheTime.Add(-time.Hour)
+	legacy := NewEvent("test.imported").For(newTestAggregate("legacy"))
+	legacy.Id = "legacy"
+	legacy.OccurredOn = earlier
+	events := []*Event{legacy, NewEvent("test.run").For(newTestAggregate("legacy"))}
+
+	if err := app.Seed(events); err != nil {
+		t.Fatal(err)
+	}
+
+	stored := []string{}
+	app.store.Replay("*", EventHandlerFunc(func(event *Event) {
+		stored = append(stored, event.Id)
+	}))
+
+	want := []string{"legacy", events[1].Id}
+	if got := stored; !reflect.DeepEqual(got, want) {
+		t.Errorf("stored = %v; want %v", got, want)
+	}
+	if got := projected; !reflect.DeepEqual(got, want) {
+		t.Errorf("projected = %v; want %v", got, want)
+	}
+
+	if got, want := events[0].OccurredOn, earlier; !got.Equal(want) {
+		t.Errorf("events[0].OccurredOn = %v; want %v", got, want)
+	}
+	if got, want := events[1].OccurredOn, TheTime; !got.Equal(want) {
+		t.Errorf("events[1].OccurredOn = %v; want %v", got, want)
+	}
+}
+
+func TestApplication_Exists_reportsWhetherStreamHasEvents(t *testing.T) {
+	events := NewEventsInMemory()
+	events.Store([]*Event{NewEvent("test.run").For(newTestAggregate("existing"))})
+
+	for name, store := range map[string]EventStore{
+		"iterable": events,
+		"replay":   struct{ EventStore }{events},
+	} {
+		app := NewTestApp().WithStore(store)
+
+		if got, err := app.Exists("existing"); err != nil || !got {
+			t.Errorf(`[%s] app.Exists("existing") = %v, %v; want true, nil`, name, got, err)
+		}
+		if got, err := app.Exists("missing"); err != nil || got {
+			t.Errorf(`[%s] app.Exists("missing") = %v, %v; want false, nil`, name, got, err)
+		}
+	}
+}
+
+func TestApplication_DeleteStream_removesEventsAndProjectsTombstone(t *testing.T) {
+	app := NewTestApp()
+	app.store.Store([]*Event{
+		NewEvent("test.run").For(newTestAggregate("test")),
+		NewEvent("test.run").For(newTestAggregate("other")),
+	})
+	deleted := []*Event{}
+	app.WithProjection("deleted", EventHandlerFunc(func(event *Event) {
+		if event.Name == "stream.deleted" {
+			deleted = append(deleted, event)
+		}
+	}))
+
+	if err := app.DeleteStream("test"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := app.Load(TestCommand, "test"); err != ErrAggregateNotFound {
+		t.Errorf("app.Load(TestCommand, %q) = %v; want %v", "test", err, ErrAggregateNotFound)
+	}
+
+	if got, want := len(deleted), 1; got != want {
+		t.Fatalf("len(deleted) = %d; want %d", got, want)
+	}
+
+	if got, want := deleted[0].Payload["stream_id"], "test"; got != want {
+		t.Errorf(`deleted[0].Payload["stream_id"] = %v; want %v`, got, want)
+	}
+
+	if got, want := deleted[0].StreamId, TombstoneStream; got != want {
+		t.Errorf(`deleted[0].StreamId = %v; want %v`, got, want)
+	}
+}
+
+func TestApplication_DeleteStream_failsIfStoreCannotDeleteStreams(t *testing.T) {
+	store := NewEventsInMemory()
+	app := NewTestApp().WithStore(struct{ EventStore }{store})
+	store.Store([]*Event{NewEvent("test.run").For(newTestAggregate("test"))})
+
+	if err := app.DeleteStream("test"); err != ErrStreamDeletionNotSupported {
+		t.Errorf("app.DeleteStream(%q) = %v; want %v", "test", err, ErrStreamDeletionNotSupported)
+	}
+
+	if found, _ := app.Exists("test"); !found {
+		t.Errorf("app.Exists(%q) = false; want true", "test")
+	}
+}
+
+func TestApplication_RegisterEventSchema_acceptsMatchingEvents(t *testing.T) {
+	app := NewTestApp().RegisterEventSchema("test.run", "param")
+	cmd := TestCommand.NewCommand()
+	receiver := newTestAggregate("test")
+	cmd.receiver = receiver
+	receiver.onCommand = func(agg *testAggregate) {
+		agg.events.PublishEvent(NewEvent("test.run").For(agg).Add("param", "value"))
+	}
+
+	if err := app.Send(cmd).Error(); err != nil {
+		t.Errorf("app.Send(cmd).Error() = %v; want %v", err, nil)
+	}
+}
+
+func TestApplication_RegisterEventSchema_rejectsInvalidEvents(t *testing.T) {
+	app := NewTestApp().RegisterEventSchema("test.run", "param", "other")
+	cmd := TestCommand.NewCommand()
+	receiver := newTestAggregate("test")
+	cmd.receiver = receiver
+	receiver.onCommand = func(agg *testAggregate) {
+		agg.events.PublishEvent(NewEvent("test.run").For(agg).Add("param", "value"))
+		agg.events.PublishEvent(NewEvent("test.typo").For(agg))
+	}
+
+	err, ok := app.Send(cmd).Error().(*ValidationError)
+	if !ok {
+		t.Fatalf("app.Send(cmd).Error() = %v; want a *ValidationError", err)
+	}
+
+	if got, want := err.Errors["test.run"], []string{"missing_payload_key"}; !reflect.DeepEqual(got, want) {
+		t.Errorf(`err.Errors["test.run"] = %v; want %v`, got, want)
+	}
+	if got, want := err.Details("test.run")[0].Args, []interface{}{"other"}; !reflect.DeepEqual(got, want) {
+		t.Errorf(`err.Details("test.run")[0].Args = %v; want %v`, got, want)
+	}
+	if got, want := err.Errors["test.typo"], []string{"unknown_event"}; !reflect.DeepEqual(got, want) {
+		t.Errorf(`err.Errors["test.typo"] = %v; want %v`, got, want)
+	}
+
+	seen := 0
+	app.store.Replay("*", EventHandlerFunc(func(*Event) { seen++ }))
+	if got, want := seen, 0; got != want {
+		t.Errorf("seen = %d; want %d", got, want)
+	}
+}
+
+type listingAggregate struct {
+	*testAggregate
+	known []string
+}
+
+func (self *listingAggregate) KnownCommands() []string { return self.known }
+
+func TestApplication_Send_acceptsCommandsWithoutEventsByDefault(t *testing.T) {
+	app := NewTestApp()
+	cmd := TestCommand.NewCommand()
+	cmd.receiver = newTestAggregate("test")
+
+	if err := app.Send(cmd).Error(); err != nil {
+		t.Errorf("app.Send(cmd).Error() = %v; want %v", err, nil)
+	}
+}
+
+func TestApplication_WithStrictCommands_rejectsCommandsWithoutEvents(t *testing.T) {
+	app := NewTestApp().WithStrictCommands()
+	cmd := TestCommand.NewCommand()
+	cmd.receiver = newTestAggregate("test")
+
+	if got, want := app.Send(cmd).Error(), ErrCommandNotHandled; got != want {
+		t.Errorf("app.Send(cmd).Error() = %v; want %v", got, want)
+	}
+}
+
+func TestApplication_Send_rejectsCommandsNotListedByAggregate(t *testing.T) {
+	app := NewTestApp()
+	unknown := TestCommand.NewCommand()
+	unknown.receiver = &listingAggregate{newTestAggregate("test"), []string{"other"}}
+
+	if got, want := app.Send(unknown).Error(), ErrCommandNotHandled; got != want {
+		t.Errorf("app.Send(unknown).Error() = %v; want %v", got, want)
+	}
+
+	known := TestCommand.NewCommand()
+	known.receiver = &listingAggregate{newTestAggregate("test"), []string{"test"}}
+
+	if err := app.Send(known).Error(); err != nil {
+		t.Errorf("app.Send(known).Error() = %v; want %v", err, nil)
+	}
+}
+
+// replayCountingStore counts the number of times events are replayed.
+type replayCountingStore struct {
+	*EventsInMemory
+	replays int
+}
+
+func (self *replayCountingStore) Replay(streamId string, receiver EventHandler) error {
+	self.replays++
+	return self.EventsInMemory.Replay(streamId, receiver)
+}
+
+func TestApplication_WithAggregateCache_skipsReplayForCachedAggregates(t *testing.T) {
+	store := &replayCountingStore{EventsInMemory: NewEventsInMemory()}
+	app := NewTestApp().WithStore(store).WithAggregateCache(10)
+	seen := 0
+	definition := NewCommandDefinition("test").Target(func(command *Command) Aggregate {
+		aggregate := newTestAggregate(command.Get("id").String())
+		aggregate.onEvent = func(*Event) { seen++ }
+		aggregate.onCommand = func(agg *testAggregate) {
+			agg.events.PublishEvent(NewEvent("test.run").For(agg))
+		}
+		return aggregate
+	})
+
+	for i := 0; i < 3; i++ {
+		if err := app.Send(definition.NewCommand().Set("id", "test")).Error(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got, want := store.replays, 1; got != want {
+		t.Errorf("store.replays = %d; want %d", got, want)
+	}
+
+	if got, want := seen, 3; got != want {
+		t.Errorf("seen = %d; want %d", got, want)
+	}
+}
+
+func TestApplication_WithAggregateCache_evictsLeastRecentlyUsedAggregates(t *testing.T) {
+	store := &replayCountingStore{EventsInMemory: NewEventsInMemory()}
+	app := NewTestApp().WithStore(store).WithAggregateCache(1)
+
+	for _, id := range []string{"a", "b", "a"} {
+		if err := app.Send(TestCommand.NewCommand().Set("id", id)).Error(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got, want := store.replays, 3; got != want {
+		t.Errorf("store.replays = %d; want %d", got, want)
+	}
+}
+
+func TestApplication_WithAggregateCache_removesAggregatesOnError(t *testing.T) {
+	app := NewTestApp().WithAggregateCache(10)
+
+	if err := app.Send(TestCommand.NewCommand().Set("id", "test")).Error(); err != nil {
+		t.Fatal(err)
+	}
+	cached, version, found := app.cache.Take(newTestAggregate("test"))
+	if !found {
+		t.Fatalf("aggregate %q is not cached", "test")
+	}
+
+	cached.(*testAggregate).FailWith(ErrNotAllowed)
+	app.cache.Put(cached, version)
+	if got, want := app.Send(TestCommand.NewCommand().Set("id", "test")).Error(), ErrNotAllowed; got != want {
+		t.Errorf("app.Send(command).Error() = %v; want %v", got, want)
+	}
+
+	if _, _, found := app.cache.Take(newTestAggregate("test")); found {
+		t.Errorf("aggregate %q is still cached", "test")
+	}
+}
+
+func TestApplication_WithAggregateCache_keepsAggregatesOfDifferentTypesApart(t *testing.T) {
+	app := NewTestApp().WithAggregateCache(10)
+	if err := app.Send(TestCommand.NewCommand().Set("id", "test")).Error(); err != nil {
+		t.Fatal(err)
+	}
+
+	definition := NewCommandDefinition("other").Target(func(command *Command) Aggregate {
+		return &listingAggregate{newTestAggregate(command.Get("id").String()), []string{"other"}}
+	})
+	command := definition.NewCommand().Set("id", "test")
+	if err := app.Send(command).Error(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := command.receiver.(*listingAggregate); !ok {
+		t.Errorf("command.receiver = %T; want %T", command.receiver, &listingAggregate{})
+	}
+}
+
+func TestApplication_WithAggregateCache_takesAggregatesOutWhileProcessingCommands(t *testing.T) {
+	app := NewTestApp().WithAggregateCache(10)
+	if err := app.Send(TestCommand.NewCommand().Set("id", "test")).Error(); err != nil {
+		t.Fatal(err)
+	}
+
+	command := TestCommand.NewCommand().Set("id", "test")
+	if _, _, cached := app.cachedReceiver(command); !cached {
+		t.Fatalf("aggregate %q is not cached", "test")
+	}
+
+	if _, _, cached := app.cachedReceiver(TestCommand.NewCommand().Set("id", "test")); cached {
+		t.Errorf("aggregate %q is shared between commands", "test")
+	}
+}
+
+func TestAggregateCache_Lock_serialisesCommandsPerAggregate(t *testing.T) {
+	cache := newAggregateCache(10)
+	unlock := cache.Lock("test")
+	cache.Lock("other")()
+
+	locked := make(chan bool)
+	go func() {
+		cache.Lock("test")()
+		close(locked)
+	}()
+
+	select {
+	case <-locked:
+		t.Fatalf("aggregate %q locked twice", "test")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	unlock()
+	<-locked
+	if got, want := len(cache.locks), 0; got != want {
+		t.Errorf("len(cache.locks) = %d; want %d", got, want)
+	}
+}
+
+func TestApplication_WithProjectionTimeout_skipsHungProjections(t *testing.T) {
+	release := make(chan bool)
+	defer close(release)
+	handled := 0
+	app := NewTestApp().
+		WithProjectionTimeout(10*time.Millisecond).
+		WithProjection("hung", EventHandlerFunc(func(*Event) { <-release })).
+		WithProjection("fast", EventHandlerFunc(func(*Event) { handled++ }))
+
+	started := time.Now()
+	app.Project(NewEvent("test.run"))
+	app.Project(NewEvent("test.run"))
+
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("projecting took %s", elapsed)
+	}
+
+	if got, want := handled, 2; got != want {
+		t.Errorf("handled = %d; want %d", got, want)
+	}
+
+	status := app.projections["hung"].Status()
+	if got, want := status.Processed, 0; got != want {
+		t.Errorf("status.Processed = %d; want %d", got, want)
+	}
+
+	warnings := 0
+	for _, line := range CurrentLines {
+		if strings.Contains(line, "WARN projection_") {
+			warnings++
+		}
+	}
+	if got, want := warnings, 2; got != want {
+		t.Errorf("warnings = %d; want %d", got, want)
+	}
+}
+
+func TestApplication_WithProjectionTimeout_passesSkippedEventsOnceRecovered(t *testing.T) {
+	release := make(chan bool)
+	seen := []string{}
+	app := NewTestApp().
+		WithProjectionTimeout(10*time.Millisecond).
+		WithProjection("slow", EventHandlerFunc(func(event *Event) {
+			if event.Name == "test.hang" {
+				<-release
+			}
+			seen = append(seen, event.Name)
+		}))
+	projection := app.projections["slow"]
+	projection.cooldown = 0
+
+	app.Project(NewEvent("test.hang"))
+	app.Project(NewEvent("test.skipped"))
+	if got, want := projection.Status().Processed, 0; got != want {
+		t.Errorf("Processed while running = %d; want %d", got, want)
+	}
+
+	release <- true
+	for projection.Status().Processed == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	app.Project(NewEvent("test.run"))
+
+	if got, want := seen, []string{"test.hang", "test.skipped", "test.run"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("seen = %v; want %v", got, want)
+	}
+}
+
+func TestApplication_WithProjectionTimeout_dropsEventsBeyondPendingLimit(t *testing.T) {
+	release := make(chan bool)
+	seen := []string{}
+	app := NewTestApp().
+		WithProjectionTimeout(10*time.Millisecond).
+		WithProjection("slow", EventHandlerFunc(func(event *Event) {
+			if event.Name == "test.hang" {
+				<-release
+			}
+			seen = append(seen, event.Name)
+		}))
+	projection := app.projections["slow"]
+	projection.cooldown = 0
+	projection.pendingLimit = 1
+
+	app.Project(NewEvent("test.hang"))
+	app.Project(NewEvent("test.skipped"))
+	app.Project(NewEvent("test.dropped"))
+
+	release <- true
+	for projection.Status().Processed == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	app.Project(NewEvent("test.run"))
+
+	if got, want := seen, []string{"test.hang", "test.skipped", "test.run"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("seen = %v; want %v", got, want)
+	}
+
+	dropped := false
+	for _, line := range CurrentLines {
+		if strings.Contains(line, "WARN projection_overflow: test.dropped") {
+			dropped = true
+		}
+	}
+	if !dropped {
+		t.Errorf("dropped event not logged in %q", CurrentLines)
+	}
+}
+
+func TestApplication_WithProjectionTimeout_doesNotApplyToInit(t *testing.T) {
+	store := NewEventsInMemory()
+	store.Store([]*Event{NewEvent("test.run"), NewEvent("test.run")})
+	app := NewTestApp().
+		WithStore(store).
+		WithProjectionTimeout(time.Millisecond).
+		WithProjection("slow", EventHandlerFunc(func(*Event) { time.Sleep(5 * time.Millisecond) }))
+
+	if err := app.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := app.projections["slow"].Status().Processed, 2; got != want {
+		t.Errorf("Processed = %d; want %d", got, want)
+	}
+}
+
+// conflictingStore fails storing events with ErrConcurrencyConflict
+// a configurable number of times.
+type conflictingStore struct {
+	*EventsInMemory
+	conflicts int
+}
+
+func (self *conflictingStore) Store(events []*Event) error {
+	if self.conflicts > 0 {
+		self.conflicts--
+		return ErrConcurrencyConflict
+	}
+	return self.EventsInMemory.Store(events)
+}
+
+// newPublishingCommand returns a command whose receivers emit a
+// single event and counts the receivers created in receivers.
+func newPublishingCommand(receivers *int) *Command {
+	definition := NewCommandDefinition("test").
+		Field("param", TrimmedString()).
+		Target(func(command *Command) Aggregate {
+			*receivers++
+			aggregate := newTestAggregateFromCommand(command).(*testAggregate)
+			aggregate.onCommand = func(agg *testAggregate) {
+				agg.events.PublishEvent(NewEvent("test.run").For(agg))
+			}
+			return aggregate
+		})
+
+	return definition.NewCommand().Set("id", "test")
+}
+
+func TestApplication_SendWithRetry_retriesOnConflict(t *testing.T) {
+	store := &conflictingStore{EventsInMemory: NewEventsInMemory(), conflicts: 1}
+	app := NewTestApp().WithStore(store)
+	receivers := 0
+
+	if err := app.SendWithRetry(newPublishingCommand(&receivers), 3).Error(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := receivers, 2; got != want {
+		t.Errorf("receivers = %d; want %d", got, want)
+	}
+	if got, want := len(store.Events()), 1; got != want {
+		t.Errorf("len(store.Events()) = %d; want %d", got, want)
+	}
+}
+
+func TestApplication_SendWithRetry_givesUpAfterMaxAttempts(t *testing.T) {
+	store := &conflictingStore{EventsInMemory: NewEventsInMemory(), conflicts: 5}
+	app := NewTestApp().WithStore(store)
+	receivers := 0
+
+	result := app.SendWithRetry(newPublishingCommand(&receivers), 2)
+
+	if got, want := result.Error(), ErrConcurrencyConflict; got != want {
+		t.Errorf("result.Error() = %v; want %v", got, want)
+	}
+	if got, want := receivers, 2; got != want {
+		t.Errorf("receivers = %d; want %d", got, want)
+	}
+}
+
+func TestApplication_Use_runsMiddlewaresInOrder(t *testing.T) {
+	calls := []string{}
+	middleware := func(name string) CommandMiddleware {
+		return func(next func(*Command) *CommandResult) func(*Command) *CommandResult {
+			return func(command *Command) *CommandResult {
+				calls = append(calls, "before "+name)
+				result := next(command)
+				calls = append(calls, "after "+name)
+				return result
+			}
+		}
+	}
+	app := NewTestApp().Use(middleware("a")).Use(middleware("b"))
+
+	if err := app.Send(TestCommand.NewCommand().Set("id", "test")).Error(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := calls, []string{"before a", "before b", "after b", "after a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("calls = %v; want %v", got, want)
+	}
+}
+
+func TestApplication_Use_allowsMiddlewaresToRejectCommands(t *testing.T) {
+	store := &replayCountingStore{EventsInMemory: NewEventsInMemory()}
+	unauthorized := errors.New("unauthorized")
+	app := NewTestApp().WithStore(store).Use(func(next func(*Command) *CommandResult) func(*Command) *CommandResult {
+		return func(command *Command) *CommandResult {
+			return NewErrorResult(unauthorized)
+		}
+	})
+
+	result := app.Send(TestCommand.NewCommand().Set("id", "test"))
+
+	if got, want := result.Error(), unauthorized; got != want {
+		t.Errorf("result.Error() = %v; want %v", got, want)
+	}
+	if got, want := store.replays, 0; got != want {
+		t.Errorf("store.replays = %d; want %d", got, want)
+	}
+}
+
+func TestApplication_WithAuthorizer_permitsAndDeniesCommands(t *testing.T) {
+	store := &replayCountingStore{EventsInMemory: NewEventsInMemory()}
+	forbidden := errors.New("forbidden")
+	app := NewTestApp().WithStore(store).WithAuthorizer(AuthorizerFunc(func(command *Command) error {
+		if command.Get("param").String() != "admin" {
+			return forbidden
+		}
+		return nil
+	}))
+
+	denied := app.Send(TestCommand.NewCommand().Set("id", "test").Set("param", "guest"))
+	if got, want := denied.Error(), forbidden; got != want {
+		t.Errorf("denied.Error() = %v; want %v", got, want)
+	}
+	if got, want := store.replays, 0; got != want {
+		t.Errorf("store.replays = %d; want %d", got, want)
+	}
+
+	permitted := app.Send(TestCommand.NewCommand().Set("id", "test").Set("param", "admin"))
+	if err := permitted.Error(); err != nil {
+		t.Errorf("permitted.Error() = %v; want nil", err)
+	}
+}
+
+func TestApplication_Send_routesCompositeIdsToStream(t *testing.T) {
+	definition := NewCommandDefinition("rename-project").
+		Field("tenant", Id()).
+		Field("project", Id()).
+		CompositeId("tenant", "project").
+		Target(func(command *Command) Aggregate {
+			aggregate := newTestAggregate(command.AggregateId())
+			aggregate.onCommand = func(self *testAggregate) {
+				self.events.PublishEvent(NewEvent("project.renamed").For(self))
+			}
+			return aggregate
+		})
+	app := NewTestApp()
+
+	result := app.Send(definition.NewCommand().Set("tenant", "acme").Set("project", "site"))
+	if err := result.Error(); err != nil {
+		t.Fatal(err)
+	}
+	app.Send(definition.NewCommand().Set("tenant", "acme").Set("project", "blog"))
+
+	streams := []string{}
+	app.Replay("acme/site", EventHandlerFunc(func(event *Event) {
+		streams = append(streams, event.StreamId)
+	}))
+	if got, want := streams, []string{"acme/site"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("streams = %v; want %v", got, want)
+	}
+
+	if _, err := app.Load(definition, "acme/blog"); err != nil {
+		t.Errorf("app.Load(definition, %q): %s", "acme/blog", err)
+	}
+	if _, err := app.Load(definition, "acme/blog/extra"); err != ErrAggregateNotFound {
+		t.Errorf("app.Load(definition, %q) = %v; want %v", "acme/blog/extra", err, ErrAggregateNotFound)
+	}
+}
+
+// checkpointedProjection counts the events it handles and reports the
+// last one as its checkpoint.
+type checkpointedProjection struct {
+	handled    int
+	checkpoint string
+}
+
+func (self *checkpointedProjection) HandleEvent(event *Event) {
+	self.handled++
+	self.checkpoint = event.Id
+}
+
+func (self *checkpointedProjection) Checkpoint() string { return self.checkpoint }
+
+func TestApplication_WithCheckpoints_skipsHandledEventsOnInit(t *testing.T) {
+	store := NewEventsInMemory()
+	store.Store([]*Event{newTestEventWithId("1"), newTestEventWithId("2")})
+	checkpoints := NewCheckpointsInMemory()
+
+	first := &checkpointedProjection{}
+	app := NewTestApp().WithStore(store).WithCheckpoints(checkpoints).WithProjection("counter", first)
+	if err := app.Init(); err != nil {
+		t.Fatal(err)
+	}
+	app.Project(newTestEventWithId("3"))
+	store.Store([]*Event{newTestEventWithId("3")})
+	if err := app.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	second := &checkpointedProjection{checkpoint: "3"}
+	app = NewTestApp().WithStore(store).WithCheckpoints(checkpoints).WithProjection("counter", second)
+	if err := app.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := first.handled, 3; got != want {
+		t.Errorf("first.handled = %d; want %d", got, want)
+	}
+	if got, want := second.handled, 0; got != want {
+		t.Errorf("second.handled = %d; want %d", got, want)
+	}
+}
+
+func TestApplication_WithCheckpoints_replaysEventsAfterCheckpoint(t *testing.T) {
+	store := NewEventsInMemory()
+	store.Store([]*Event{newTestEventWithId("1"), newTestEventWithId("2"), newTestEventWithId("3")})
+	checkpoints := NewCheckpointsInMemory()
+	checkpoints.SaveCheckpoint("counter", "2")
+
+	projection := &checkpointedProjection{}
+	app := NewTestApp().WithStore(store).WithCheckpoints(checkpoints).WithProjection("counter", projection)
+	if err := app.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := projection.handled, 1; got != want {
+		t.Errorf("projection.handled = %d; want %d", got, want)
+	}
+	if got, want := projection.checkpoint, "3"; got != want {
+		t.Errorf("projection.checkpoint = %q; want %q", got, want)
+	}
+}
+
+func TestApplication_WithCheckpoints_replaysFullHistoryIfCheckpointIsMissing(t *testing.T) {
+	store := NewEventsInMemory()
+	store.Store([]*Event{newTestEventWithId("1"), newTestEventWithId("2")})
+	checkpoints := NewCheckpointsInMemory()
+	checkpoints.SaveCheckpoint("counter", "deleted")
+
+	projection := &checkpointedProjection{}
+	app := NewTestApp().WithStore(store).WithCheckpoints(checkpoints).WithProjection("counter", projection)
+	if err := app.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := projection.handled, 2; got != want {
+		t.Errorf("projection.handled = %d; want %d", got, want)
+	}
+
+	warnings := 0
+	for _, line := range CurrentLines {
+		if strings.Contains(line, "WARN checkpoint deleted of counter not found") {
+			warnings++
+		}
+	}
+	if got, want := warnings, 1; got != want {
+		t.Errorf("warnings = %d; want %d", got, want)
+	}
+}
+
+func TestApplication_WithCheckpoints_replaysOnlyEventsSinceCheckpointsOnInit(t *testing.T) {
+	store := NewEventsInMemory()
+	store.Store([]*Event{newTestEventWithId("1"), newTestEventWithId("2"), newTestEventWithId("3")})
+	checkpoints := NewCheckpointsInMemory()
+
+	app := NewTestApp().WithStore(store).WithCheckpoints(checkpoints).WithProjection("counter", &checkpointedProjection{})
+	if err := app.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Close(); err != nil {
+		t.Fatal(err)
+	}
+	store.Store([]*Event{newTestEventWithId("4")})
+
+	replayed := 0
+	projection := &checkpointedProjection{checkpoint: "3"}
+	app = NewTestApp().WithStore(store).WithCheckpoints(checkpoints).WithProjection("counter", projection).
+		WithInitProgress(0, func(count int) { replayed = count })
+	if err := app.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := replayed, 2; got != want {
+		t.Errorf("replayed = %d; want %d", got, want)
+	}
+	if got, want := projection.handled, 1; got != want {
+		t.Errorf("projection.handled = %d; want %d", got, want)
+	}
+	if got, _ := checkpoints.LoadCheckpoint(ReplayCheckpoint); got != "4" {
+		t.Errorf("checkpoints.LoadCheckpoint(%q) = %q; want %q", ReplayCheckpoint, got, "4")
+	}
+}
+
+func TestApplication_WithCheckpoints_replaysFullHistoryIfCheckpointIsBeforeReplayCheckpoint(t *testing.T) {
+	store := NewEventsInMemory()
+	store.Store([]*Event{newTestEventWithId("1"), newTestEventWithId("2"), newTestEventWithId("3")})
+	checkpoints := NewCheckpointsInMemory()
+	checkpoints.SaveCheckpoint("counter", "1")
+	checkpoints.SaveCheckpoint(ReplayCheckpoint, "3")
+
+	projection := &checkpointedProjection{}
+	app := NewTestApp().WithStore(store).WithCheckpoints(checkpoints).WithProjection("counter", projection)
+	if err := app.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := projection.handled, 2; got != want {
+		t.Errorf("projection.handled = %d; want %d", got, want)
+	}
+}
+
+func TestApplication_WithCheckpoints_recordsCheckpointsWhileProjecting(t *testing.T) {
+	checkpoints := NewCheckpointsInMemory()
+	app := NewTestApp().WithCheckpoints(checkpoints).WithProjection("counter", &checkpointedProjection{})
+	if err := app.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= CheckpointInterval; i++ {
+		app.Project(newTestEventWithId(fmt.Sprintf("%d", i)))
+	}
+
+	want := fmt.Sprintf("%d", CheckpointInterval)
+	if got, _ := checkpoints.LoadCheckpoint("counter"); got != want {
+		t.Errorf("checkpoints.LoadCheckpoint(%q) = %q; want %q", "counter", got, want)
+	}
+}
+
+func TestApplication_Send_returnsAggregateVersion(t *testing.T) {
+	store := NewEventsInMemory()
+	store.Store([]*Event{
+		NewEvent("test.run").For(newTestAggregate("test")),
+		NewEvent("test.run").For(newTestAggregate("other")),
+	})
+	app := NewTestApp().WithStore(store)
+	receivers := 0
+
+	result := app.Send(newPublishingCommand(&receivers))
+	if err := result.Error(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := result.Version(), 2; got != want {
+		t.Errorf("result.Version() = %d; want %d", got, want)
+	}
+
+	result = app.Send(newPublishingCommand(&receivers))
+	if got, want := result.Version(), 3; got != want {
+		t.Errorf("result.Version() = %d; want %d", got, want)
+	}
+}
+
+// countingAggregate is a snapshottable aggregate counting the events
+// it has handled.
+type countingAggregate struct {
+	*testAggregate
+	count    int
+	replayed int
+}
+
+func (self *countingAggregate) HandleEvent(event *Event) {
+	self.count++
+	self.replayed++
+}
+
+func (self *countingAggregate) PublishWith(publisher EventPublisher) Aggregate {
+	self.testAggregate.PublishWith(publisher)
+	return self
+}
+
+func (self *countingAggregate) MarshalSnapshot() ([]byte, error) {
+	return json.Marshal(self.count)
+}
+
+func (self *countingAggregate) UnmarshalSnapshot(data []byte) error {
+	return json.Unmarshal(data, &self.count)
+}
+
+func TestApplication_WithSnapshots_replaysOnlyEventsAfterSnapshot(t *testing.T) {
+	snapshots := NewSnapshotsInMemory()
+	app := NewTestApp().WithSnapshots(snapshots, 2)
+	var last *countingAggregate
+	definition := NewCommandDefinition("test").Target(func(command *Command) Aggregate {
+		last = &countingAggregate{testAggregate: newTestAggregate(command.Get("id").String())}
+		last.onCommand = func(agg *testAggregate) {
+			agg.events.PublishEvent(NewEvent("test.run").For(agg))
+		}
+		return last
+	})
+
+	for i := 0; i < 5; i++ {
+		if err := app.Send(definition.NewCommand().Set("id", "test")).Error(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got, want := last.count, 4; got != want {
+		t.Errorf("last.count = %d; want %d", got, want)
+	}
+	if got, want := last.replayed, 2; got != want {
+		t.Errorf("last.replayed = %d; want %d", got, want)
+	}
+
+	versions := []int{}
+	app.Replay("test", EventHandlerFunc(func(event *Event) {
+		versions = append(versions, event.StreamVersion)
+	}))
+	if got, want := versions, []int{0, 1, 2, 3, 4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("versions = %v; want %v", got, want)
+	}
+}
+
+func TestApplication_DeleteStream_removesSnapshots(t *testing.T) {
+	snapshots := NewSnapshotsInMemory()
+	app := NewTestApp().WithSnapshots(snapshots, 1)
+	aggregate := newTestAggregate("test")
+	if err := snapshots.SaveSnapshot(&Snapshot{AggregateType: aggregateType(aggregate), StreamId: "test", Version: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := app.DeleteStream("test"); err != nil {
+		t.Fatal(err)
+	}
+
+	if snapshot, _ := snapshots.LoadSnapshot(aggregateType(aggregate), "test"); snapshot != nil {
+		t.Errorf("snapshot = %v; want nil", snapshot)
+	}
+}
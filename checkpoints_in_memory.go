@@ -0,0 +1,36 @@
+package ess
+
+import "sync"
+
+// CheckpointsInMemory is an in-memory implementation of a
+// CheckpointStore.  Since checkpoints are lost when the process
+// exits, use it only for tests and demos.
+type CheckpointsInMemory struct {
+	mutex       sync.Mutex
+	checkpoints map[string]string
+}
+
+// NewCheckpointsInMemory creates a new instance of this checkpoint
+// store holding no checkpoints initially.
+func NewCheckpointsInMemory() *CheckpointsInMemory {
+	return &CheckpointsInMemory{
+		checkpoints: map[string]string{},
+	}
+}
+
+// LoadCheckpoint returns the checkpoint saved for name.  It never
+// returns an error.
+func (self *CheckpointsInMemory) LoadCheckpoint(name string) (string, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return self.checkpoints[name], nil
+}
+
+// SaveCheckpoint records eventId as the checkpoint for name.  It
+// never returns an error.
+func (self *CheckpointsInMemory) SaveCheckpoint(name string, eventId string) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.checkpoints[name] = eventId
+	return nil
+}
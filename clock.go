@@ -24,3 +24,33 @@ type StaticClock struct {
 func (self *StaticClock) Now() time.Time {
 	return self.Time
 }
+
+// AutoClock implements the Clock interface by returning a time that
+// advances by a fixed step on every call to Now, i.e. it is a
+// stepping clock.  Its intended use is in test cases, where events
+// need distinct, monotonically increasing timestamps without
+// sleeping.
+type AutoClock struct {
+	// Step is the duration by which the clock advances after
+	// every call to Now.
+	Step time.Duration
+
+	current time.Time
+}
+
+// NewAutoClock returns a clock starting at start and advancing by
+// step.
+func NewAutoClock(start time.Time, step time.Duration) *AutoClock {
+	return &AutoClock{
+		Step:    step,
+		current: start,
+	}
+}
+
+// Now returns the clock's current time and advances the clock by its
+// step.
+func (self *AutoClock) Now() time.Time {
+	now := self.current
+	self.current = self.current.Add(self.Step)
+	return now
+}
@@ -0,0 +1,34 @@
+package ess
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAutoClock_Now_advancesByStep(t *testing.T) {
+	clock := NewAutoClock(TheTime, time.Second)
+	events := []*Event{
+		NewEvent("test.run").Occur(clock),
+		NewEvent("test.run").Occur(clock),
+		NewEvent("test.run").Occur(clock),
+	}
+
+	for i, event := range events {
+		if got, want := event.OccurredOn, TheTime.Add(time.Duration(i)*time.Second); !got.Equal(want) {
+			t.Errorf(`events[%d].OccurredOn = %v; want %v`, i, got, want)
+		}
+	}
+}
+
+func TestAutoClock_Now_differsByStep(t *testing.T) {
+	clock := NewAutoClock(TheTime, time.Millisecond)
+
+	previous := clock.Now()
+	for i := 0; i < 3; i++ {
+		now := clock.Now()
+		if got, want := now.Sub(previous), time.Millisecond; got != want {
+			t.Errorf(`now.Sub(previous) = %v; want %v`, got, want)
+		}
+		previous = now
+	}
+}
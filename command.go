@@ -2,13 +2,35 @@ package ess
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"log"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 )
 
+// ErrWrongCommand is returned when decoding a command using the
+// definition of a different command.
+var ErrWrongCommand = errors.New("wrong_command")
+
+// SecretMask replaces the values of secret fields wherever a
+// command's field values are rendered.
+const SecretMask = "[secret]"
+
+// CompositeIdSeparator joins the values of the fields making up a
+// composite aggregate id, see CommandDefinition.CompositeId.
+const CompositeIdSeparator = "/"
+
 // CommandResult represents the result of the application handling a
 // command.
 type CommandResult struct {
 	aggregateId string
+	version     int
+	events      []*Event
 	err         error
 }
 
@@ -24,6 +46,79 @@ func (self *CommandResult) AggregateId() string {
 	return self.aggregateId
 }
 
+// Version returns the number of events in the stream of the
+// command's receiver after the command has been processed, i.e. the
+// number of events replayed onto the receiver plus the number of
+// events it emitted for its own stream.  Clients can use it for
+// detecting concurrent changes to the aggregate.
+//
+// Version is zero for failed commands.
+func (self *CommandResult) Version() int {
+	return self.version
+}
+
+// Events returns copies of the events emitted while processing the
+// command.
+func (self *CommandResult) Events() []*Event {
+	events := make([]*Event, len(self.events))
+	for i, event := range self.events {
+		events[i] = event.Copy()
+	}
+	return events
+}
+
+// commandResultJSON defines the JSON representation of a successful
+// command result.
+type commandResultJSON struct {
+	Status  string                   `json:"status"`
+	Id      string                   `json:"id"`
+	Version int                      `json:"version,omitempty"`
+	Events  []commandResultEventJSON `json:"events,omitempty"`
+}
+
+// commandResultEventJSON identifies an event emitted by a command in
+// the JSON representation of the command's result.
+type commandResultEventJSON struct {
+	Name string `json:"name"`
+	Id   string `json:"id"`
+}
+
+// MarshalJSON implements json.Marshaler, so that handlers can use
+// the result as the body of API responses.
+//
+// Successful results are encoded as an object with the key "status"
+// set to "ok", the key "id" set to the aggregate id and the keys
+// "version" and "events" if present.  Only the name and id of every
+// event are included, since payloads can hold data not meant for
+// clients, e.g. password hashes:
+//
+//	{"status":"ok","id":"admin","version":1,"events":[{"name":"user.signed-up","id":"..."}]}
+//
+// Validation errors are encoded using ValidationError.MarshalJSON,
+// all other errors as an object with the error message as "error":
+//
+//	{"error":"not_found"}
+func (self *CommandResult) MarshalJSON() ([]byte, error) {
+	if self.err != nil {
+		if invalid, ok := self.err.(*ValidationError); ok {
+			return json.Marshal(invalid)
+		}
+		return json.Marshal(map[string]string{"error": self.err.Error()})
+	}
+
+	events := []commandResultEventJSON{}
+	for _, event := range self.events {
+		events = append(events, commandResultEventJSON{Name: event.Name, Id: event.Id})
+	}
+
+	return json.Marshal(&commandResultJSON{
+		Status:  "ok",
+		Id:      self.aggregateId,
+		Version: self.version,
+		Events:  events,
+	})
+}
+
 // NewErrorResult wraps err in a CommandResult.
 func NewErrorResult(err error) *CommandResult {
 	return &CommandResult{
@@ -32,10 +127,11 @@ func NewErrorResult(err error) *CommandResult {
 }
 
 // NewSuccessResult returns a CommandResult that marks a success for
-// receiver.
-func NewSuccessResult(receiver Aggregate) *CommandResult {
+// receiver, which emitted events.
+func NewSuccessResult(receiver Aggregate, events ...*Event) *CommandResult {
 	return &CommandResult{
 		aggregateId: receiver.Id(),
+		events:      events,
 	}
 }
 
@@ -79,15 +175,35 @@ type CommandDefinition struct {
 	// IdField is the name of the parameter which identifies the
 	// command receiver, defaults to "id"
 	IdField string
+
+	// IdFields are the names of the parameters which together
+	// identify the command receiver, if the receiver is identified
+	// by a composite key.  See CompositeId.
+	IdFields []string
+
+	// Secret is the set of fields whose values must not be
+	// revealed, e.g. when logging commands or reporting errors.
+	Secret map[string]bool
+
+	// Defaults maps field names to the text used for the field if
+	// no value or an empty value is given.
+	Defaults map[string]string
+
+	// RequireExisting causes the application to reject commands
+	// targeted at aggregates which have not emitted any events
+	// yet with ErrAggregateNotFound.
+	RequireExisting bool
 }
 
 // NewCommandDefinition creates a new command definition using name as
 // the name for the command.
 func NewCommandDefinition(name string) *CommandDefinition {
 	return &CommandDefinition{
-		Name:    name,
-		Fields:  map[string]Value{},
-		IdField: "id",
+		Name:     name,
+		Fields:   map[string]Value{},
+		IdField:  "id",
+		Secret:   map[string]bool{},
+		Defaults: map[string]string{},
 	}
 }
 
@@ -95,18 +211,101 @@ func NewCommandDefinition(name string) *CommandDefinition {
 // the command's receiver.
 //
 // The default is to use a field named "id" of type "Identifier".
+// Calling Id replaces any composite id declared using CompositeId.
 func (self *CommandDefinition) Id(name string, value Value) *CommandDefinition {
 	self.IdField = name
+	self.IdFields = nil
 	return self.Field(name, value)
 }
 
+// CompositeId declares that the command's receiver is identified by
+// the values of all the given fields, which need to be defined
+// separately.  The receiver's id consists of the fields' values,
+// joined by CompositeIdSeparator in the order given here.  Values
+// containing CompositeIdSeparator are rejected with the error
+// "contains_separator", so that ids can be split unambiguously.
+//
+// Example:
+//
+//	RenameProject = ess.NewCommandDefinition("rename-project").
+//		Field("tenant", ess.Id()).
+//		Field("project", ess.Id()).
+//		CompositeId("tenant", "project")
+func (self *CommandDefinition) CompositeId(fields ...string) *CommandDefinition {
+	self.IdField = ""
+	self.IdFields = fields
+	return self
+}
+
 // Field defines a field with the given name and type.  Use this
 // method to define the different parameters of a command.
+//
+// Redefining a field with a value of the same type replaces the
+// field's value.  Field panics if the field has already been defined
+// with a value of a different type, since this usually indicates a
+// mistake in the command's definition.
 func (self *CommandDefinition) Field(name string, value Value) *CommandDefinition {
+	if existing, found := self.Fields[name]; found && reflect.TypeOf(existing) != reflect.TypeOf(value) {
+		panic(fmt.Sprintf("ess: %s: field %q redefined as %T, was %T", self.Name, name, value, existing))
+	}
+
 	self.Fields[name] = value
 	return self
 }
 
+// Normalize wraps the value of the field identified by name, so that
+// fn is applied to the value's string representation after the value
+// has sanitized its input.  Fields that have not been defined are
+// ignored.
+//
+// Example:
+//
+//	Login = ess.NewCommandDefinition("login").
+//		Id("username", ess.TrimmedString()).
+//		Normalize("username", strings.ToLower)
+func (self *CommandDefinition) Normalize(name string, fn func(string) string) *CommandDefinition {
+	if value, found := self.Fields[name]; found {
+		self.Fields[name] = NormalizedValue(value, fn)
+	}
+	return self
+}
+
+// SecretField defines a field like Field, but marks the field as
+// secret.  The values of secret fields are masked when rendering
+// commands and errors about the field.
+func (self *CommandDefinition) SecretField(name string, value Value) *CommandDefinition {
+	self.Secret[name] = true
+	return self.Field(name, value)
+}
+
+// Default sets the default text of the field identified by name to
+// value.  The default is set when creating a new command and used by
+// FromForm if the field has not been submitted.  For forms which
+// cannot tell missing fields apart from empty ones, i.e. forms not
+// implementing PartialForm, the default is used for empty fields as
+// well.  Like any other input, defaults are parsed by the field's
+// value.
+//
+// Explicitly setting the field to an empty string using Set clears
+// the default.
+//
+// Example:
+//
+//	EditPost = ess.NewCommandDefinition("edit-post").
+//		Field("reason", ess.TrimmedString()).
+//		Default("reason", "edit")
+func (self *CommandDefinition) Default(name, value string) *CommandDefinition {
+	self.Defaults[name] = value
+	return self
+}
+
+// MustExist marks commands of this type as being only applicable
+// to existing aggregates.  See RequireExisting.
+func (self *CommandDefinition) MustExist() *CommandDefinition {
+	self.RequireExisting = true
+	return self
+}
+
 // Target sets the function to create a new receiver of the right type
 // for this command to constructor.
 //
@@ -124,23 +323,84 @@ func (self *CommandDefinition) Target(constructor func(*Command) Aggregate) *Com
 	return self
 }
 
+// UnmarshalCommandJSON reconstructs a command encoded by
+// Command.MarshalJSON.  The encoded field values are parsed using the
+// definition's fields; a field "now" set by acknowledging the command
+// is restored as well.
+//
+// If any field cannot be parsed, the command is returned together
+// with the errors, like Command.Validate.  ErrWrongCommand is returned
+// if data encodes a command with a different name.
+//
+// Since Command.MarshalJSON masks the values of secret fields, secret
+// fields set to SecretMask are not set and reported with the error
+// "masked" instead.  Set these fields again before sending the
+// command.
+func (self *CommandDefinition) UnmarshalCommandJSON(data []byte) (*Command, error) {
+	encoded := commandJSON{}
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return nil, err
+	}
+	if encoded.Name != self.Name {
+		return nil, ErrWrongCommand
+	}
+
+	command := self.NewCommand()
+	if encoded.Id != "" {
+		command.Id = encoded.Id
+	}
+	if encoded.CorrelationId != "" {
+		command.CorrelationId = encoded.CorrelationId
+	}
+
+	for field, value := range encoded.Fields {
+		if _, found := command.Fields[field]; !found && field == "now" {
+			command.Fields[field] = &Time{}
+		}
+		if command.IsSecret(field) && value == SecretMask {
+			command.errors.Add(field, "masked")
+			continue
+		}
+		command.Set(field, value)
+	}
+
+	return command, command.Validate()
+}
+
 // NewCommand constructs a new instance of a command, according to
 // this command definition.
 func (self *CommandDefinition) NewCommand() *Command {
+	id := generateId()
 	cmd := &Command{
-		Name: self.Name,
-		Fields: map[string]Value{
-			self.IdField: Id(),
-		},
-		IdField:      self.IdField,
-		errors:       NewValidationError(),
-		receiverFunc: self.TargetFunc,
+		Id:              id,
+		CorrelationId:   id,
+		Name:            self.Name,
+		Fields:          map[string]Value{},
+		IdField:         self.IdField,
+		idFields:        self.IdFields,
+		errors:          NewValidationError(),
+		secret:          map[string]bool{},
+		defaults:        map[string]string{},
+		requireExisting: self.RequireExisting,
+		receiverFunc:    self.TargetFunc,
 	}
 
+	if self.IdField != "" {
+		cmd.Fields[self.IdField] = Id()
+	}
 	for field, val := range self.Fields {
 		cmd.Fields[field] = val.Copy()
 	}
 
+	for field, secret := range self.Secret {
+		cmd.secret[field] = secret
+	}
+
+	for field, value := range self.Defaults {
+		cmd.defaults[field] = value
+		cmd.Set(field, value)
+	}
+
 	return cmd
 }
 
@@ -151,6 +411,45 @@ func (self *CommandDefinition) FromForm(form Form) *Command {
 	return command.FromForm(form)
 }
 
+// Simulate processes command like Application.Send, but without an
+// application: the command's receiver is hydrated from the events in
+// history belonging to its stream, and the events it emits are passed
+// to handlers in order instead of being stored.  The emitted events
+// are returned.
+//
+// Use this method for testing aggregates together with projections,
+// e.g. by passing a projection as a handler and asserting its state
+// afterwards.  Events in history are not passed to handlers.
+//
+// ErrWrongCommand is returned if command has not been created from
+// this definition.
+func (self *CommandDefinition) Simulate(command *Command, history []*Event, handlers ...EventHandler) ([]*Event, error) {
+	if command.Name != self.Name {
+		return nil, ErrWrongCommand
+	}
+
+	store := NewEventsInMemory()
+	if err := store.Store(history); err != nil {
+		return nil, err
+	}
+
+	app := NewApplication(self.Name).
+		WithStore(store).
+		WithLogger(log.New(ioutil.Discard, "", 0))
+	events, err := app.Preview(command)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, event := range events {
+		for _, handler := range handlers {
+			handler.HandleEvent(event)
+		}
+	}
+
+	return events, nil
+}
+
 // Command represents a message sent to your application with the
 // intention to change application state.
 //
@@ -160,20 +459,53 @@ func (self *CommandDefinition) FromForm(form Form) *Command {
 //
 // The fields of a command are of type Value to provide a uniform
 // interface for sanitizing inputs.
+//
+// Every command is assigned a unique id when it is created.  Events
+// emitted while processing a command record the command's id as
+// their causation id.  The correlation id is shared by all commands
+// and events that are part of the same request and defaults to the
+// command's id.
 type Command struct {
-	Name    string
-	Fields  map[string]Value
-	IdField string
-
-	errors       *ValidationError
-	receiver     Aggregate
-	receiverFunc func(*Command) Aggregate
+	Id            string
+	CorrelationId string
+	Name          string
+	Fields        map[string]Value
+	IdField       string
+
+	// Metadata is copied to the metadata of all events caused
+	// by this command, unless an event defines the same key
+	// already.
+	Metadata map[string]string
+
+	idFields        []string
+	errors          *ValidationError
+	secret          map[string]bool
+	defaults        map[string]string
+	requireExisting bool
+	receiver        Aggregate
+	receiverFunc    func(*Command) Aggregate
 }
 
 // AggregateId returns the id of the command's receiver, according to
 // the command's IdField.  If the field is not present, it returns the
 // empty string.
+//
+// For receivers identified by a composite key, the values of all id
+// fields are joined using CompositeIdSeparator.  If any of these
+// fields is missing or empty, the empty string is returned.
 func (self *Command) AggregateId() string {
+	if len(self.idFields) > 0 {
+		parts := make([]string, len(self.idFields))
+		for i, field := range self.idFields {
+			val := self.Get(field)
+			if val == nil || val.String() == "" {
+				return ""
+			}
+			parts[i] = val.String()
+		}
+		return strings.Join(parts, CompositeIdSeparator)
+	}
+
 	val := self.Get(self.IdField)
 	if val != nil {
 		return val.String()
@@ -182,9 +514,66 @@ func (self *Command) AggregateId() string {
 	}
 }
 
-// err adds an error to the list of errors for field
-func (self *Command) err(field string, err error) {
-	self.errors.Add(field, err.Error())
+// CorrelateWith sets the command's correlation id to id.  Use this
+// method to associate commands sent as part of the same request.
+func (self *Command) CorrelateWith(id string) *Command {
+	self.CorrelationId = id
+	return self
+}
+
+// WithMeta sets the metadata for key to value.  Use this method to
+// record infrastructure data, e.g. the client's address, with the
+// events caused by this command.
+func (self *Command) WithMeta(key, value string) *Command {
+	if self.Metadata == nil {
+		self.Metadata = map[string]string{}
+	}
+	self.Metadata[key] = value
+	return self
+}
+
+// err adds an error to the list of errors for field.  If field is
+// secret, every occurrence of the texts given for the field, with and
+// without surrounding whitespace, and of the field's current value
+// in the error's description is masked.
+func (self *Command) err(field string, err error, texts ...string) {
+	desc := err.Error()
+	if self.secret[field] {
+		secrets := []string{self.Fields[field].String()}
+		for _, text := range texts {
+			secrets = append(secrets, text, strings.TrimSpace(text))
+		}
+		sort.Slice(secrets, func(i, j int) bool {
+			return len(secrets[i]) > len(secrets[j])
+		})
+		for _, secret := range secrets {
+			if secret != "" {
+				desc = strings.Replace(desc, secret, SecretMask, -1)
+			}
+		}
+	}
+	self.errors.Add(field, desc)
+}
+
+// IsSecret returns true if the field identified by name is a secret
+// field.
+func (self *Command) IsSecret(name string) bool {
+	return self.secret[name]
+}
+
+// Values returns the string representation of every field's value,
+// keyed by field name.  The values of secret fields are replaced by
+// SecretMask.
+func (self *Command) Values() map[string]string {
+	values := map[string]string{}
+	for field, value := range self.Fields {
+		if self.secret[field] {
+			values[field] = SecretMask
+		} else {
+			values[field] = value.String()
+		}
+	}
+	return values
 }
 
 // Get returns the field identified by name or nil if the field does
@@ -193,6 +582,86 @@ func (self *Command) Get(name string) Value {
 	return self.Fields[name]
 }
 
+// Has returns true if the command has a field called name.
+func (self *Command) Has(name string) bool {
+	_, found := self.Fields[name]
+	return found
+}
+
+// GetString returns the string representation of the field called
+// name or the empty string if the field does not exist.
+func (self *Command) GetString(name string) string {
+	value, found := self.Fields[name]
+	if !found {
+		return ""
+	}
+	return value.String()
+}
+
+// GetInt returns the value of the field called name as an integer.
+// If the field does not exist or its string representation is not a
+// decimal integer, ok is false.
+func (self *Command) GetInt(name string) (value int64, ok bool) {
+	field, found := self.Fields[name]
+	if !found {
+		return 0, false
+	}
+
+	value, err := strconv.ParseInt(field.String(), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return value, true
+}
+
+// GenerateIdWith sets the field identifying the command's receiver
+// to an id generated by generator, unless the field has been set
+// already.  Any errors recorded for the field are discarded when
+// generating an id.
+//
+// Use this method for commands creating new aggregates.
+func (self *Command) GenerateIdWith(generator IdGenerator) *Command {
+	if self.AggregateId() != "" || self.IdField == "" {
+		return self
+	}
+
+	self.errors.Remove(self.IdField)
+	return self.Set(self.IdField, generator.Generate())
+}
+
+// plainTextCopier is implemented by values whose Copy drops the plain
+// text they have been parsed from, e.g. passwords, which copies of
+// commands still need for processing the command.
+type plainTextCopier interface {
+	copyPlainText() Value
+}
+
+// Copy returns a copy of this command with copies of all of its
+// fields.  The copy is not associated with a receiver yet, so that a
+// fresh receiver is created for it.  Unlike Value.Copy, the plain
+// text of passwords is copied as well.
+func (self *Command) Copy() *Command {
+	command := *self
+	command.Fields = make(map[string]Value, len(self.Fields))
+	for field, value := range self.Fields {
+		if value, ok := value.(plainTextCopier); ok {
+			command.Fields[field] = value.copyPlainText()
+			continue
+		}
+		command.Fields[field] = value.Copy()
+	}
+	if self.Metadata != nil {
+		command.Metadata = make(map[string]string, len(self.Metadata))
+		for key, value := range self.Metadata {
+			command.Metadata[key] = value
+		}
+	}
+	command.errors = NewValidationError().Merge(self.errors.Return())
+	command.receiver = nil
+
+	return &command
+}
+
 // Receiver returns an instance of the command's receiver, possibly
 // creating the instance.
 func (self *Command) Receiver() Aggregate {
@@ -203,6 +672,20 @@ func (self *Command) Receiver() Aggregate {
 	return self.receiver
 }
 
+// formValue returns the text submitted for field in form.  The
+// field's default is returned instead if the field has not been
+// submitted.
+func (self *Command) formValue(field string, form Form) string {
+	text := form.FormValue(field)
+	if partialForm, ok := form.(PartialForm); ok && partialForm.Has(field) {
+		return text
+	}
+	if value, found := self.defaults[field]; found && text == "" {
+		return value
+	}
+	return text
+}
+
 // Set sets the value for the field identified by name.  Setting a
 // value using this method parses the string given in value according
 // to the field's type and remembers any errors encountered.
@@ -213,7 +696,9 @@ func (self *Command) Set(name string, value string) *Command {
 	if found {
 		err := target.UnmarshalText([]byte(value))
 		if err != nil {
-			self.err(name, err)
+			self.err(name, err, value)
+		} else {
+			self.checkIdComponent(name)
 		}
 	}
 
@@ -222,17 +707,73 @@ func (self *Command) Set(name string, value string) *Command {
 
 // FromForm sets all of the command's fields with the values found in
 // form.
+//
+// If form is a MultiValueForm, fields implementing MultiValue are set
+// from all values submitted for the field.
 func (self *Command) FromForm(form Form) *Command {
-	for field, value := range self.Fields {
-		text := form.FormValue(field)
-		if err := value.UnmarshalText([]byte(text)); err != nil {
-			self.err(field, err)
+	for field := range self.Fields {
+		self.setFromForm(field, form)
+	}
+
+	return self
+}
+
+// FromFormPartial sets only those of the command's fields which are
+// present in form, so that omitted fields keep their current values.
+// Use this method for commands changing only some attributes of an
+// aggregate.
+//
+// If form is a PartialForm, fields present in form are set even if
+// they are empty.  Otherwise, only fields with non-empty values are
+// considered to be present.
+func (self *Command) FromFormPartial(form Form) *Command {
+	partialForm, isPartialForm := form.(PartialForm)
+	for field := range self.Fields {
+		if isPartialForm && !partialForm.Has(field) {
+			continue
 		}
+		if !isPartialForm && form.FormValue(field) == "" {
+			continue
+		}
+
+		self.setFromForm(field, form)
 	}
 
 	return self
 }
 
+// setFromForm sets field from the values found in form.
+func (self *Command) setFromForm(field string, form Form) {
+	value := self.Fields[field]
+	if multiValue, ok := value.(MultiValue); ok {
+		if multiForm, ok := form.(MultiValueForm); ok {
+			values := multiForm.FormValues(field)
+			if err := multiValue.UnmarshalValues(values); err != nil {
+				self.err(field, err, values...)
+			}
+			return
+		}
+	}
+
+	text := self.formValue(field, form)
+	if err := value.UnmarshalText([]byte(text)); err != nil {
+		self.err(field, err, text)
+	} else {
+		self.checkIdComponent(field)
+	}
+}
+
+// checkIdComponent records an error for field if it is part of a
+// composite id and its value contains CompositeIdSeparator, since the
+// id could not be split into its parts again.
+func (self *Command) checkIdComponent(field string) {
+	for _, idField := range self.idFields {
+		if idField == field && strings.Contains(self.Fields[field].String(), CompositeIdSeparator) {
+			self.errors.Add(field, "contains_separator")
+		}
+	}
+}
+
 // Acknowledge marks the command as having been received by the
 // system.
 //
@@ -246,6 +787,16 @@ func (self *Command) Acknowledge(clock Clock) {
 	self.Fields["now"] = &Time{now}
 }
 
+// Validate returns the errors encountered while setting the
+// command's fields or nil if all fields have been set successfully.
+// The command's receiver is not involved.
+//
+// Use this method for reporting malformed input before sending the
+// command to the application.
+func (self *Command) Validate() error {
+	return self.errors.Return()
+}
+
 // Execute passes this command to its receiver, merging any errors
 // returned into the errors encountered during parameter processing.
 func (self *Command) Execute() error {
@@ -258,14 +809,44 @@ func (self *Command) Execute() error {
 	return err
 }
 
+// commandJSON defines the JSON representation of a command.
+type commandJSON struct {
+	Id            string            `json:"id,omitempty"`
+	CorrelationId string            `json:"correlation_id,omitempty"`
+	Name          string            `json:"name"`
+	IdField       string            `json:"id_field"`
+	Fields        map[string]string `json:"fields"`
+}
+
+// MarshalJSON implements json.Marshaler.  Field values are encoded
+// as strings, as returned by Values, so that the values of secret
+// fields are masked.
+//
+// Use CommandDefinition.UnmarshalCommandJSON for decoding commands.
+// Since secret values are not encoded, a journal of encoded commands
+// cannot be replayed as is: decoded commands with secret fields fail
+// validation until these fields have been set again, e.g. by asking
+// the user.  Store secrets separately and encrypted if commands need
+// to be replayed without user interaction.
+func (self *Command) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&commandJSON{
+		Id:            self.Id,
+		CorrelationId: self.CorrelationId,
+		Name:          self.Name,
+		IdField:       self.IdField,
+		Fields:        self.Values(),
+	})
+}
+
 // String returns a multiline representation of the command.
 //
 // The information contained in the returned string is enough to
-// reconstruct the command.
+// reconstruct the command, except for the values of secret fields,
+// which are masked.
 func (self *Command) String() string {
 	out := bytes.NewBufferString(self.Name + "\n")
 
-	for field, value := range self.Fields {
+	for field, value := range self.Values() {
 		fmt.Fprintf(out, "param %s: ", field)
 		fmt.Fprintf(out, "%q", value)
 		fmt.Fprintf(out, "\n")
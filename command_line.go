@@ -0,0 +1,150 @@
+package ess
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ErrUnknownCommand is returned when running a command line naming a
+// command that has not been defined.
+var ErrUnknownCommand = errors.New("unknown_command")
+
+// CommandLine dispatches commands given as command line arguments to
+// an application.  Use it for providing administrative tools for an
+// application.
+//
+// The first argument names the command, all other arguments set the
+// command's fields and need to be of the form "--field=value".
+//
+// Example:
+//
+//	cli := ess.NewCommandLine(app, map[string]*ess.CommandDefinition{
+//		"sign-up": SignUp,
+//	})
+//	if err := cli.Run(os.Args[1:]); err != nil {
+//		os.Exit(1)
+//	}
+type CommandLine struct {
+	app         *Application
+	definitions map[string]*CommandDefinition
+	stdout      io.Writer
+	stderr      io.Writer
+}
+
+// NewCommandLine returns a new command line sending commands to app.
+// Definitions maps the names accepted as the first argument to the
+// corresponding command definitions.
+//
+// Results are written to standard output, errors to standard error.
+func NewCommandLine(app *Application, definitions map[string]*CommandDefinition) *CommandLine {
+	return &CommandLine{
+		app:         app,
+		definitions: definitions,
+		stdout:      os.Stdout,
+		stderr:      os.Stderr,
+	}
+}
+
+// WithOutput sets the writers used for reporting results and errors
+// to stdout and stderr respectively.
+func (self *CommandLine) WithOutput(stdout, stderr io.Writer) *CommandLine {
+	self.stdout = stdout
+	self.stderr = stderr
+	return self
+}
+
+// Run parses args into a command and sends it to the application.
+//
+// On success, the id of the command's receiver and the names of the
+// emitted events are written to standard output.  Otherwise the
+// errors are written to standard error and returned, so that the
+// caller can exit with a non-zero status.
+func (self *CommandLine) Run(args []string) error {
+	if len(args) == 0 || self.definitions[args[0]] == nil {
+		self.usage()
+		return ErrUnknownCommand
+	}
+
+	definition := self.definitions[args[0]]
+	command := definition.NewCommand()
+	invalid := NewValidationError()
+	for _, arg := range args[1:] {
+		field, value, ok := parseCommandLineFlag(arg)
+		if !ok {
+			invalid.AddCode(arg, "malformed_argument")
+			continue
+		}
+		if _, found := command.Fields[field]; !found {
+			invalid.AddCode(field, "unknown_field")
+			continue
+		}
+
+		command.Set(field, value)
+	}
+	if err := invalid.Return(); err != nil {
+		self.reportError(err)
+		return err
+	}
+
+	result := self.app.Send(command)
+	if err := result.Error(); err != nil {
+		self.reportError(err)
+		return err
+	}
+
+	fmt.Fprintf(self.stdout, "ok %s\n", result.AggregateId())
+	for _, event := range result.Events() {
+		fmt.Fprintf(self.stdout, "%s %s\n", event.Name, event.StreamId)
+	}
+
+	return nil
+}
+
+// usage writes the names of all known commands to standard error.
+func (self *CommandLine) usage() {
+	names := []string{}
+	for name := range self.definitions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(self.stderr, "usage: COMMAND --FIELD=VALUE...\n\ncommands:\n")
+	for _, name := range names {
+		fmt.Fprintf(self.stderr, "  %s\n", name)
+	}
+}
+
+// reportError writes err to standard error.  Validation errors are
+// written as one line per error.
+func (self *CommandLine) reportError(err error) {
+	invalid, ok := err.(*ValidationError)
+	if !ok {
+		fmt.Fprintf(self.stderr, "error: %s\n", err)
+		return
+	}
+
+	for _, field := range invalid.Fields() {
+		for _, detail := range invalid.Details(field) {
+			fmt.Fprintf(self.stderr, "%s: %s\n", field, detail.Message)
+		}
+	}
+}
+
+// parseCommandLineFlag splits arg of the form "--field=value" into
+// field and value.
+func parseCommandLineFlag(arg string) (field, value string, ok bool) {
+	if !strings.HasPrefix(arg, "--") {
+		return "", "", false
+	}
+
+	parts := strings.SplitN(arg[2:], "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return "", "", false
+	}
+
+	return parts[0], parts[1], true
+}
@@ -0,0 +1,75 @@
+package ess
+
+import (
+	"bytes"
+	"testing"
+)
+
+var testCommandLineDefinition = NewCommandDefinition("publish").
+	Field("title", TrimmedString().MinLen(1)).
+	Target(func(command *Command) Aggregate {
+		aggregate := newTestAggregate(command.Get("id").String())
+		aggregate.onCommand = func(agg *testAggregate) {
+			agg.events.PublishEvent(NewEvent("post.published").For(agg).Add("title", command.Get("title").String()))
+		}
+		return aggregate
+	})
+
+func newTestCommandLine() (*CommandLine, *bytes.Buffer, *bytes.Buffer) {
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	cli := NewCommandLine(NewTestApp(), map[string]*CommandDefinition{
+		"publish": testCommandLineDefinition,
+	}).WithOutput(stdout, stderr)
+	return cli, stdout, stderr
+}
+
+func TestCommandLine_Run_sendsCommand(t *testing.T) {
+	cli, stdout, _ := newTestCommandLine()
+
+	if err := cli.Run([]string{"publish", "--id=hello", "--title=Hello, world"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := stdout.String(), "ok hello\npost.published hello\n"; got != want {
+		t.Errorf("stdout = %q; want %q", got, want)
+	}
+}
+
+func TestCommandLine_Run_reportsValidationErrors(t *testing.T) {
+	cli, stdout, stderr := newTestCommandLine()
+
+	if err := cli.Run([]string{"publish", "--id=hello", "--title="}); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if got, want := stderr.String(), "title: too_short\n"; got != want {
+		t.Errorf("stderr = %q; want %q", got, want)
+	}
+	if got, want := stdout.String(), ""; got != want {
+		t.Errorf("stdout = %q; want %q", got, want)
+	}
+}
+
+func TestCommandLine_Run_rejectsMalformedArguments(t *testing.T) {
+	cli, _, stderr := newTestCommandLine()
+
+	if err := cli.Run([]string{"publish", "title", "--author=me"}); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if got, want := stderr.String(), "title: malformed_argument\nauthor: unknown_field\n"; got != want {
+		t.Errorf("stderr = %q; want %q", got, want)
+	}
+}
+
+func TestCommandLine_Run_rejectsUnknownCommands(t *testing.T) {
+	cli, _, stderr := newTestCommandLine()
+
+	if got, want := cli.Run([]string{"unpublish"}), ErrUnknownCommand; got != want {
+		t.Errorf("cli.Run(unpublish) = %v; want %v", got, want)
+	}
+
+	if got, want := stderr.String(), "usage: COMMAND --FIELD=VALUE...\n\ncommands:\n  publish\n"; got != want {
+		t.Errorf("stderr = %q; want %q", got, want)
+	}
+}
@@ -0,0 +1,556 @@
+package ess
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// echoingValue is a value which echoes its input when it fails to
+// parse.
+type echoingValue struct{ text string }
+
+func (self *echoingValue) UnmarshalText(data []byte) error {
+	self.text = string(data)
+	return fmt.Errorf("invalid value %q", data)
+}
+
+func (self *echoingValue) String() string { return self.text }
+func (self *echoingValue) Copy() Value    { return &echoingValue{text: self.text} }
+
+func TestCommand_secretFieldsAreNotRevealedByErrors(t *testing.T) {
+	definition := NewCommandDefinition("test").
+		SecretField("pin", &echoingValue{}).
+		Target(newTestAggregateFromCommand)
+	cmd := definition.NewCommand().
+		Set("id", "test").
+		Set("pin", "1234")
+
+	result := NewTestApp().Send(cmd)
+	if result.Error() == nil {
+		t.Fatal("expected an error")
+	}
+
+	serialized, err := json.Marshal(result.Error())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, rendered := range []string{
+		result.Error().Error(),
+		string(serialized),
+		cmd.String(),
+		cmd.Values()["pin"],
+		strings.Join(CurrentLines, "\n"),
+	} {
+		if strings.Contains(rendered, "1234") {
+			t.Errorf("secret revealed in %q", rendered)
+		}
+	}
+}
+
+// normalizingValue is a value which echoes its input in upper case
+// when it fails to parse.
+type normalizingValue struct{ text string }
+
+func (self *normalizingValue) UnmarshalText(data []byte) error {
+	self.text = strings.ToUpper(strings.TrimSpace(string(data)))
+	return fmt.Errorf("invalid value %q", self.text)
+}
+
+func (self *normalizingValue) String() string { return self.text }
+func (self *normalizingValue) Copy() Value    { return &normalizingValue{text: self.text} }
+
+func TestCommand_secretFieldsAreNotRevealedByErrorsInOtherForms(t *testing.T) {
+	definition := NewCommandDefinition("test").
+		SecretField("pin", &normalizingValue{}).
+		Target(newTestAggregateFromCommand)
+	cmd := definition.NewCommand().Set("pin", " abcd ")
+
+	if got := cmd.Validate().Error(); strings.Contains(got, "ABCD") {
+		t.Errorf("secret revealed in %q", got)
+	}
+}
+
+func TestCommand_Values_masksSecretFields(t *testing.T) {
+	definition := NewCommandDefinition("test").
+		Field("name", TrimmedString()).
+		SecretField("pin", TrimmedString())
+	cmd := definition.NewCommand().
+		Set("name", "admin").
+		Set("pin", "1234")
+
+	if got, want := cmd.Values()["name"], "admin"; got != want {
+		t.Errorf(`cmd.Values()["name"] = %q; want %q`, got, want)
+	}
+
+	if got, want := cmd.Values()["pin"], SecretMask; got != want {
+		t.Errorf(`cmd.Values()["pin"] = %q; want %q`, got, want)
+	}
+}
+
+func TestCommand_FromForm_setsListsFromRepeatedValues(t *testing.T) {
+	definition := NewCommandDefinition("test").
+		Field("tags", List())
+	form := URLValues{"tags": {"go", "events"}}
+	cmd := definition.FromForm(form)
+
+	if got, want := cmd.Get("tags").String(), "go,events"; got != want {
+		t.Errorf(`cmd.Get("tags").String() = %q; want %q`, got, want)
+	}
+}
+
+func TestCommand_FromForm_setsListsFromSingleValue(t *testing.T) {
+	definition := NewCommandDefinition("test").
+		Field("tags", List())
+	form := URLValues{"tags": {"go"}}
+	cmd := definition.FromForm(form)
+
+	if got, want := cmd.Get("tags").(*StringList).Strings(), []string{"go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf(`cmd.Get("tags").(*StringList).Strings() = %q; want %q`, got, want)
+	}
+}
+
+func TestCommandDefinition_Normalize_normalizesFieldBeforeHandlingCommand(t *testing.T) {
+	seen := ""
+	definition := NewCommandDefinition("test").
+		Field("username", TrimmedString()).
+		Normalize("username", strings.ToLower).
+		Target(func(command *Command) Aggregate {
+			aggregate := newTestAggregateFromCommand(command).(*testAggregate)
+			aggregate.onCommand = func(*testAggregate) {
+				seen = command.Get("username").String()
+			}
+			return aggregate
+		})
+	cmd := definition.NewCommand().
+		Set("id", "test").
+		Set("username", "  Admin ")
+
+	if err := NewTestApp().Send(cmd).Error(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := seen, "admin"; got != want {
+		t.Errorf(`seen = %q; want %q`, got, want)
+	}
+}
+
+func TestCommand_Validate_returnsFieldErrors(t *testing.T) {
+	definition := NewCommandDefinition("test").
+		Field("email", EmailAddress())
+	cmd := definition.NewCommand().Set("email", "not an email")
+
+	err, ok := cmd.Validate().(*ValidationError)
+	if !ok {
+		t.Fatalf("cmd.Validate().(type) = %T; want %T", cmd.Validate(), err)
+	}
+
+	if got, want := len(err.Errors["email"]), 1; got != want {
+		t.Errorf(`len(err.Errors["email"]) = %d; want %d`, got, want)
+	}
+}
+
+func TestCommand_Validate_returnsNilIfAllFieldsAreValid(t *testing.T) {
+	definition := NewCommandDefinition("test").
+		Field("email", EmailAddress())
+	cmd := definition.NewCommand().Set("email", "jane.doe@example.com")
+
+	if got := cmd.Validate(); got != nil {
+		t.Errorf("cmd.Validate() = %v; want %v", got, nil)
+	}
+}
+
+func TestCommand_MarshalJSON_roundTripsThroughDefinition(t *testing.T) {
+	definition := NewCommandDefinition("write-post").
+		Field("title", TrimmedString()).
+		Field("published_on", &Date{}).
+		Field("category", Enum("news", "howto"))
+	command := definition.NewCommand().
+		Set("id", "hello-world").
+		Set("title", " Hello, world ").
+		Set("published_on", "2016-01-02").
+		Set("category", "news").
+		CorrelateWith("request")
+	command.Acknowledge(&StaticClock{time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)})
+
+	data, err := json.Marshal(command)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := definition.UnmarshalCommandJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := decoded.Values(), command.Values(); !reflect.DeepEqual(got, want) {
+		t.Errorf("decoded.Values() = %v; want %v", got, want)
+	}
+	if got, want := decoded.Id, command.Id; got != want {
+		t.Errorf("decoded.Id = %q; want %q", got, want)
+	}
+	if got, want := decoded.CorrelationId, "request"; got != want {
+		t.Errorf("decoded.CorrelationId = %q; want %q", got, want)
+	}
+}
+
+func TestCommandDefinition_UnmarshalCommandJSON_rejectsMaskedSecrets(t *testing.T) {
+	definition := NewCommandDefinition("login").
+		SecretField("password", TrimmedString())
+	data, err := json.Marshal(definition.NewCommand().Set("id", "admin").Set("password", "hunter2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := definition.UnmarshalCommandJSON(data)
+	verr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("err = %v; want *ValidationError", err)
+	}
+	if got, want := verr.Errors["password"], []string{"masked"}; !reflect.DeepEqual(got, want) {
+		t.Errorf(`verr.Errors["password"] = %v; want %v`, got, want)
+	}
+	if got, want := decoded.Get("password").String(), ""; got != want {
+		t.Errorf(`decoded.Get("password").String() = %q; want %q`, got, want)
+	}
+}
+
+func TestCommandDefinition_UnmarshalCommandJSON_rejectsOtherCommands(t *testing.T) {
+	definition := NewCommandDefinition("write-post")
+	data := []byte(`{"name":"delete-post","id_field":"id","fields":{"id":"hello-world"}}`)
+
+	if _, err := definition.UnmarshalCommandJSON(data); err != ErrWrongCommand {
+		t.Errorf("UnmarshalCommandJSON(%s) = %v; want %v", data, err, ErrWrongCommand)
+	}
+}
+
+func TestCommandDefinition_Default_setsFieldsOfNewCommands(t *testing.T) {
+	definition := NewCommandDefinition("edit-post").
+		Field("reason", TrimmedString()).
+		Default("reason", "edit")
+
+	if got, want := definition.NewCommand().Get("reason").String(), "edit"; got != want {
+		t.Errorf(`Get("reason").String() = %q; want %q`, got, want)
+	}
+
+	if got, want := definition.NewCommand().Set("reason", "").Get("reason").String(), ""; got != want {
+		t.Errorf(`Set("reason", "").Get("reason").String() = %q; want %q`, got, want)
+	}
+
+	if got, want := definition.NewCommand().Set("reason", "typo").Get("reason").String(), "typo"; got != want {
+		t.Errorf(`Set("reason", "typo").Get("reason").String() = %q; want %q`, got, want)
+	}
+}
+
+func TestCommandDefinition_Default_appliesToMissingFormValues(t *testing.T) {
+	definition := NewCommandDefinition("edit-post").
+		Field("reason", TrimmedString()).
+		Field("title", TrimmedString()).
+		Default("reason", "edit")
+
+	command := definition.FromForm(URLValues{"title": {"Hello"}})
+	if got, want := command.Get("reason").String(), "edit"; got != want {
+		t.Errorf(`Get("reason").String() = %q; want %q`, got, want)
+	}
+
+	command = definition.FromForm(URLValues{"reason": {"typo"}})
+	if got, want := command.Get("reason").String(), "typo"; got != want {
+		t.Errorf(`Get("reason").String() = %q; want %q`, got, want)
+	}
+
+	command = definition.FromForm(URLValues{"reason": {""}})
+	if got, want := command.Get("reason").String(), ""; got != want {
+		t.Errorf(`Get("reason").String() = %q; want %q`, got, want)
+	}
+
+	command = definition.FromForm(struct{ Form }{URLValues{"reason": {""}}})
+	if got, want := command.Get("reason").String(), "edit"; got != want {
+		t.Errorf(`[not partial] Get("reason").String() = %q; want %q`, got, want)
+	}
+}
+
+func TestCommandDefinition_Default_isValidated(t *testing.T) {
+	definition := NewCommandDefinition("publish").
+		Field("on", &Date{}).
+		Default("on", "tomorrow")
+
+	if err := definition.NewCommand().Validate(); err == nil {
+		t.Errorf("expected an error for an invalid default")
+	}
+}
+
+func TestCommand_FromFormPartial_keepsAbsentFields(t *testing.T) {
+	definition := NewCommandDefinition("edit").
+		Field("title", TrimmedString()).
+		Field("body", TrimmedString())
+	command := definition.NewCommand().
+		Set("title", "Hello").
+		Set("body", "World")
+
+	command.FromFormPartial(URLValues{"title": {"Goodbye"}})
+
+	if got, want := command.Get("title").String(), "Goodbye"; got != want {
+		t.Errorf(`Get("title").String() = %q; want %q`, got, want)
+	}
+	if got, want := command.Get("body").String(), "World"; got != want {
+		t.Errorf(`Get("body").String() = %q; want %q`, got, want)
+	}
+}
+
+func TestCommand_FromFormPartial_setsFieldsPresentButEmpty(t *testing.T) {
+	definition := NewCommandDefinition("edit").
+		Field("title", TrimmedString()).
+		Field("body", TrimmedString())
+	command := definition.NewCommand().
+		Set("title", "Hello").
+		Set("body", "World")
+
+	command.FromFormPartial(URLValues{"body": {""}})
+
+	if got, want := command.Get("title").String(), "Hello"; got != want {
+		t.Errorf(`Get("title").String() = %q; want %q`, got, want)
+	}
+	if got, want := command.Get("body").String(), ""; got != want {
+		t.Errorf(`Get("body").String() = %q; want %q`, got, want)
+	}
+}
+
+func TestCommand_GetString_returnsEmptyStringForMissingFields(t *testing.T) {
+	command := NewCommandDefinition("test").
+		Field("title", TrimmedString()).
+		NewCommand().
+		Set("title", " Hello ")
+
+	if got, want := command.GetString("title"), "Hello"; got != want {
+		t.Errorf(`command.GetString("title") = %q; want %q`, got, want)
+	}
+	if got, want := command.GetString("missing"), ""; got != want {
+		t.Errorf(`command.GetString("missing") = %q; want %q`, got, want)
+	}
+}
+
+func TestCommand_GetInt_parsesIntegerFields(t *testing.T) {
+	command := NewCommandDefinition("test").
+		Field("count", TrimmedString()).
+		Field("title", TrimmedString()).
+		NewCommand().
+		Set("count", "-42").
+		Set("title", "Hello")
+
+	testcases := []struct {
+		field string
+		value int64
+		ok    bool
+	}{
+		{"count", -42, true},
+		{"title", 0, false},
+		{"missing", 0, false},
+	}
+
+	for _, testcase := range testcases {
+		value, ok := command.GetInt(testcase.field)
+		if got, want := value, testcase.value; got != want {
+			t.Errorf(`command.GetInt(%q) = %d; want %d`, testcase.field, got, want)
+		}
+		if got, want := ok, testcase.ok; got != want {
+			t.Errorf(`command.GetInt(%q): ok = %v; want %v`, testcase.field, got, want)
+		}
+	}
+}
+
+func TestCommand_Has_reportsDefinedFields(t *testing.T) {
+	command := NewCommandDefinition("test").
+		Field("title", TrimmedString()).
+		NewCommand()
+
+	if got, want := command.Has("title"), true; got != want {
+		t.Errorf(`command.Has("title") = %v; want %v`, got, want)
+	}
+	if got, want := command.Has("missing"), false; got != want {
+		t.Errorf(`command.Has("missing") = %v; want %v`, got, want)
+	}
+}
+
+func TestCommandDefinition_Simulate_hydratesReceiverFromHistory(t *testing.T) {
+	seen := []string{}
+	definition := NewCommandDefinition("test").
+		Target(func(command *Command) Aggregate {
+			aggregate := newTestAggregateFromCommand(command).(*testAggregate)
+			aggregate.onEvent = func(event *Event) { seen = append(seen, event.Name) }
+			aggregate.onCommand = func(agg *testAggregate) {
+				agg.events.PublishEvent(NewEvent("test.simulated").For(agg))
+			}
+			return aggregate
+		})
+	history := []*Event{
+		NewEvent("test.run").For(newTestAggregate("test")),
+		NewEvent("test.run").For(newTestAggregate("other")),
+	}
+
+	handled := []string{}
+	events, err := definition.Simulate(definition.NewCommand().Set("id", "test"), history,
+		EventHandlerFunc(func(event *Event) { handled = append(handled, event.Name) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := seen, []string{"test.run"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("seen = %v; want %v", got, want)
+	}
+	if got, want := len(events), 1; got != want {
+		t.Fatalf("len(events) = %d; want %d", got, want)
+	}
+	if got, want := handled, []string{"test.simulated"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("handled = %v; want %v", got, want)
+	}
+}
+
+func TestCommandDefinition_Simulate_rejectsOtherCommands(t *testing.T) {
+	definition := NewCommandDefinition("test")
+	command := NewCommandDefinition("other").NewCommand()
+
+	if _, err := definition.Simulate(command, nil); err != ErrWrongCommand {
+		t.Errorf("definition.Simulate(command, nil) = %v; want %v", err, ErrWrongCommand)
+	}
+}
+
+func TestCommandDefinition_Field_panicsOnConflictingRedefinition(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Field did not panic")
+		}
+	}()
+
+	NewCommandDefinition("test").
+		Field("title", TrimmedString()).
+		Field("title", Flags("draft"))
+}
+
+func TestCommandDefinition_Field_allowsRedefinitionWithSameType(t *testing.T) {
+	definition := NewCommandDefinition("test").
+		Id("id", Id()).
+		Field("title", TrimmedString()).
+		Field("title", TrimmedString())
+
+	if got, want := len(definition.Fields), 2; got != want {
+		t.Errorf("len(definition.Fields) = %d; want %d", got, want)
+	}
+}
+
+func TestCommand_AggregateId_joinsCompositeIdFields(t *testing.T) {
+	definition := NewCommandDefinition("rename-project").
+		Field("tenant", Id()).
+		Field("project", Id()).
+		CompositeId("tenant", "project")
+
+	command := definition.NewCommand().Set("tenant", "acme")
+	if got, want := command.AggregateId(), ""; got != want {
+		t.Errorf("command.AggregateId() = %q; want %q", got, want)
+	}
+
+	command.Set("project", "site")
+	if got, want := command.AggregateId(), "acme/site"; got != want {
+		t.Errorf("command.AggregateId() = %q; want %q", got, want)
+	}
+}
+
+func TestCommand_Set_rejectsSeparatorInCompositeIdFields(t *testing.T) {
+	definition := NewCommandDefinition("rename-project").
+		Field("tenant", TrimmedString()).
+		Field("project", TrimmedString()).
+		CompositeId("tenant", "project")
+
+	command := definition.NewCommand().Set("tenant", "acme/site").Set("project", "blog")
+	verr, ok := command.Validate().(*ValidationError)
+	if !ok {
+		t.Fatalf("command.Validate() = %v; want *ValidationError", command.Validate())
+	}
+	if got, want := verr.Errors["tenant"], []string{"contains_separator"}; !reflect.DeepEqual(got, want) {
+		t.Errorf(`verr.Errors["tenant"] = %v; want %v`, got, want)
+	}
+}
+
+func TestCommandDefinition_Id_replacesCompositeId(t *testing.T) {
+	definition := NewCommandDefinition("rename-project").
+		Field("tenant", Id()).
+		CompositeId("tenant", "project").
+		Id("id", Id())
+
+	command := definition.NewCommand().Set("tenant", "acme").Set("id", "site")
+	if got, want := command.AggregateId(), "site"; got != want {
+		t.Errorf("command.AggregateId() = %q; want %q", got, want)
+	}
+}
+
+func TestCommandResult_MarshalJSON_encodesSuccess(t *testing.T) {
+	result := NewSuccessResult(newTestAggregate("admin"))
+	result.version = 2
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := string(data), `{"status":"ok","id":"admin","version":2}`; got != want {
+		t.Errorf("json.Marshal(result) = %s; want %s", got, want)
+	}
+}
+
+func TestCommandResult_MarshalJSON_leavesOutEventPayloads(t *testing.T) {
+	event := NewEvent("user.signed-up").Add("password", "hash")
+	event.Id = "1"
+	result := NewSuccessResult(newTestAggregate("admin"), event)
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := string(data), `{"status":"ok","id":"admin","events":[{"name":"user.signed-up","id":"1"}]}`; got != want {
+		t.Errorf("json.Marshal(result) = %s; want %s", got, want)
+	}
+}
+
+func TestCommandResult_MarshalJSON_encodesValidationErrors(t *testing.T) {
+	result := NewErrorResult(NewValidationError().Add("email", "empty"))
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"error":{"email":["empty"]},"details":{"email":[{"code":"empty","message":"empty"}]}}`
+	if got := string(data); got != want {
+		t.Errorf("json.Marshal(result) = %s; want %s", got, want)
+	}
+}
+
+func TestCommandResult_MarshalJSON_encodesOtherErrors(t *testing.T) {
+	result := NewErrorResult(ErrAggregateNotFound)
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := string(data), `{"error":"not_found"}`; got != want {
+		t.Errorf("json.Marshal(result) = %s; want %s", got, want)
+	}
+}
+
+func TestCommand_Copy_keepsPlainTextOfPasswords(t *testing.T) {
+	command := NewCommandDefinition("log-in").
+		SecretField("password", Password()).
+		NewCommand().
+		Set("password", "secret")
+	hash := command.Get("password").String()
+
+	copied := command.Copy().Get("password").(*BcryptedPassword)
+	if got, want := copied.Matches(hash), true; got != want {
+		t.Errorf(`copied.Matches(hash) = %v; want %v`, got, want)
+	}
+}
@@ -0,0 +1,98 @@
+package ess
+
+import "io"
+
+// CompositeEventStore is an EventStore writing events to several
+// underlying stores, e.g. a local log on disk and a database which
+// can be queried.  Events are replayed from a designated primary
+// store.
+//
+// Store writes events to the primary store first and then to all
+// other stores in order, stopping at the first store that fails.
+// Writes are not rolled back: if a store fails, the events remain in
+// all stores written to before.  Since the primary store is written
+// to first, it always contains at least the events contained in the
+// other stores.
+type CompositeEventStore struct {
+	primary EventStore
+	others  []EventStore
+}
+
+// NewCompositeEventStore returns a new store writing to primary and
+// others and replaying events from primary.
+func NewCompositeEventStore(primary EventStore, others ...EventStore) *CompositeEventStore {
+	return &CompositeEventStore{
+		primary: primary,
+		others:  others,
+	}
+}
+
+// stores returns all underlying stores, starting with the primary
+// store.
+func (self *CompositeEventStore) stores() []EventStore {
+	return append([]EventStore{self.primary}, self.others...)
+}
+
+// Store writes events to all underlying stores.  It returns the
+// first error encountered.
+//
+// The other stores are passed copies of events, so that events keep
+// the stream versions and sequence numbers assigned by the primary
+// store.
+func (self *CompositeEventStore) Store(events []*Event) error {
+	if err := self.primary.Store(events); err != nil {
+		return err
+	}
+
+	for _, store := range self.others {
+		if err := store.Store(copyEvents(events)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Replay replays events from the primary store.
+func (self *CompositeEventStore) Replay(streamId string, receiver EventHandler) error {
+	return self.primary.Replay(streamId, receiver)
+}
+
+// DeleteStream deletes the stream identified by streamId from all
+// underlying stores.  It returns the first error encountered.
+//
+// ErrStreamDeletionNotSupported is returned without deleting anything
+// if any of the underlying stores does not implement StreamDeleter.
+func (self *CompositeEventStore) DeleteStream(streamId string) error {
+	deleters := []StreamDeleter{}
+	for _, store := range self.stores() {
+		deleter, ok := store.(StreamDeleter)
+		if !ok {
+			return ErrStreamDeletionNotSupported
+		}
+		deleters = append(deleters, deleter)
+	}
+
+	for _, deleter := range deleters {
+		if err := deleter.DeleteStream(streamId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes all underlying stores implementing io.Closer.  All
+// stores are closed even if closing one of them fails; the first
+// error encountered is returned.
+func (self *CompositeEventStore) Close() error {
+	var firstErr error
+	for _, store := range self.stores() {
+		closer, ok := store.(io.Closer)
+		if !ok {
+			continue
+		}
+		if err := closer.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,291 @@
+package ess
+
+import (
+	"bufio"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// DeadLetterRetries is the default number of times a
+	// RetryingProjection retries handling an event before
+	// recording it as a dead letter.
+	DeadLetterRetries = 3
+
+	// DeadLetterBackoff is the default time a RetryingProjection
+	// waits before retrying to handle an event for the first time.
+	// The time doubles with every retry.
+	DeadLetterBackoff = 100 * time.Millisecond
+)
+
+// DeadLetter describes an event which a projection has failed to
+// handle.
+type DeadLetter struct {
+	// Projection is the name of the projection that failed to
+	// handle the event.
+	Projection string
+
+	// Event is the event that could not be handled.
+	Event *Event
+
+	// Reason is the error returned by the last attempt at
+	// handling the event.
+	Reason string
+
+	// Attempts is the number of times handling the event has
+	// been attempted.
+	Attempts int
+
+	// FailedAt is the time of the last attempt.
+	FailedAt time.Time
+}
+
+// key identifies the projection and event of the dead letter.
+func (self DeadLetter) key() string {
+	return self.Projection + "\x00" + self.Event.Id
+}
+
+// DeadLettersInMemory is an in-memory implementation of a
+// DeadLetterStore.  Since dead letters are lost when the process
+// exits, use it only for tests and demos.
+type DeadLettersInMemory struct {
+	mutex   sync.Mutex
+	letters []DeadLetter
+	seen    map[string]bool
+}
+
+// NewDeadLettersInMemory creates a new instance of this store
+// holding no dead letters initially.
+func NewDeadLettersInMemory() *DeadLettersInMemory {
+	return &DeadLettersInMemory{
+		letters: []DeadLetter{},
+		seen:    map[string]bool{},
+	}
+}
+
+// StoreDeadLetter records letter, unless a letter for the same
+// projection and event has been recorded already.  It never returns
+// an error.
+func (self *DeadLettersInMemory) StoreDeadLetter(letter DeadLetter) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if self.seen[letter.key()] {
+		return nil
+	}
+
+	self.seen[letter.key()] = true
+	self.letters = append(self.letters, letter)
+	return nil
+}
+
+// DeadLetters returns a copy of all recorded dead letters.
+func (self *DeadLettersInMemory) DeadLetters() []DeadLetter {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return append([]DeadLetter{}, self.letters...)
+}
+
+// DeadLettersOnDisk is a DeadLetterStore keeping dead letters in a
+// file, one JSON object per line, so that they survive restarts.
+// All dead letters are kept in memory as well.
+type DeadLettersOnDisk struct {
+	filename string
+	memory   *DeadLettersInMemory
+
+	// mutex serialises storing dead letters, so that concurrent
+	// calls for the same letter append it to the file only once.
+	mutex sync.Mutex
+}
+
+// NewDeadLettersOnDisk returns a new store keeping dead letters in
+// the file called filename, loading the dead letters recorded in it
+// already.  The file is created once the first dead letter is
+// recorded.
+func NewDeadLettersOnDisk(filename string) (*DeadLettersOnDisk, error) {
+	store := &DeadLettersOnDisk{
+		filename: filename,
+		memory:   NewDeadLettersInMemory(),
+	}
+
+	in, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return store, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	lines := bufio.NewScanner(in)
+	lines.Buffer(nil, 1<<30)
+	for lines.Scan() {
+		letter := DeadLetter{}
+		if err := json.Unmarshal(lines.Bytes(), &letter); err != nil {
+			return nil, err
+		}
+		store.memory.StoreDeadLetter(letter)
+	}
+
+	return store, lines.Err()
+}
+
+// StoreDeadLetter appends letter to the store's file, unless a letter
+// for the same projection and event has been recorded already.
+func (self *DeadLettersOnDisk) StoreDeadLetter(letter DeadLetter) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	self.memory.mutex.Lock()
+	seen := self.memory.seen[letter.key()]
+	self.memory.mutex.Unlock()
+	if seen {
+		return nil
+	}
+
+	data, err := json.Marshal(letter)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(self.filename), 0700); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(self.filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if _, err := out.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	return self.memory.StoreDeadLetter(letter)
+}
+
+// DeadLetters returns a copy of all recorded dead letters.
+func (self *DeadLettersOnDisk) DeadLetters() []DeadLetter {
+	return self.memory.DeadLetters()
+}
+
+// RetryingProjection passes events to a handler which can fail,
+// retrying failed events with exponential backoff.  Events which
+// still fail after all retries are recorded in a DeadLetterStore and
+// skipped, so that a single poison event neither blocks the
+// projection nor is lost silently.  Events recorded as dead letters
+// already, e.g. before the application has been restarted, are
+// skipped without passing them to the handler again.  Use a
+// persistent store such as DeadLettersOnDisk for this to work across
+// restarts.
+//
+// Since retrying waits for the backoff, register the projection using
+// Application.WithAsyncProjection, so that retries neither delay
+// sending commands nor exceed the application's projection timeout.
+type RetryingProjection struct {
+	name        string
+	handler     FallibleEventHandler
+	deadLetters DeadLetterStore
+	clock       Clock
+	logger      *log.Logger
+	retries     int
+	backoff     time.Duration
+
+	loadBuried sync.Once
+	buried     map[string]bool
+}
+
+// NewRetryingProjection returns a new projection called name passing
+// events to handler and recording events which cannot be handled in
+// deadLetters.
+func NewRetryingProjection(name string, handler FallibleEventHandler, deadLetters DeadLetterStore) *RetryingProjection {
+	return &RetryingProjection{
+		name:        name,
+		handler:     handler,
+		deadLetters: deadLetters,
+		clock:       SystemClock,
+		logger:      log.New(os.Stderr, name+" ", log.LstdFlags),
+		retries:     DeadLetterRetries,
+		backoff:     DeadLetterBackoff,
+	}
+}
+
+// WithRetries configures the projection to retry handling an event
+// up to retries times, waiting for backoff before the first retry.
+func (self *RetryingProjection) WithRetries(retries int, backoff time.Duration) *RetryingProjection {
+	self.retries = retries
+	self.backoff = backoff
+	return self
+}
+
+// WithClock sets the clock used for recording the time of failures
+// to clock.
+func (self *RetryingProjection) WithClock(clock Clock) *RetryingProjection {
+	self.clock = clock
+	return self
+}
+
+// WithLogger sets the logger used for reporting dead letters to
+// logger.
+func (self *RetryingProjection) WithLogger(logger *log.Logger) *RetryingProjection {
+	self.logger = logger
+	return self
+}
+
+// HandleEvent passes event to the projection's handler, retrying on
+// failure.  Once all attempts have failed, event is recorded as a
+// dead letter.  Events recorded as dead letters already are skipped.
+func (self *RetryingProjection) HandleEvent(event *Event) {
+	self.loadBuried.Do(func() {
+		self.buried = map[string]bool{}
+		for _, letter := range self.deadLetters.DeadLetters() {
+			if letter.Projection == self.name {
+				self.buried[letter.Event.Id] = true
+			}
+		}
+	})
+	if self.buried[event.Id] {
+		return
+	}
+
+	backoff := self.backoff
+	attempt := 0
+	for {
+		attempt++
+		err := self.handler.TryHandleEvent(event)
+		if err == nil {
+			return
+		}
+
+		if attempt > self.retries {
+			self.bury(event, attempt, err)
+			return
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// bury records event as a dead letter after it has failed attempts
+// times with err.
+func (self *RetryingProjection) bury(event *Event, attempts int, err error) {
+	self.logger.Printf("DEAD %s %s: %s", event.Name, event.Id, err)
+	self.buried[event.Id] = true
+
+	letter := DeadLetter{
+		Projection: self.name,
+		Event:      event,
+		Reason:     err.Error(),
+		Attempts:   attempts,
+		FailedAt:   self.clock.Now(),
+	}
+	if err := self.deadLetters.StoreDeadLetter(letter); err != nil {
+		self.logger.Printf("FAIL dead letter %s %s: %s", event.Name, event.Id, err)
+	}
+}
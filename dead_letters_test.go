@@ -0,0 +1,181 @@
+package ess
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRetryingProjection_HandleEvent_recordsDeadLetterAfterRetries(t *testing.T) {
+	attempts := 0
+	deadLetters := NewDeadLettersInMemory()
+	projection := NewRetryingProjection("search", FallibleEventHandlerFunc(func(event *Event) error {
+		attempts++
+		return errors.New("index unavailable")
+	}), deadLetters).
+		WithRetries(2, 0).
+		WithClock(&StaticClock{TheTime}).
+		WithLogger(log.New(NewLineWriter(&[]string{}), "", 0))
+
+	app := NewTestApp().WithAsyncProjection("search", projection)
+	event := NewEvent("test.run")
+	event.Id = "poison"
+	app.Project(event)
+	if err := app.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := attempts, 3; got != want {
+		t.Errorf("attempts = %d; want %d", got, want)
+	}
+
+	letters := deadLetters.DeadLetters()
+	if got, want := len(letters), 1; got != want {
+		t.Fatalf("len(letters) = %d; want %d", got, want)
+	}
+	expected := DeadLetter{
+		Projection: "search",
+		Event:      event,
+		Reason:     "index unavailable",
+		Attempts:   3,
+		FailedAt:   TheTime,
+	}
+	if got, want := letters[0], expected; got != want {
+		t.Errorf("letters[0] = %#v; want %#v", got, want)
+	}
+}
+
+func TestRetryingProjection_HandleEvent_recoversFromTransientFailures(t *testing.T) {
+	failures := 2
+	deadLetters := NewDeadLettersInMemory()
+	projection := NewRetryingProjection("search", FallibleEventHandlerFunc(func(event *Event) error {
+		if failures > 0 {
+			failures--
+			return errors.New("index unavailable")
+		}
+		return nil
+	}), deadLetters).WithRetries(2, 0)
+
+	projection.HandleEvent(NewEvent("test.run"))
+
+	if got, want := len(deadLetters.DeadLetters()), 0; got != want {
+		t.Errorf("len(deadLetters.DeadLetters()) = %d; want %d", got, want)
+	}
+}
+
+func TestRetryingProjection_HandleEvent_skipsEventsBuriedBeforeRestart(t *testing.T) {
+	filename := filepath.Join(os.TempDir(), fmt.Sprintf("dead-letters-%d.json", os.Getpid()))
+	defer os.Remove(filename)
+
+	attempts := 0
+	handler := FallibleEventHandlerFunc(func(event *Event) error {
+		attempts++
+		return errors.New("index unavailable")
+	})
+	event := NewEvent("test.run")
+	event.Id = "poison"
+
+	for restart := 0; restart < 2; restart++ {
+		deadLetters, err := NewDeadLettersOnDisk(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		projection := NewRetryingProjection("search", handler, deadLetters).
+			WithRetries(2, 0).
+			WithLogger(log.New(NewLineWriter(&[]string{}), "", 0))
+		projection.HandleEvent(event)
+		projection.HandleEvent(event)
+	}
+
+	if got, want := attempts, 3; got != want {
+		t.Errorf("attempts = %d; want %d", got, want)
+	}
+
+	deadLetters, err := NewDeadLettersOnDisk(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	letters := deadLetters.DeadLetters()
+	if got, want := len(letters), 1; got != want {
+		t.Fatalf("len(letters) = %d; want %d", got, want)
+	}
+	if got, want := letters[0].Event.Id, "poison"; got != want {
+		t.Errorf("letters[0].Event.Id = %q; want %q", got, want)
+	}
+}
+
+func TestDeadLettersInMemory_StoreDeadLetter_ignoresDuplicates(t *testing.T) {
+	deadLetters := NewDeadLettersInMemory()
+	event := NewEvent("test.run")
+	event.Id = "poison"
+
+	deadLetters.StoreDeadLetter(DeadLetter{Projection: "search", Event: event})
+	deadLetters.StoreDeadLetter(DeadLetter{Projection: "search", Event: event})
+	deadLetters.StoreDeadLetter(DeadLetter{Projection: "mail", Event: event})
+
+	if got, want := len(deadLetters.DeadLetters()), 2; got != want {
+		t.Errorf("len(deadLetters.DeadLetters()) = %d; want %d", got, want)
+	}
+}
+
+func TestDeadLettersOnDisk_StoreDeadLetter_writesConcurrentDuplicatesOnce(t *testing.T) {
+	filename := filepath.Join(os.TempDir(), fmt.Sprintf("dead-letters-concurrent-%d.json", os.Getpid()))
+	defer os.Remove(filename)
+
+	deadLetters, err := NewDeadLettersOnDisk(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := NewEvent("test.run")
+	event.Id = "poison"
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := deadLetters.StoreDeadLetter(DeadLetter{Projection: "search", Event: event}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Count(string(data), "\n"), 1; got != want {
+		t.Errorf("lines = %d; want %d", got, want)
+	}
+}
+
+func TestDeadLettersOnDisk_StoreDeadLetter_failsIfDirectoryCannotBeCreated(t *testing.T) {
+	parent := filepath.Join(os.TempDir(), fmt.Sprintf("dead-letters-parent-%d", os.Getpid()))
+	deadLetters, err := NewDeadLettersOnDisk(filepath.Join(parent, "dir", "dead-letters.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a file in place of the parent directory makes creating the
+	// directory fail
+	if err := ioutil.WriteFile(parent, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(parent)
+	event := NewEvent("test.run")
+	event.Id = "poison"
+
+	if err := deadLetters.StoreDeadLetter(DeadLetter{Projection: "search", Event: event}); err == nil {
+		t.Errorf("deadLetters.StoreDeadLetter: got no error")
+	}
+	if got, want := len(deadLetters.DeadLetters()), 0; got != want {
+		t.Errorf("len(deadLetters.DeadLetters()) = %d; want %d", got, want)
+	}
+}
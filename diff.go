@@ -0,0 +1,47 @@
+package ess
+
+import "sort"
+
+// FieldChange describes the change of a single field of an
+// aggregate's state.
+type FieldChange struct {
+	// Field is the name of the changed field.
+	Field string
+
+	// Old is the value of the field before the change.
+	Old string
+
+	// New is the value of the field after the change.
+	New string
+}
+
+// Diff compares the fields in new with the corresponding fields in
+// old and returns the changed fields, ordered by name.  Fields which
+// are missing from old are compared as empty strings; fields which
+// are missing from new are considered unchanged.
+//
+// Use Diff in aggregates for emitting events which only contain
+// changed fields, by comparing the aggregate's current state with
+// the fields of a command.  Emit no event if no field has changed:
+//
+//	changes := ess.Diff(
+//		map[string]string{"title": self.title, "body": self.body},
+//		map[string]string{"title": title, "body": body},
+//	)
+//	if len(changes) > 0 {
+//		self.events.PublishEvent(ess.NewEvent("post.edited").For(self).AddChanges(changes))
+//	}
+func Diff(old, new map[string]string) []FieldChange {
+	changes := []FieldChange{}
+	for field, value := range new {
+		if previous := old[field]; previous != value {
+			changes = append(changes, FieldChange{Field: field, Old: previous, New: value})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Field < changes[j].Field
+	})
+
+	return changes
+}
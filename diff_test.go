@@ -0,0 +1,60 @@
+package ess
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiff_returnsChangedFields(t *testing.T) {
+	testcases := []struct {
+		old, new map[string]string
+		changes  []FieldChange
+	}{
+		{
+			old:     map[string]string{"title": "Hello", "body": "World"},
+			new:     map[string]string{"title": "Hello", "body": "World"},
+			changes: []FieldChange{},
+		},
+		{
+			old:     map[string]string{"title": "Hello", "body": "World"},
+			new:     map[string]string{"title": "Goodbye", "body": "World"},
+			changes: []FieldChange{{Field: "title", Old: "Hello", New: "Goodbye"}},
+		},
+		{
+			old: map[string]string{"title": "Hello"},
+			new: map[string]string{"title": "Hello!", "body": "World"},
+			changes: []FieldChange{
+				{Field: "body", Old: "", New: "World"},
+				{Field: "title", Old: "Hello", New: "Hello!"},
+			},
+		},
+		{
+			old:     map[string]string{"title": "Hello", "body": "World"},
+			new:     map[string]string{"body": ""},
+			changes: []FieldChange{{Field: "body", Old: "World", New: ""}},
+		},
+		{
+			old:     map[string]string{},
+			new:     map[string]string{},
+			changes: []FieldChange{},
+		},
+	}
+
+	for _, testcase := range testcases {
+		if got, want := Diff(testcase.old, testcase.new), testcase.changes; !reflect.DeepEqual(got, want) {
+			t.Errorf("Diff(%v, %v) = %v; want %v", testcase.old, testcase.new, got, want)
+		}
+	}
+}
+
+func TestEvent_AddChanges_addsNewValues(t *testing.T) {
+	changes := Diff(
+		map[string]string{"title": "Hello", "body": "World"},
+		map[string]string{"title": "Goodbye", "body": "World"},
+	)
+	event := NewEvent("post.edited").AddChanges(changes)
+
+	if got, want := event.Payload, map[string]interface{}{"title": "Goodbye"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("event.Payload = %v; want %v", got, want)
+	}
+}
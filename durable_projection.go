@@ -0,0 +1,101 @@
+package ess
+
+import "log"
+
+// durableProjection passes events to a handler at least once, even
+// if the application stops between storing events and projecting
+// them.
+//
+// Every event stored after the projection's checkpoint is pending
+// delivery.  The checkpoint is advanced after the handler has
+// returned, and while replaying history in Application.Init all
+// events up to and including the checkpoint are skipped, so that
+// exactly the pending events are redelivered.
+//
+// A projection without a checkpoint, e.g. because it has just been
+// registered, starts at the head of the history: the events replayed
+// by Application.Init are not passed to the handler, and the last of
+// them becomes the projection's checkpoint.
+type durableProjection struct {
+	name        string
+	checkpoints CheckpointStore
+	handler     EventHandler
+	logger      *log.Logger
+
+	// head is true while the history is replayed through a
+	// projection without a checkpoint.  HeadId is the id of the
+	// last event replayed in the meantime.
+	head   bool
+	headId string
+
+	// checkpoint is the id of the last event recorded as the
+	// projection's checkpoint.
+	checkpoint string
+}
+
+// newDurableProjection returns a projection called name passing
+// events to handler and recording its progress in checkpoints.
+func newDurableProjection(name string, checkpoints CheckpointStore, handler EventHandler, logger *log.Logger) *durableProjection {
+	return &durableProjection{
+		name:        name,
+		checkpoints: checkpoints,
+		handler:     handler,
+		logger:      logger,
+	}
+}
+
+// LoadCheckpoint returns the id of the last event passed to the
+// projection's handler, so that only the events pending delivery are
+// passed to it while replaying history.
+func (self *durableProjection) LoadCheckpoint() (string, error) {
+	checkpoint, err := self.checkpoints.LoadCheckpoint(self.name)
+	self.head = err == nil && checkpoint == ""
+	self.headId = ""
+	self.checkpoint = checkpoint
+	return checkpoint, err
+}
+
+// Checkpoint returns the id of the last event recorded as the
+// projection's checkpoint.
+func (self *durableProjection) Checkpoint() string {
+	return self.checkpoint
+}
+
+// endReplay stops skipping the events of the replayed history.
+func (self *durableProjection) endReplay() {
+	self.head = false
+}
+
+// saveHead records the last event replayed through a projection
+// without a checkpoint as the projection's checkpoint.
+func (self *durableProjection) saveHead() error {
+	if self.headId == "" {
+		return nil
+	}
+
+	headId := self.headId
+	self.headId = ""
+	if err := self.checkpoints.SaveCheckpoint(self.name, headId); err != nil {
+		return err
+	}
+	self.checkpoint = headId
+	return nil
+}
+
+// HandleEvent passes event to the projection's handler and advances
+// the checkpoint.  While replaying the history through a projection
+// without a checkpoint, events are not passed to the handler.
+func (self *durableProjection) HandleEvent(event *Event) {
+	if self.head {
+		self.headId = event.Id
+		return
+	}
+
+	self.handler.HandleEvent(event)
+
+	if err := self.checkpoints.SaveCheckpoint(self.name, event.Id); err != nil {
+		self.logger.Printf("FAIL checkpoint %s of %s: %s", event.Id, self.name, err)
+		return
+	}
+	self.checkpoint = event.Id
+}
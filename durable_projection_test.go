@@ -0,0 +1,114 @@
+package ess
+
+import (
+	"reflect"
+	"testing"
+)
+
+func newTestEventWithId(id string) *Event {
+	event := NewEvent("test.event")
+	event.Id = id
+	return event
+}
+
+func recordEventIds(ids *[]string) EventHandler {
+	return EventHandlerFunc(func(event *Event) {
+		*ids = append(*ids, event.Id)
+	})
+}
+
+func TestApplication_WithDurableProjection_redeliversEventsAfterCrash(t *testing.T) {
+	store := NewEventsInMemory()
+	checkpoints := NewCheckpointsInMemory()
+
+	delivered := []string{}
+	app := NewTestApp().WithStore(store).
+		WithDurableProjection("mailer", checkpoints, recordEventIds(&delivered))
+	if err := app.Init(); err != nil {
+		t.Fatal(err)
+	}
+	history := []*Event{newTestEventWithId("1"), newTestEventWithId("2")}
+	store.Store(history)
+	for _, event := range history {
+		app.Project(event)
+	}
+
+	// Simulate a crash after storing events, but before projecting them.
+	store.Store([]*Event{newTestEventWithId("3"), newTestEventWithId("4")})
+
+	redelivered := []string{}
+	app = NewTestApp().WithStore(store).
+		WithDurableProjection("mailer", checkpoints, recordEventIds(&redelivered))
+	if err := app.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := delivered, []string{"1", "2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("delivered = %v; want %v", got, want)
+	}
+	if got, want := redelivered, []string{"3", "4"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("redelivered = %v; want %v", got, want)
+	}
+}
+
+func TestApplication_WithDurableProjection_failsInitIfCheckpointIsMissing(t *testing.T) {
+	store := NewEventsInMemory()
+	checkpoints := NewCheckpointsInMemory()
+	checkpoints.SaveCheckpoint("mailer", "deleted")
+	store.Store([]*Event{newTestEventWithId("1"), newTestEventWithId("2")})
+
+	delivered := []string{}
+	app := NewTestApp().WithStore(store).
+		WithDurableProjection("mailer", checkpoints, recordEventIds(&delivered))
+	if err := app.Init(); err != ErrCheckpointNotFound {
+		t.Errorf("app.Init() = %v; want %v", err, ErrCheckpointNotFound)
+	}
+
+	if got, want := delivered, []string{}; !reflect.DeepEqual(got, want) {
+		t.Errorf("delivered = %v; want %v", got, want)
+	}
+}
+
+func TestApplication_WithDurableProjection_startsAtHeadWithoutCheckpoint(t *testing.T) {
+	store := NewEventsInMemory()
+	checkpoints := NewCheckpointsInMemory()
+	store.Store([]*Event{newTestEventWithId("1"), newTestEventWithId("2")})
+
+	delivered := []string{}
+	app := NewTestApp().WithStore(store).
+		WithDurableProjection("mailer", checkpoints, recordEventIds(&delivered))
+	if err := app.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if checkpoint, _ := checkpoints.LoadCheckpoint("mailer"); checkpoint != "2" {
+		t.Errorf("checkpoint = %q; want %q", checkpoint, "2")
+	}
+	app.Project(newTestEventWithId("3"))
+
+	if got, want := delivered, []string{"3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("delivered = %v; want %v", got, want)
+	}
+}
+
+func TestApplication_WithDurableProjection_advancesCheckpoint(t *testing.T) {
+	checkpoints := NewCheckpointsInMemory()
+	delivered := []string{}
+	app := NewTestApp().
+		WithDurableProjection("mailer", checkpoints, recordEventIds(&delivered))
+	if err := app.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	app.Project(newTestEventWithId("1"))
+
+	checkpoint, err := checkpoints.LoadCheckpoint("mailer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := checkpoint, "1"; got != want {
+		t.Errorf("checkpoint = %q; want %q", got, want)
+	}
+	if got, want := delivered, []string{"1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("delivered = %v; want %v", got, want)
+	}
+}
@@ -0,0 +1,206 @@
+// Package essbolt provides an event store for applications built with
+// package ess, backed by an embedded bbolt database.
+//
+// It lives in its own package, so that applications not using it do
+// not depend on bbolt.
+package essbolt
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/dhamidi/ess"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	// eventsBucket contains all events, keyed by their position in
+	// the global order of events.
+	eventsBucket = []byte("events")
+
+	// streamsBucket contains one bucket per stream, listing the
+	// keys of the stream's events in eventsBucket.
+	streamsBucket = []byte("streams")
+)
+
+// Events is a persistent implementation of an ess.EventStore, backed
+// by an embedded bbolt database.
+//
+// Events are serialized as JSON and stored in a bucket holding all
+// events in the order they have been stored.  Additionally every
+// stream has a bucket referencing the stream's events, so that
+// replaying a single stream does not require reading all events.
+type Events struct {
+	db    *bolt.DB
+	clock ess.Clock
+}
+
+// NewEvents opens the database in file, creating it if
+// necessary, and returns a new instance storing events in it.  Clock
+// is used for marking events as persisted.
+//
+// Call Close to release the database once the store is no longer
+// needed.
+func NewEvents(file string, clock ess.Clock) (*Events, error) {
+	file = filepath.Clean(file)
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return nil, err
+	}
+
+	db, err := bolt.Open(file, 0600, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Events{
+		db:    db,
+		clock: clock,
+	}, nil
+}
+
+// Close closes the underlying database.
+func (self *Events) Close() error {
+	return self.db.Close()
+}
+
+// Store stores events in a single transaction, assigning stream
+// versions and sequence numbers to them.  Either all events are
+// stored or none.
+func (self *Events) Store(events []*ess.Event) error {
+	return self.db.Update(func(tx *bolt.Tx) error {
+		all, err := tx.CreateBucketIfNotExists(eventsBucket)
+		if err != nil {
+			return err
+		}
+		streams, err := tx.CreateBucketIfNotExists(streamsBucket)
+		if err != nil {
+			return err
+		}
+
+		for _, event := range events {
+			var stream *bolt.Bucket
+			if event.StreamId != "" {
+				stream, err = streams.CreateBucketIfNotExists([]byte(event.StreamId))
+				if err != nil {
+					return err
+				}
+				version, err := stream.NextSequence()
+				if err != nil {
+					return err
+				}
+				event.StreamVersion = int(version) - 1
+			}
+
+			seq, err := all.NextSequence()
+			if err != nil {
+				return err
+			}
+			event.Sequence = int64(seq)
+
+			event.Persist(self.clock)
+			data, err := json.Marshal(event)
+			if err != nil {
+				return err
+			}
+			key := make([]byte, 8)
+			binary.BigEndian.PutUint64(key, seq)
+
+			if err := all.Put(key, data); err != nil {
+				return err
+			}
+
+			if stream == nil {
+				continue
+			}
+			if err := stream.Put(key, []byte{}); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// DeleteStream removes all events with a matching stream id in a
+// single transaction.
+func (self *Events) DeleteStream(streamId string) error {
+	return self.db.Update(func(tx *bolt.Tx) error {
+		streams := tx.Bucket(streamsBucket)
+		if streams == nil || streams.Bucket([]byte(streamId)) == nil {
+			return nil
+		}
+
+		keys := [][]byte{}
+		err := streams.Bucket([]byte(streamId)).ForEach(func(key, _ []byte) error {
+			keys = append(keys, append([]byte{}, key...))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		all := tx.Bucket(eventsBucket)
+		for _, key := range keys {
+			if err := all.Delete(key); err != nil {
+				return err
+			}
+		}
+
+		return streams.DeleteBucket([]byte(streamId))
+	})
+}
+
+// Replay replays all events matching streamId using receiver.
+//
+// Events are read from the database first and then passed to
+// receiver, so that receiver may store new events.
+//
+// Use "*" as the streamId to match all events.
+func (self *Events) Replay(streamId string, receiver ess.EventHandler) error {
+	events := []*ess.Event{}
+	err := self.db.View(func(tx *bolt.Tx) error {
+		all := tx.Bucket(eventsBucket)
+		if all == nil {
+			return nil
+		}
+
+		decode := func(data []byte) error {
+			event := &ess.Event{}
+			if err := json.Unmarshal(data, event); err != nil {
+				return err
+			}
+			events = append(events, event)
+			return nil
+		}
+
+		if streamId == "*" {
+			return all.ForEach(func(key, data []byte) error {
+				return decode(data)
+			})
+		}
+
+		streams := tx.Bucket(streamsBucket)
+		if streams == nil {
+			return nil
+		}
+		stream := streams.Bucket([]byte(streamId))
+		if stream == nil {
+			return nil
+		}
+
+		return stream.ForEach(func(key, _ []byte) error {
+			return decode(all.Get(key))
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		receiver.HandleEvent(event)
+	}
+
+	return nil
+}
@@ -0,0 +1,32 @@
+package essbolt
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dhamidi/ess"
+)
+
+func TestEvents_EventStoreBehavior(t *testing.T) {
+	filename := filepath.Join(os.TempDir(), fmt.Sprintf("events-%d.bolt", os.Getpid()))
+	var store *Events
+	teardown := func() {
+		store.Close()
+		os.Remove(filename)
+	}
+	setup := func(t *testing.T) ess.EventStore {
+		var err error
+		store, err = NewEvents(filename, ess.SystemClock)
+		if err != nil {
+			t.Fatalf("Events setup [filename=%q]: %s", filename, err)
+		}
+		return store
+	}
+
+	suite := ess.NewEventStoreTest(setup)
+	suite.TearDown = teardown
+
+	suite.Run(t)
+}
@@ -0,0 +1,197 @@
+// Package esssearch provides a full-text search index of aggregates
+// for applications built with package ess, backed by bleve.
+//
+// It lives in its own package, so that applications not using it do
+// not depend on bleve.
+package esssearch
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/dhamidi/ess"
+)
+
+// Projection is a projection maintaining a full-text search index of
+// aggregates.
+//
+// For every event with one of the configured names, the fields of the
+// event's payload are merged into the document of the event's stream,
+// so that events carrying only the changed fields, e.g.
+// "post.edited", keep the other fields of the document.  Events
+// emitted by Application.DeleteStream remove the deleted stream's
+// document.
+//
+// Since handling events cannot fail, errors returned by the index are
+// logged.
+type Projection struct {
+	path    string
+	mapping mapping.IndexMapping
+	names   map[string]bool
+	logger  *log.Logger
+	index   bleve.Index
+}
+
+// NewProjection returns a new projection indexing the payload of
+// events called names using mapping.  The index is kept in the
+// directory path; an existing index is opened, so that the
+// application can be restarted.  If path is empty, the index is kept
+// in memory.
+//
+// Replaying the history through an existing index applies every
+// event again, in order, so the index ends up in the same state.
+//
+// Call Close to release the index once the projection is no longer
+// needed.
+func NewProjection(path string, mapping mapping.IndexMapping, names ...string) (*Projection, error) {
+	projection := &Projection{
+		path:    path,
+		mapping: mapping,
+		names:   map[string]bool{},
+		logger:  log.New(os.Stderr, "search ", log.LstdFlags),
+	}
+	for _, name := range names {
+		projection.names[name] = true
+	}
+
+	if err := projection.open(); err != nil {
+		return nil, err
+	}
+
+	return projection, nil
+}
+
+// open opens the index at the projection's path, creating a new,
+// empty index if it does not exist yet.
+func (self *Projection) open() error {
+	var (
+		index bleve.Index
+		err   error
+	)
+	if self.path == "" {
+		index, err = bleve.NewMemOnly(self.mapping)
+	} else {
+		index, err = bleve.Open(self.path)
+		if err == bleve.ErrorIndexPathDoesNotExist {
+			index, err = bleve.New(self.path, self.mapping)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	self.index = index
+	return nil
+}
+
+// WithLogger sets the logger used for reporting errors to logger.
+func (self *Projection) WithLogger(logger *log.Logger) *Projection {
+	self.logger = logger
+	return self
+}
+
+// HandleEvent indexes event if its name matches.
+func (self *Projection) HandleEvent(event *ess.Event) {
+	if event.Name == "stream.deleted" {
+		streamId, _ := event.Payload["stream_id"].(string)
+		if err := self.remove(streamId); err != nil {
+			self.logger.Printf("FAIL %s %s: %s", event.Name, event.Id, err)
+		}
+		return
+	}
+
+	if !self.names[event.Name] || event.StreamId == "" {
+		return
+	}
+
+	if err := self.merge(event.StreamId, event.Payload); err != nil {
+		self.logger.Printf("FAIL %s %s: %s", event.Name, event.Id, err)
+	}
+}
+
+// merge sets the fields of the document identified by id to the
+// values in fields and indexes the resulting document.  Since bleve
+// does not return the values of indexed fields, the whole document is
+// kept as internal data of the index.
+func (self *Projection) merge(id string, fields map[string]interface{}) error {
+	document := map[string]interface{}{}
+	data, err := self.index.GetInternal([]byte(id))
+	if err != nil {
+		return err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &document); err != nil {
+			return err
+		}
+	}
+
+	for field, value := range fields {
+		document[field] = value
+	}
+
+	data, err = json.Marshal(document)
+	if err != nil {
+		return err
+	}
+	if err := self.index.Index(id, document); err != nil {
+		return err
+	}
+	return self.index.SetInternal([]byte(id), data)
+}
+
+// remove removes the document identified by id from the index.
+func (self *Projection) remove(id string) error {
+	if err := self.index.Delete(id); err != nil {
+		return err
+	}
+	return self.index.DeleteInternal([]byte(id))
+}
+
+// Search returns the ids of all streams whose documents match query,
+// ordered by relevance.  The query uses bleve's query string syntax,
+// e.g. "+title:events go".
+func (self *Projection) Search(query string) ([]string, error) {
+	count, err := self.index.DocCount()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []string{}
+	if count == 0 {
+		return ids, nil
+	}
+
+	request := bleve.NewSearchRequestOptions(bleve.NewQueryStringQuery(query), int(count), 0, false)
+	result, err := self.index.Search(request)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, hit := range result.Hits {
+		ids = append(ids, hit.ID)
+	}
+	return ids, nil
+}
+
+// Reset discards the index and creates a new, empty one, so that the
+// projection can be rebuilt from history.
+func (self *Projection) Reset() error {
+	if err := self.index.Close(); err != nil {
+		return err
+	}
+	if self.path != "" {
+		if err := os.RemoveAll(self.path); err != nil {
+			return err
+		}
+	}
+
+	return self.open()
+}
+
+// Close closes the underlying index.
+func (self *Projection) Close() error {
+	return self.index.Close()
+}
@@ -0,0 +1,143 @@
+package esssearch
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/dhamidi/ess"
+)
+
+func newTestProjection(t *testing.T) *Projection {
+	projection, err := NewProjection("", bleve.NewIndexMapping(), "post.written", "post.edited")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return projection
+}
+
+func newPostEvent(name, id string, fields ...string) *ess.Event {
+	event := ess.NewEvent(name)
+	for i := 0; i < len(fields); i += 2 {
+		event.Add(fields[i], fields[i+1])
+	}
+	event.StreamId = id
+	return event
+}
+
+func newPostWritten(id, title, body string) *ess.Event {
+	return newPostEvent("post.written", id, "title", title, "body", body)
+}
+
+func TestProjection_Search_findsIndexedEvents(t *testing.T) {
+	projection := newTestProjection(t)
+	defer projection.Close()
+
+	projection.HandleEvent(newPostWritten("hello", "Hello world", "A first post"))
+	projection.HandleEvent(newPostWritten("events", "Event sourcing", "Storing events in Go"))
+	projection.HandleEvent(newPostEvent("post.viewed", "hello", "title", "events"))
+
+	ids, err := projection.Search("events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ids, []string{"events"}; !reflect.DeepEqual(got, want) {
+		t.Errorf(`Search("events") = %v; want %v`, got, want)
+	}
+
+	ids, err = projection.Search("post")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ids, []string{"hello"}; !reflect.DeepEqual(got, want) {
+		t.Errorf(`Search("post") = %v; want %v`, got, want)
+	}
+}
+
+func TestProjection_HandleEvent_mergesPartialPayloads(t *testing.T) {
+	projection := newTestProjection(t)
+	defer projection.Close()
+
+	projection.HandleEvent(newPostWritten("hello", "Hello world", "A first post"))
+	projection.HandleEvent(newPostEvent("post.edited", "hello", "title", "Goodbye world"))
+
+	for query, want := range map[string][]string{
+		"post":    {"hello"},
+		"goodbye": {"hello"},
+		"hello":   {},
+	} {
+		ids, err := projection.Search(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ids; !reflect.DeepEqual(got, want) {
+			t.Errorf(`Search(%q) = %v; want %v`, query, got, want)
+		}
+	}
+}
+
+func TestProjection_HandleEvent_removesDeletedStreams(t *testing.T) {
+	projection := newTestProjection(t)
+	defer projection.Close()
+
+	projection.HandleEvent(newPostWritten("hello", "Hello world", "A first post"))
+	projection.HandleEvent(ess.NewEvent("stream.deleted").Add("stream_id", "hello"))
+
+	ids, err := projection.Search("hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(ids), 0; got != want {
+		t.Errorf(`len(Search("hello")) = %d; want %d`, got, want)
+	}
+}
+
+func TestProjection_Reset_discardsIndex(t *testing.T) {
+	projection := newTestProjection(t)
+	defer projection.Close()
+
+	projection.HandleEvent(newPostWritten("hello", "Hello world", "A first post"))
+	if err := projection.Reset(); err != nil {
+		t.Fatal(err)
+	}
+
+	ids, err := projection.Search("hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(ids), 0; got != want {
+		t.Errorf(`len(Search("hello")) = %d; want %d`, got, want)
+	}
+}
+
+func TestNewProjection_opensExistingIndex(t *testing.T) {
+	path := filepath.Join(os.TempDir(), fmt.Sprintf("search-index-%d", os.Getpid()))
+	defer os.RemoveAll(path)
+
+	projection, err := NewProjection(path, bleve.NewIndexMapping(), "post.written", "post.edited")
+	if err != nil {
+		t.Fatal(err)
+	}
+	projection.HandleEvent(newPostWritten("hello", "Hello world", "A first post"))
+	if err := projection.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewProjection(path, bleve.NewIndexMapping(), "post.written", "post.edited")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	reopened.HandleEvent(newPostEvent("post.edited", "hello", "title", "Goodbye world"))
+
+	ids, err := reopened.Search("post")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := ids, []string{"hello"}; !reflect.DeepEqual(got, want) {
+		t.Errorf(`Search("post") = %v; want %v`, got, want)
+	}
+}
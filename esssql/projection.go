@@ -0,0 +1,151 @@
+// Package esssql provides a base for projections of applications
+// built with package ess, which maintain a read model in an SQL
+// database.
+//
+// It lives in its own package, so that applications not using it do
+// not depend on database/sql.
+package esssql
+
+import (
+	"database/sql"
+	"log"
+	"os"
+
+	"github.com/dhamidi/ess"
+)
+
+// Projection is a base for projections maintaining a read model in
+// an SQL database, e.g. SQLite.
+//
+// Every event is applied in a separate transaction, which also
+// records the id of the event in the table "checkpoint".  Projection
+// implements ess.PersistentProjection, so that when the
+// application's history is replayed on startup, events up to and
+// including the recorded event are skipped and only events after the
+// checkpoint are applied.  This relies on event ids being stable.  If
+// the checkpoint event has been removed from the event store,
+// Application.Init logs a warning and replays the whole history
+// through the projection, so apply should tolerate events applied
+// already.
+//
+// Since handling events cannot fail, an error returned while applying
+// an event is logged and the projection stops applying events, so
+// that the checkpoint is not advanced past the failed event.  Once
+// the cause has been fixed, restarting the application applies the
+// failed event and all events after it.  Use Err to find out whether
+// the projection has stopped.
+type Projection struct {
+	db     *sql.DB
+	name   string
+	apply  func(tx *sql.Tx, event *ess.Event) error
+	logger *log.Logger
+
+	checkpoint string
+	err        error
+}
+
+// NewProjection returns a new projection named name, applying events
+// to db using apply.  The table "checkpoint" is created in db if
+// necessary and the projection's last checkpoint is loaded from it.
+//
+// Multiple projections can share a database as long as their names
+// are different.
+func NewProjection(db *sql.DB, name string, apply func(tx *sql.Tx, event *ess.Event) error) (*Projection, error) {
+	projection := &Projection{
+		db:     db,
+		name:   name,
+		apply:  apply,
+		logger: log.New(os.Stderr, name+" ", log.LstdFlags),
+	}
+
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS checkpoint (projection TEXT PRIMARY KEY, event_id TEXT NOT NULL)`)
+	if err != nil {
+		return nil, err
+	}
+
+	if projection.checkpoint, err = projection.LoadCheckpoint(); err != nil {
+		return nil, err
+	}
+
+	return projection, nil
+}
+
+// WithLogger sets the logger used for reporting errors to logger.
+func (self *Projection) WithLogger(logger *log.Logger) *Projection {
+	self.logger = logger
+	return self
+}
+
+// Checkpoint returns the id of the last event applied by this
+// projection.
+func (self *Projection) Checkpoint() string {
+	return self.checkpoint
+}
+
+// Err returns the error which stopped the projection from applying
+// events, if any.
+func (self *Projection) Err() error {
+	return self.err
+}
+
+// LoadCheckpoint returns the id of the last event applied by this
+// projection, as recorded in the database.
+func (self *Projection) LoadCheckpoint() (string, error) {
+	checkpoint := ""
+	err := self.db.QueryRow(`SELECT event_id FROM checkpoint WHERE projection = ?`, self.name).Scan(&checkpoint)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+	return checkpoint, nil
+}
+
+// HandleEvent applies event and advances the checkpoint in a single
+// transaction.  Events are not applied anymore once applying an event
+// has failed.
+func (self *Projection) HandleEvent(event *ess.Event) {
+	if self.err != nil {
+		self.logger.Printf("SKIP %s %s: stopped at %s", event.Name, event.Id, self.checkpoint)
+		return
+	}
+
+	if err := self.handle(event); err != nil {
+		self.logger.Printf("FAIL %s %s: %s", event.Name, event.Id, err)
+		self.err = err
+		return
+	}
+
+	self.checkpoint = event.Id
+}
+
+// handle applies event and records it as the checkpoint.
+func (self *Projection) handle(event *ess.Event) error {
+	tx, err := self.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := self.apply(tx, event); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	result, err := tx.Exec(`UPDATE checkpoint SET event_id = ? WHERE projection = ?`, event.Id, self.name)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if updated == 0 {
+		_, err = tx.Exec(`INSERT INTO checkpoint (projection, event_id) VALUES (?, ?)`, self.name, event.Id)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,145 @@
+package esssql
+
+import (
+	"database/sql"
+	"errors"
+	"io/ioutil"
+	"log"
+	"testing"
+
+	"github.com/dhamidi/ess"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func newTestDatabase(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection to ":memory:" opens a new database.
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(`CREATE TABLE users (name TEXT)`); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func newTestProjection(t *testing.T, db *sql.DB) *Projection {
+	projection, err := NewProjection(db, "users", func(tx *sql.Tx, event *ess.Event) error {
+		name, ok := event.Payload["name"].(string)
+		if !ok {
+			return errors.New("missing name")
+		}
+		_, err := tx.Exec(`INSERT INTO users (name) VALUES (?)`, name)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return projection.WithLogger(log.New(ioutil.Discard, "", 0))
+}
+
+func countUsers(t *testing.T, db *sql.DB) int {
+	count := 0
+	if err := db.QueryRow(`SELECT COUNT(*) FROM users`).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func newTestApp(store ess.EventStore) *ess.Application {
+	return ess.NewApplication("test").
+		WithStore(store).
+		WithLogger(log.New(ioutil.Discard, "", 0))
+}
+
+func newUserEvent(id, name string) *ess.Event {
+	event := ess.NewEvent("user.signed-up").Add("name", name)
+	event.Id = id
+	return event
+}
+
+func TestProjection_HandleEvent_advancesCheckpoint(t *testing.T) {
+	db := newTestDatabase(t)
+	projection := newTestProjection(t, db)
+
+	projection.HandleEvent(newUserEvent("1", "alice"))
+	projection.HandleEvent(newUserEvent("2", "bob"))
+
+	if got, want := projection.Checkpoint(), "2"; got != want {
+		t.Errorf("projection.Checkpoint() = %q; want %q", got, want)
+	}
+
+	if got, want := countUsers(t, db), 2; got != want {
+		t.Errorf("countUsers() = %d; want %d", got, want)
+	}
+}
+
+func TestProjection_HandleEvent_stopsAfterError(t *testing.T) {
+	db := newTestDatabase(t)
+	projection := newTestProjection(t, db)
+
+	projection.HandleEvent(newUserEvent("1", "alice"))
+	projection.HandleEvent(ess.NewEvent("user.signed-up"))
+	projection.HandleEvent(newUserEvent("3", "carol"))
+
+	if got, want := projection.Checkpoint(), "1"; got != want {
+		t.Errorf("projection.Checkpoint() = %q; want %q", got, want)
+	}
+
+	if got, want := countUsers(t, db), 1; got != want {
+		t.Errorf("countUsers() = %d; want %d", got, want)
+	}
+
+	if projection.Err() == nil {
+		t.Errorf("projection.Err() = %v; want an error", nil)
+	}
+}
+
+func TestProjection_resumesAfterCheckpoint(t *testing.T) {
+	db := newTestDatabase(t)
+	store := ess.NewEventsInMemory()
+	store.Store([]*ess.Event{newUserEvent("1", "alice"), newUserEvent("2", "bob")})
+
+	projection := newTestProjection(t, db)
+	if err := newTestApp(store).WithProjection("users", projection).Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	store.Store([]*ess.Event{newUserEvent("3", "carol")})
+	restarted := newTestProjection(t, db)
+	if got, want := restarted.Checkpoint(), "2"; got != want {
+		t.Errorf("restarted.Checkpoint() = %q; want %q", got, want)
+	}
+
+	if err := newTestApp(store).WithProjection("users", restarted).Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := countUsers(t, db), 3; got != want {
+		t.Errorf("countUsers() = %d; want %d", got, want)
+	}
+
+	if got, want := restarted.Checkpoint(), "3"; got != want {
+		t.Errorf("restarted.Checkpoint() = %q; want %q", got, want)
+	}
+}
+
+func TestProjection_appliesFullHistoryIfCheckpointIsMissing(t *testing.T) {
+	db := newTestDatabase(t)
+	newTestProjection(t, db).HandleEvent(newUserEvent("deleted", "mallory"))
+
+	store := ess.NewEventsInMemory()
+	store.Store([]*ess.Event{newUserEvent("1", "alice"), newUserEvent("2", "bob")})
+	app := newTestApp(store).WithProjection("users", newTestProjection(t, db))
+	if err := app.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := countUsers(t, db), 3; got != want {
+		t.Errorf("countUsers() = %d; want %d", got, want)
+	}
+}
@@ -0,0 +1,73 @@
+// Package esstest provides helpers for testing applications built
+// with package ess.
+package esstest
+
+import "github.com/dhamidi/ess"
+
+// Recorder records events, either as an event publisher for
+// aggregates or as a projection.  Use it to make assertions about the
+// events emitted by your aggregates.
+//
+// Example:
+//
+//	recorder := esstest.NewRecorder()
+//	user.PublishWith(recorder)
+//	user.SignUp("Jane Doe", "jane.doe@example.com", "password")
+//	recorder.AssertEmittedInOrder(t, "user.signed-up")
+type Recorder struct {
+	events []*ess.Event
+}
+
+// NewRecorder returns a new recorder which has not recorded any
+// events yet.
+func NewRecorder() *Recorder {
+	return &Recorder{
+		events: []*ess.Event{},
+	}
+}
+
+// PublishEvent records event.  This method is implemented to satisfy
+// the ess.EventPublisher interface.
+func (self *Recorder) PublishEvent(event *ess.Event) ess.EventPublisher {
+	self.events = append(self.events, event)
+	return self
+}
+
+// HandleEvent records event.  This method is implemented to satisfy
+// the ess.EventHandler interface.
+func (self *Recorder) HandleEvent(event *ess.Event) {
+	self.events = append(self.events, event)
+}
+
+// Events returns all recorded events in the order they have been
+// recorded.
+func (self *Recorder) Events() []*ess.Event {
+	return self.events
+}
+
+// Names returns the names of all recorded events in the order they
+// have been recorded.
+func (self *Recorder) Names() []string {
+	names := make([]string, len(self.events))
+	for i, event := range self.events {
+		names[i] = event.Name
+	}
+	return names
+}
+
+// AssertEmittedInOrder fails t unless exactly the events identified
+// by names have been recorded, in the given order.
+func (self *Recorder) AssertEmittedInOrder(t ess.TestingT, names ...string) {
+	got, want := self.Names(), names
+	if len(got) != len(want) {
+		t.Errorf("recorded events = %q; want %q", got, want)
+		return
+	}
+
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("recorded events = %q; want %q", got, want)
+			return
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package esstest
+
+import (
+	"testing"
+
+	"github.com/dhamidi/ess"
+)
+
+type failureRecorder struct{ failed bool }
+
+func (self *failureRecorder) Errorf(format string, args ...interface{}) { self.failed = true }
+
+func TestRecorder_AssertEmittedInOrder_passesForEventsInOrder(t *testing.T) {
+	recorder := NewRecorder()
+	recorder.PublishEvent(ess.NewEvent("test.first"))
+	recorder.PublishEvent(ess.NewEvent("test.second"))
+	recorder.HandleEvent(ess.NewEvent("test.third"))
+
+	recorder.AssertEmittedInOrder(t, "test.first", "test.second", "test.third")
+}
+
+func TestRecorder_AssertEmittedInOrder_failsForEventsOutOfOrder(t *testing.T) {
+	recorder := NewRecorder()
+	recorder.PublishEvent(ess.NewEvent("test.second"))
+	recorder.PublishEvent(ess.NewEvent("test.first"))
+
+	inner := &failureRecorder{}
+	recorder.AssertEmittedInOrder(inner, "test.first", "test.second")
+
+	if !inner.failed {
+		t.Errorf("AssertEmittedInOrder did not fail")
+	}
+}
@@ -1,9 +1,28 @@
 package ess
 
-import "time"
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"time"
+)
 
 // Event represents a state change that has occurred.  Events are
 // named in the past tense, e.g. "user.signed-up".
+//
+// Events are encoded as JSON objects using the following keys:
+//
+//	id              Id
+//	stream_id       StreamId
+//	stream_version  StreamVersion, omitted if zero
+//	sequence        Sequence, omitted if zero
+//	correlation_id  CorrelationId, omitted if empty
+//	causation_id    CausationId, omitted if empty
+//	name            Name
+//	occurred_on     OccurredOn
+//	persisted_at    PersistedAt
+//	payload         Payload
+//	metadata        Metadata, omitted if empty
 type Event struct {
 	// Id is the unique identifier of this event.
 	Id string
@@ -12,6 +31,29 @@ type Event struct {
 	// event.
 	StreamId string
 
+	// StreamVersion is the position of this event within its
+	// stream, i.e. the number of events stored for the stream
+	// before this event.  It is assigned by the event store when
+	// the event is stored.  Events without a stream id have no
+	// version.
+	StreamVersion int
+
+	// Sequence is the position of this event among all events
+	// of the event store, starting at 1.  It is assigned by the
+	// event store when the event is stored and reproduces the
+	// order in which events have been stored, even if they share
+	// the same time of occurrence.  Events stored before sequence
+	// numbers were introduced have a sequence of zero.
+	Sequence int64
+
+	// CorrelationId is shared by all events resulting from the
+	// same request.
+	CorrelationId string
+
+	// CausationId is the id of the command that caused this
+	// event.
+	CausationId string
+
 	// Name names the type of the event.
 	Name string
 
@@ -26,6 +68,13 @@ type Event struct {
 	// Payload is additional data that needed to be recorded with
 	// the event in order to reconstruct state.
 	Payload map[string]interface{}
+
+	// Metadata is infrastructure data recorded with the event,
+	// e.g. the address of the client that sent the command
+	// causing the event.  Unlike Payload, it is not needed for
+	// reconstructing state and aggregates should not depend on
+	// it.
+	Metadata map[string]string
 }
 
 // NewEvent creates a new, empty event of type name.
@@ -36,18 +85,84 @@ func NewEvent(name string) *Event {
 	}
 }
 
+// Copy returns a copy of this event.  The payload is copied
+// shallowly.
+func (self *Event) Copy() *Event {
+	event := *self
+	event.Payload = make(map[string]interface{}, len(self.Payload))
+	for field, value := range self.Payload {
+		event.Payload[field] = value
+	}
+	if self.Metadata != nil {
+		event.Metadata = make(map[string]string, len(self.Metadata))
+		for key, value := range self.Metadata {
+			event.Metadata[key] = value
+		}
+	}
+	return &event
+}
+
 // For marks the event as being emitted by source.
 func (self *Event) For(source Aggregate) *Event {
 	self.StreamId = source.Id()
 	return self
 }
 
+// CausedBy marks the event as being caused by command, recording the
+// command's id and correlation id.
+func (self *Event) CausedBy(command *Command) *Event {
+	self.CorrelationId = command.CorrelationId
+	self.CausationId = command.Id
+	return self
+}
+
 // Add sets the payload for the field name to value.
 func (self *Event) Add(name string, value interface{}) *Event {
 	self.Payload[name] = value
 	return self
 }
 
+// AddFields adds the string representation of each of the named
+// fields of command to the event's payload.  Optional fields which
+// have not been set and fields not defined by command are skipped.
+//
+// Example:
+//
+//	NewEvent("user.profile-updated").For(user).
+//		AddFields(command, "name", "bio")
+func (self *Event) AddFields(command *Command, fields ...string) *Event {
+	for _, field := range fields {
+		value := command.Get(field)
+		if value == nil {
+			continue
+		}
+		if optional, ok := value.(*OptionalValue); ok && !optional.IsSet() {
+			continue
+		}
+
+		self.Payload[field] = value.String()
+	}
+	return self
+}
+
+// AddChanges adds the new value of every change in changes to the
+// event's payload, using the changed field's name as the key.
+func (self *Event) AddChanges(changes []FieldChange) *Event {
+	for _, change := range changes {
+		self.Payload[change.Field] = change.New
+	}
+	return self
+}
+
+// WithMeta sets the metadata for key to value.
+func (self *Event) WithMeta(key, value string) *Event {
+	if self.Metadata == nil {
+		self.Metadata = map[string]string{}
+	}
+	self.Metadata[key] = value
+	return self
+}
+
 // Occur marks the occurrence time of the event according to clock.
 func (self *Event) Occur(clock Clock) *Event {
 	self.OccurredOn = clock.Now()
@@ -55,7 +170,140 @@ func (self *Event) Occur(clock Clock) *Event {
 }
 
 // Persist marks the time of persisting the event according to clock.
+// Events which have been persisted before keep their original time,
+// so that copying events between stores preserves it.
 func (self *Event) Persist(clock Clock) *Event {
-	self.PersistedAt = clock.Now()
+	if self.PersistedAt.IsZero() {
+		self.PersistedAt = clock.Now()
+	}
 	return self
 }
+
+// eventJSON defines the JSON representation of an event.
+type eventJSON struct {
+	Id            string                 `json:"id"`
+	StreamId      string                 `json:"stream_id"`
+	StreamVersion int                    `json:"stream_version,omitempty"`
+	Sequence      int64                  `json:"sequence,omitempty"`
+	CorrelationId string                 `json:"correlation_id,omitempty"`
+	CausationId   string                 `json:"causation_id,omitempty"`
+	Name          string                 `json:"name"`
+	OccurredOn    time.Time              `json:"occurred_on"`
+	PersistedAt   time.Time              `json:"persisted_at"`
+	Payload       map[string]interface{} `json:"payload"`
+	Metadata      map[string]string      `json:"metadata,omitempty"`
+}
+
+// legacyEventJSON captures the keys used for encoding events before
+// the JSON representation of events has been defined explicitly.
+// The keys "Id", "Name" and "Payload" are matched by eventJSON
+// already.
+type legacyEventJSON struct {
+	StreamId      string    `json:"StreamId"`
+	CorrelationId string    `json:"CorrelationId"`
+	CausationId   string    `json:"CausationId"`
+	OccurredOn    time.Time `json:"OccurredOn"`
+	PersistedAt   time.Time `json:"PersistedAt"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (self *Event) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&eventJSON{
+		Id:            self.Id,
+		StreamId:      self.StreamId,
+		StreamVersion: self.StreamVersion,
+		Sequence:      self.Sequence,
+		CorrelationId: self.CorrelationId,
+		CausationId:   self.CausationId,
+		Name:          self.Name,
+		OccurredOn:    self.OccurredOn,
+		PersistedAt:   self.PersistedAt,
+		Payload:       self.Payload,
+		Metadata:      self.Metadata,
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+//
+// Events encoded using the Go field names as keys, as written by
+// earlier versions of this package, are accepted as well.
+//
+// Integral numbers in the payload are decoded as int, all other
+// numbers as float64, so that events read from a store have the same
+// payload types as the events originally stored.
+//
+// This is a breaking change: earlier versions decoded all numbers as
+// float64.  Since JSON does not distinguish 3.0 from 3, integral
+// float64 values, including the numbers in the payloads of events
+// created by NewTypedEvent, are decoded as int as well.  Code
+// asserting payload numbers to be float64 panics on such values; use
+// a type switch handling both int and float64, or DecodePayload.
+func (self *Event) UnmarshalJSON(data []byte) error {
+	current, legacy := eventJSON{}, legacyEventJSON{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&current); err != nil {
+		return err
+	}
+	for field, value := range current.Payload {
+		current.Payload[field] = decodeNumbers(value)
+	}
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return err
+	}
+
+	if current.StreamId == "" {
+		current.StreamId = legacy.StreamId
+	}
+	if current.CorrelationId == "" {
+		current.CorrelationId = legacy.CorrelationId
+	}
+	if current.CausationId == "" {
+		current.CausationId = legacy.CausationId
+	}
+	if current.OccurredOn.IsZero() {
+		current.OccurredOn = legacy.OccurredOn
+	}
+	if current.PersistedAt.IsZero() {
+		current.PersistedAt = legacy.PersistedAt
+	}
+
+	*self = Event{
+		Id:            current.Id,
+		StreamId:      current.StreamId,
+		StreamVersion: current.StreamVersion,
+		Sequence:      current.Sequence,
+		CorrelationId: current.CorrelationId,
+		CausationId:   current.CausationId,
+		Name:          current.Name,
+		OccurredOn:    current.OccurredOn,
+		PersistedAt:   current.PersistedAt,
+		Payload:       current.Payload,
+		Metadata:      current.Metadata,
+	}
+	return nil
+}
+
+// decodeNumbers replaces the instances of json.Number contained in
+// value with int if the number is integral and fits, and with float64
+// otherwise.
+func decodeNumbers(value interface{}) interface{} {
+	switch value := value.(type) {
+	case json.Number:
+		if n, err := strconv.Atoi(value.String()); err == nil {
+			return n
+		}
+		f, _ := value.Float64()
+		return f
+	case map[string]interface{}:
+		for key, element := range value {
+			value[key] = decodeNumbers(element)
+		}
+	case []interface{}:
+		for i, element := range value {
+			value[i] = decodeNumbers(element)
+		}
+	}
+
+	return value
+}
@@ -0,0 +1,131 @@
+package ess
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// EventFeed serves the events of an event store over HTTP as a
+// stream of JSON objects, one per line, e.g. for debugging or for
+// feeding external consumers.
+//
+// The following query parameters are supported:
+//
+//	stream=ID  only send events of the stream ID
+//	since=N    only send events with a stream version of at least N
+//	follow=1   keep the connection open and send new events
+//
+// Without a stream, since refers to the events' Sequence instead of
+// their stream version, see ReplaySince.
+//
+// Following requires a source of new events, see Follow.
+//
+// Since the response has started once events are being sent, an
+// error encountered while replaying the stored events is reported in
+// the trailer X-Replay-Error, like EventStoreHandler does.
+type EventFeed struct {
+	store  EventStore
+	source Subscribable
+}
+
+// EventFeedHandler returns a new feed serving the events in store.
+func EventFeedHandler(store EventStore) *EventFeed {
+	return &EventFeed{
+		store: store,
+	}
+}
+
+// Follow configures the feed to send new events received from
+// source, typically the application storing events in the feed's
+// store, to clients requesting to follow the feed.
+//
+// Since the subscription starts before the stored events are sent,
+// events stored in the meantime might be sent twice.
+//
+// New events are received like by Application.Subscribe: up to
+// SubscriptionBufferSize events are buffered for every client, and
+// new events are dropped for clients which do not keep up, instead
+// of delaying commands.  Clients which need every event should
+// request the feed again once they detect a gap in the sequence
+// numbers of the events they receive.
+func (self *EventFeed) Follow(source Subscribable) *EventFeed {
+	self.source = source
+	return self
+}
+
+// ServeHTTP implements http.Handler.
+func (self *EventFeed) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := req.URL.Query()
+	stream := query.Get("stream")
+	if stream == "" {
+		stream = "*"
+	}
+	since := 0
+	if text := query.Get("since"); text != "" {
+		version, err := strconv.Atoi(text)
+		if err != nil || version < 0 {
+			http.Error(w, "malformed since", http.StatusBadRequest)
+			return
+		}
+		since = version
+	}
+	follow := query.Get("follow") != "" && query.Get("follow") != "0"
+	if follow && self.source == nil {
+		http.Error(w, "following not supported", http.StatusBadRequest)
+		return
+	}
+
+	var live <-chan *Event
+	if follow {
+		events, cancel := self.source.Subscribe()
+		defer cancel()
+		live = events
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Trailer", replayErrorTrailer)
+	enc := json.NewEncoder(w)
+	send := func(event *Event) {
+		enc.Encode(event)
+	}
+	matches := func(event *Event) bool {
+		if stream == "*" {
+			return event.Sequence >= int64(since)
+		}
+		return event.StreamId == stream && event.StreamVersion >= since
+	}
+
+	if err := ReplaySince(self.store, stream, since, EventHandlerFunc(send)); err != nil {
+		w.Header().Set(replayErrorTrailer, err.Error())
+		return
+	}
+	if !follow {
+		return
+	}
+
+	flusher, _ := w.(http.Flusher)
+	for {
+		if flusher != nil {
+			flusher.Flush()
+		}
+
+		select {
+		case event, ok := <-live:
+			if !ok {
+				return
+			}
+			if matches(event) {
+				send(event)
+			}
+		case <-req.Context().Done():
+			return
+		}
+	}
+}
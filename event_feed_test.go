@@ -0,0 +1,132 @@
+package ess
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// readFeed returns the names and stream versions of the events sent
+// by the feed at url.
+func readFeed(t *testing.T, url string) []string {
+	response, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	if got, want := response.StatusCode, http.StatusOK; got != want {
+		t.Fatalf("response.StatusCode = %d; want %d", got, want)
+	}
+
+	events := []string{}
+	lines := bufio.NewScanner(response.Body)
+	for lines.Scan() {
+		event := &Event{}
+		if err := json.Unmarshal(lines.Bytes(), event); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, event.StreamId+"/"+event.Name)
+	}
+	return events
+}
+
+func newTestFeedStore() *EventsInMemory {
+	store := NewEventsInMemory()
+	store.Store([]*Event{
+		NewEvent("test.run-1").For(newTestAggregate("id")),
+		NewEvent("test.run-1").For(newTestAggregate("other")),
+		NewEvent("test.run-2").For(newTestAggregate("id")),
+	})
+	return store
+}
+
+func TestEventFeed_ServeHTTP_streamsAllEvents(t *testing.T) {
+	server := httptest.NewServer(EventFeedHandler(newTestFeedStore()))
+	defer server.Close()
+
+	want := []string{"id/test.run-1", "other/test.run-1", "id/test.run-2"}
+	if got := readFeed(t, server.URL); !reflect.DeepEqual(got, want) {
+		t.Errorf("readFeed() = %v; want %v", got, want)
+	}
+}
+
+func TestEventFeed_ServeHTTP_filtersByStreamAndVersion(t *testing.T) {
+	server := httptest.NewServer(EventFeedHandler(newTestFeedStore()))
+	defer server.Close()
+
+	if got, want := readFeed(t, server.URL+"?stream=id"), []string{"id/test.run-1", "id/test.run-2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("readFeed(stream=id) = %v; want %v", got, want)
+	}
+	if got, want := readFeed(t, server.URL+"?stream=id&since=1"), []string{"id/test.run-2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("readFeed(stream=id&since=1) = %v; want %v", got, want)
+	}
+}
+
+func TestEventFeed_ServeHTTP_filtersAllStreamsBySequence(t *testing.T) {
+	server := httptest.NewServer(EventFeedHandler(newTestFeedStore()))
+	defer server.Close()
+
+	if got, want := readFeed(t, server.URL+"?since=2"), []string{"other/test.run-1", "id/test.run-2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("readFeed(since=2) = %v; want %v", got, want)
+	}
+}
+
+func TestEventFeed_ServeHTTP_streamsNewEventsWhenFollowing(t *testing.T) {
+	store := newTestFeedStore()
+	app := NewTestApp().WithStore(store)
+	server := httptest.NewServer(EventFeedHandler(store).Follow(app))
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "?follow=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	lines := bufio.NewScanner(response.Body)
+	for i := 0; i < len(store.Events()); i++ {
+		if !lines.Scan() {
+			t.Fatalf("stored event %d not received", i)
+		}
+	}
+
+	receivers := 0
+	if err := app.Send(newPublishingCommand(&receivers)).Error(); err != nil {
+		t.Fatal(err)
+	}
+	if !lines.Scan() {
+		t.Fatal("new event not received")
+	}
+
+	event := &Event{}
+	if err := json.Unmarshal(lines.Bytes(), event); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := event.StreamId+"/"+event.Name, "test/test.run"; got != want {
+		t.Errorf("event = %q; want %q", got, want)
+	}
+}
+
+func TestEventFeed_ServeHTTP_reportsReplayErrorsInTrailer(t *testing.T) {
+	store := &failingReplayStore{newTestFeedStore()}
+	server := httptest.NewServer(EventFeedHandler(store))
+	defer server.Close()
+
+	response, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if _, err := ioutil.ReadAll(response.Body); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := response.Trailer.Get(replayErrorTrailer), "disk on fire"; got != want {
+		t.Errorf("response.Trailer.Get(%q) = %q; want %q", replayErrorTrailer, got, want)
+	}
+}
@@ -0,0 +1,65 @@
+package ess
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+)
+
+// ImportBatchSize is the number of events passed to Store at once by
+// ImportEvents.
+const ImportBatchSize = 1000
+
+// ExportEvents writes all events in store to w in the JSON Lines
+// format, i.e. one JSON encoded event per line.  Use ImportEvents for
+// reading the events back, e.g. for migrating events to a different
+// store.
+func ExportEvents(store EventStore, w io.Writer) error {
+	out := bufio.NewWriter(w)
+	enc := json.NewEncoder(out)
+
+	var encodeErr error
+	err := store.Replay("*", EventHandlerFunc(func(event *Event) {
+		if encodeErr == nil {
+			encodeErr = enc.Encode(event)
+		}
+	}))
+	if err != nil {
+		return err
+	}
+	if encodeErr != nil {
+		return encodeErr
+	}
+
+	return out.Flush()
+}
+
+// ImportEvents reads events written by ExportEvents from r and
+// stores them in store, passing up to ImportBatchSize events to Store
+// at once.  Event ids and timestamps are preserved.
+func ImportEvents(store EventStore, r io.Reader) error {
+	dec := json.NewDecoder(r)
+	batch := []*Event{}
+	for {
+		event := &Event{}
+		if err := dec.Decode(event); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		batch = append(batch, event)
+		if len(batch) == ImportBatchSize {
+			if err := store.Store(batch); err != nil {
+				return err
+			}
+			batch = []*Event{}
+		}
+	}
+
+	if len(batch) > 0 {
+		return store.Store(batch)
+	}
+
+	return nil
+}
@@ -0,0 +1,49 @@
+package ess
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestExportEvents_roundTripsThroughImportEvents(t *testing.T) {
+	source := NewEventsInMemory()
+	for i := 0; i < 3; i++ {
+		event := NewEvent("test.run").For(newTestAggregate("id")).Add("count", fmt.Sprintf("%d", i))
+		event.Id = fmt.Sprintf("event-%d", i)
+		event.OccurredOn = time.Date(2015, 1, 2, 3, 4, i, 0, time.UTC)
+		event.PersistedAt = time.Date(2015, 1, 2, 3, 5, i, 0, time.UTC)
+		source.Store([]*Event{event})
+	}
+
+	filename := filepath.Join(os.TempDir(), fmt.Sprintf("events-import-%d.json", os.Getpid()))
+	defer os.Remove(filename)
+	target, err := NewEventsOnDisk(filename, SystemClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dump := new(bytes.Buffer)
+	if err := ExportEvents(source, dump); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := bytes.Count(dump.Bytes(), []byte("\n")), 3; got != want {
+		t.Errorf("lines in dump = %d; want %d", got, want)
+	}
+	if err := ImportEvents(target, dump); err != nil {
+		t.Fatal(err)
+	}
+
+	replayed := []*Event{}
+	if err := target.Replay("*", EventHandlerFunc(func(event *Event) { replayed = append(replayed, event) })); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := replayed, source.Events(); !reflect.DeepEqual(got, want) {
+		t.Errorf("replayed = %v; want %v", got, want)
+	}
+}
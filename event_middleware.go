@@ -0,0 +1,51 @@
+package ess
+
+// EventMiddleware transforms events on their way into and out of an
+// event store, e.g. for encrypting sensitive payload fields.
+//
+// Implementations must not modify the events passed to them, but
+// return modified copies instead.  Use Event.Copy for this purpose.
+type EventMiddleware interface {
+	// BeforeStore transforms event before it is stored.
+	BeforeStore(event *Event) (*Event, error)
+
+	// AfterLoad reverses the transformation done by BeforeStore
+	// on an event loaded from the store.
+	AfterLoad(event *Event) (*Event, error)
+}
+
+// eventMiddlewares is a chain of event middlewares.
+type eventMiddlewares []EventMiddleware
+
+// beforeStore passes each of events through all middlewares in
+// order, returning the transformed events.
+func (self eventMiddlewares) beforeStore(events []*Event) ([]*Event, error) {
+	if len(self) == 0 {
+		return events, nil
+	}
+
+	transformed := make([]*Event, len(events))
+	for i, event := range events {
+		for _, middleware := range self {
+			var err error
+			if event, err = middleware.BeforeStore(event); err != nil {
+				return nil, err
+			}
+		}
+		transformed[i] = event
+	}
+
+	return transformed, nil
+}
+
+// afterLoad passes event through all middlewares in reverse order.
+func (self eventMiddlewares) afterLoad(event *Event) (*Event, error) {
+	for i := len(self) - 1; i >= 0; i-- {
+		var err error
+		if event, err = self[i].AfterLoad(event); err != nil {
+			return nil, err
+		}
+	}
+
+	return event, nil
+}
@@ -0,0 +1,134 @@
+package ess
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// encryptingMiddleware encrypts the payload field "email" using
+// AES-GCM.
+type encryptingMiddleware struct {
+	aead cipher.AEAD
+}
+
+func newEncryptingMiddleware(t *testing.T) *encryptingMiddleware {
+	block, err := aes.NewCipher(bytes.Repeat([]byte{42}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &encryptingMiddleware{aead: aead}
+}
+
+func (self *encryptingMiddleware) BeforeStore(event *Event) (*Event, error) {
+	plaintext, ok := event.Payload["email"].(string)
+	if !ok {
+		return event, nil
+	}
+
+	nonce := make([]byte, self.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	encrypted := event.Copy()
+	encrypted.Payload["email"] = base64.StdEncoding.EncodeToString(self.aead.Seal(nonce, nonce, []byte(plaintext), nil))
+	return encrypted, nil
+}
+
+func (self *encryptingMiddleware) AfterLoad(event *Event) (*Event, error) {
+	encoded, ok := event.Payload["email"].(string)
+	if !ok {
+		return event, nil
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < self.aead.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	nonce, ciphertext := ciphertext[:self.aead.NonceSize()], ciphertext[self.aead.NonceSize():]
+	plaintext, err := self.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	decrypted := event.Copy()
+	decrypted.Payload["email"] = string(plaintext)
+	return decrypted, nil
+}
+
+func TestEventsOnDisk_Use_transformsEventsOnDisk(t *testing.T) {
+	filename := filepath.Join(os.TempDir(), fmt.Sprintf("events-middleware-%d.json", os.Getpid()))
+	defer os.Remove(filename)
+
+	store, err := NewEventsOnDisk(filename, SystemClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Use(newEncryptingMiddleware(t))
+
+	event := NewEvent("user.signed-up").For(newTestAggregate("id")).Add("email", "admin@example.com")
+	if err := store.Store([]*Event{event}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := event.Payload["email"], "admin@example.com"; got != want {
+		t.Errorf(`event.Payload["email"] = %v; want %v`, got, want)
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("admin@example.com")) {
+		t.Errorf("log file contains plaintext: %s", data)
+	}
+
+	replayed := []*Event{}
+	if err := store.Replay("id", EventHandlerFunc(func(event *Event) { replayed = append(replayed, event) })); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(replayed), 1; got != want {
+		t.Fatalf("len(replayed) = %d; want %d", got, want)
+	}
+	if got, want := replayed[0].Payload["email"], "admin@example.com"; got != want {
+		t.Errorf(`replayed[0].Payload["email"] = %v; want %v`, got, want)
+	}
+}
+
+func TestEventsInMemory_Use_transformsStoredEvents(t *testing.T) {
+	store := NewEventsInMemory().Use(newEncryptingMiddleware(t))
+
+	if err := store.Store([]*Event{NewEvent("user.signed-up").For(newTestAggregate("id")).Add("email", "admin@example.com")}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := store.Events()[0].Payload["email"]; got == "admin@example.com" {
+		t.Errorf("stored event contains plaintext")
+	}
+
+	events, err := store.Iterate("id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !events.Next() {
+		t.Fatalf("events.Next() = false; err = %v", events.Err())
+	}
+	if got, want := events.Event().Payload["email"], "admin@example.com"; got != want {
+		t.Errorf(`events.Event().Payload["email"] = %v; want %v`, got, want)
+	}
+}
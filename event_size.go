@@ -0,0 +1,65 @@
+package ess
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrEventTooLarge is returned when storing an event whose payload
+// exceeds the maximum size configured for an event store.  Event
+// stores return it wrapped in an *EventTooLargeError describing the
+// offending event; use errors.Is for comparing errors against it.
+var ErrEventTooLarge = errors.New("event_too_large")
+
+// EventTooLargeError describes an event whose payload exceeds the
+// maximum size configured for an event store.
+type EventTooLargeError struct {
+	// Name and Id identify the offending event.
+	Name string
+	Id   string
+
+	// Size is the size of the event's payload serialized as
+	// JSON and Limit the maximum size, both in bytes.
+	Size  int
+	Limit int
+}
+
+// Error implements the error interface.
+func (self *EventTooLargeError) Error() string {
+	return fmt.Sprintf("%s: %s %s: payload has %d bytes, limit is %d", ErrEventTooLarge, self.Name, self.Id, self.Size, self.Limit)
+}
+
+// Unwrap returns ErrEventTooLarge.
+func (self *EventTooLargeError) Unwrap() error {
+	return ErrEventTooLarge
+}
+
+// checkPayloadSizes returns an *EventTooLargeError if the serialized
+// payload of any of events is larger than max bytes.  A max of zero
+// or less disables the check.
+//
+// Payloads are measured as passed to the event store, before any
+// event middleware has transformed them.
+func checkPayloadSizes(max int, events []*Event) error {
+	if max <= 0 {
+		return nil
+	}
+
+	for _, event := range events {
+		data, err := json.Marshal(event.Payload)
+		if err != nil {
+			return err
+		}
+		if len(data) > max {
+			return &EventTooLargeError{
+				Name:  event.Name,
+				Id:    event.Id,
+				Size:  len(data),
+				Limit: max,
+			}
+		}
+	}
+
+	return nil
+}
@@ -1,9 +1,13 @@
 package ess
 
 import (
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -13,6 +17,30 @@ func TestEventsInMemory_EventStoreBehavior(t *testing.T) {
 	suite.Run(t)
 }
 
+func TestEventsInMemoryBounded_EventStoreBehavior(t *testing.T) {
+	setup := func(t *testing.T) EventStore { return NewEventsInMemoryBounded(100) }
+	suite := NewEventStoreTest(setup)
+	suite.Run(t)
+}
+
+func TestEventsInMemoryBounded_Store_evictsOldestEvents(t *testing.T) {
+	store := NewEventsInMemoryBounded(2)
+	for _, name := range []string{"a", "b", "c"} {
+		if err := store.Store([]*Event{NewEvent(name).For(newTestAggregate("id"))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	replayed := []string{}
+	if err := store.Replay("id", EventHandlerFunc(func(event *Event) { replayed = append(replayed, event.Name) })); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := replayed, []string{"b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("replayed = %v; want %v", got, want)
+	}
+}
+
 func TestEventsOnDisk_EventStoreBehavior(t *testing.T) {
 	filename := filepath.Join(os.TempDir(), fmt.Sprintf("events-%d.json", os.Getpid()))
 	teardown := func() {
@@ -31,3 +59,1002 @@ func TestEventsOnDisk_EventStoreBehavior(t *testing.T) {
 
 	suite.Run(t)
 }
+
+func TestEventsWithSnapshots_EventStoreBehavior(t *testing.T) {
+	dir := filepath.Join(os.TempDir(), fmt.Sprintf("events-with-snapshots-%d", os.Getpid()))
+	teardown := func() {
+		os.RemoveAll(dir)
+	}
+	setup := func(t *testing.T) EventStore {
+		store, err := NewEventsWithSnapshots(dir, SystemClock)
+		if err != nil {
+			t.Fatalf("EventsWithSnapshots setup [dir=%q]: %s", dir, err)
+		}
+		return store
+	}
+
+	suite := NewEventStoreTest(setup)
+	suite.TearDown = teardown
+
+	suite.Run(t)
+}
+
+func TestEventsWithSnapshots_reloadingReplaysSameEventsAsLog(t *testing.T) {
+	dir := filepath.Join(os.TempDir(), fmt.Sprintf("events-with-snapshots-reload-%d", os.Getpid()))
+	filename := filepath.Join(dir, "log.json")
+	defer os.RemoveAll(dir)
+
+	store, err := NewEventsWithSnapshots(dir, SystemClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log, err := NewEventsOnDisk(filename, SystemClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subject := newTestAggregate("id")
+	other := newTestAggregate("other")
+	for _, events := range [][]*Event{
+		{NewEvent("test.run-1").For(subject).Add("param", "value")},
+		{NewEvent("test.run-1").For(other), NewEvent("test.run-2").For(subject)},
+		{NewEvent("test.run-3").For(subject).Add("param", "new-value")},
+	} {
+		if err := store.Store(events); err != nil {
+			t.Fatal(err)
+		}
+		if err := log.Store(events); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reloaded, err := NewEventsWithSnapshots(dir, SystemClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replay := func(store EventStore) []string {
+		seen := []string{}
+		if err := store.Replay("*", EventHandlerFunc(func(event *Event) {
+			seen = append(seen, fmt.Sprintf("%s %s %v", event.StreamId, event.Name, event.Payload))
+		})); err != nil {
+			t.Fatal(err)
+		}
+		return seen
+	}
+
+	if got, want := replay(reloaded), replay(log); !reflect.DeepEqual(got, want) {
+		t.Errorf(`replay(reloaded) = %q; want %q`, got, want)
+	}
+}
+
+func TestEventsWithSnapshots_LoadSnapshot_returnsLatestSnapshotAfterReload(t *testing.T) {
+	dir := filepath.Join(os.TempDir(), fmt.Sprintf("events-with-snapshots-load-%d", os.Getpid()))
+	defer os.RemoveAll(dir)
+
+	store, err := NewEventsWithSnapshots(dir, SystemClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for version := 1; version <= 5; version++ {
+		snapshot := &Snapshot{AggregateType: "test", StreamId: "id", Version: version, Data: []byte("{}")}
+		if err := store.SaveSnapshot(snapshot); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reloaded, err := NewEventsWithSnapshots(dir, SystemClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := reloaded.LoadSnapshot("test", "id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot == nil {
+		t.Fatalf("snapshot = nil")
+	}
+	if got, want := snapshot.Version, 5; got != want {
+		t.Errorf("snapshot.Version = %d; want %d", got, want)
+	}
+	if got, want := reloaded.written, 2; got > want {
+		t.Errorf("reloaded.written = %d; want at most %d", got, want)
+	}
+}
+
+func TestEventsWithSnapshots_DeleteStream_removesSnapshots(t *testing.T) {
+	dir := filepath.Join(os.TempDir(), fmt.Sprintf("events-with-snapshots-delete-%d", os.Getpid()))
+	defer os.RemoveAll(dir)
+
+	store, err := NewEventsWithSnapshots(dir, SystemClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"id", "other"} {
+		snapshot := &Snapshot{AggregateType: "test", StreamId: id, Version: 1, Data: []byte("{}")}
+		if err := store.SaveSnapshot(snapshot); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.DeleteStream("id"); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := NewEventsWithSnapshots(dir, SystemClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot, _ := reloaded.LoadSnapshot("test", "id"); snapshot != nil {
+		t.Errorf("LoadSnapshot(%q) = %v; want nil", "id", snapshot)
+	}
+	if snapshot, _ := reloaded.LoadSnapshot("test", "other"); snapshot == nil {
+		t.Errorf("LoadSnapshot(%q) = nil; want snapshot", "other")
+	}
+}
+
+func TestEventsWithSnapshots_Store_keepsVersionsOfWrittenEvents(t *testing.T) {
+	dir := filepath.Join(os.TempDir(), fmt.Sprintf("events-with-snapshots-partial-%d", os.Getpid()))
+	defer os.RemoveAll(dir)
+
+	store, err := NewEventsWithSnapshots(dir, SystemClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subject := newTestAggregate("id")
+	unencodable := NewEvent("test.run").For(subject).Add("param", func() {})
+	if err := store.Store([]*Event{NewEvent("test.run").For(subject), unencodable}); err == nil {
+		t.Fatalf("store.Store: want an error")
+	}
+
+	event := NewEvent("test.run").For(subject)
+	if err := store.Store([]*Event{event}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := event.StreamVersion, 1; got != want {
+		t.Errorf("event.StreamVersion = %d; want %d", got, want)
+	}
+
+	reloaded, err := NewEventsWithSnapshots(dir, SystemClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions := []int{}
+	reloaded.Replay("id", EventHandlerFunc(func(event *Event) { versions = append(versions, event.StreamVersion) }))
+	if got, want := versions, []int{0, 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("versions = %v; want %v", got, want)
+	}
+}
+
+func TestEventsOnDisk_WithFsync_storesEventsDurably(t *testing.T) {
+	filename := filepath.Join(os.TempDir(), fmt.Sprintf("events-fsync-%d.json", os.Getpid()))
+	defer os.Remove(filename)
+
+	store, err := NewEventsOnDisk(filename, SystemClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := store.fsync, false; got != want {
+		t.Errorf("store.fsync = %v; want %v", got, want)
+	}
+
+	store.WithFsync(true)
+	if err := store.Store([]*Event{NewEvent("test.run").For(newTestAggregate("id"))}); err != nil {
+		t.Fatal(err)
+	}
+
+	seen := 0
+	if err := store.Replay("id", EventHandlerFunc(func(*Event) { seen++ })); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := seen, 1; got != want {
+		t.Errorf("seen = %d; want %d", got, want)
+	}
+}
+
+func TestEventsOnDisk_StoreBatch_storesLargeBatchesInOrder(t *testing.T) {
+	filename := filepath.Join(os.TempDir(), fmt.Sprintf("events-batch-%d.json", os.Getpid()))
+	defer os.Remove(filename)
+
+	store, err := NewEventsOnDisk(filename, SystemClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	batches := [][]*Event{}
+	for i := 0; i < 10; i++ {
+		batches = append(batches, newNumberedEvents(i*1000, 1000))
+	}
+	if err := store.StoreBatch(batches...); err != nil {
+		t.Fatal(err)
+	}
+
+	seen := 0
+	err = store.Replay("*", EventHandlerFunc(func(event *Event) {
+		if got, want := event.Payload["n"], seen; got != want {
+			t.Fatalf(`event.Payload["n"] = %v; want %v`, got, want)
+		}
+		seen++
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := seen, 10000; got != want {
+		t.Errorf("seen = %d; want %d", got, want)
+	}
+}
+
+func TestEventsOnDisk_Replay_decodesIntegersAsInt(t *testing.T) {
+	filename := filepath.Join(os.TempDir(), fmt.Sprintf("events-numbers-%d.json", os.Getpid()))
+	defer os.Remove(filename)
+
+	store, err := NewEventsOnDisk(filename, SystemClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event := NewEvent("test.counted").
+		Add("count", 42).
+		Add("ratio", 0.5).
+		Add("total", 3.0).
+		Add("sizes", []int{1, 2})
+	if err := store.Store([]*Event{event}); err != nil {
+		t.Fatal(err)
+	}
+
+	replayed := []*Event{}
+	if err := store.Replay("*", EventHandlerFunc(func(event *Event) {
+		replayed = append(replayed, event)
+	})); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(replayed), 1; got != want {
+		t.Fatalf("len(replayed) = %d; want %d", got, want)
+	}
+	payload := replayed[0].Payload
+	if got, ok := payload["count"].(int); !ok || got != 42 {
+		t.Errorf(`payload["count"] = %#v; want %#v`, payload["count"], 42)
+	}
+	if got, ok := payload["ratio"].(float64); !ok || got != 0.5 {
+		t.Errorf(`payload["ratio"] = %#v; want %#v`, payload["ratio"], 0.5)
+	}
+	// JSON does not distinguish integral floats from integers
+	if got, ok := payload["total"].(int); !ok || got != 3 {
+		t.Errorf(`payload["total"] = %#v; want %#v`, payload["total"], 3)
+	}
+	if got, want := payload["sizes"], []interface{}{1, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf(`payload["sizes"] = %#v; want %#v`, got, want)
+	}
+}
+
+func TestEventStores_WithMaxEventBytes_rejectsOversizedPayloads(t *testing.T) {
+	filename := filepath.Join(os.TempDir(), fmt.Sprintf("events-size-%d.json", os.Getpid()))
+	defer os.Remove(filename)
+	onDisk, err := NewEventsOnDisk(filename, SystemClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, store := range map[string]EventStore{
+		"memory": NewEventsInMemory().WithMaxEventBytes(64),
+		"disk":   onDisk.WithMaxEventBytes(64),
+	} {
+		normal := NewEvent("test.run").Add("title", "hello")
+		oversized := NewEvent("test.run").Add("body", strings.Repeat("x", 64))
+		oversized.Id = "oversized"
+
+		if err := store.Store([]*Event{normal}); err != nil {
+			t.Errorf("[%s] store.Store(normal) = %v; want nil", name, err)
+		}
+		err := store.Store([]*Event{normal, oversized})
+		if !errors.Is(err, ErrEventTooLarge) {
+			t.Errorf("[%s] store.Store(oversized) = %v; want %v", name, err, ErrEventTooLarge)
+		}
+		tooLarge, ok := err.(*EventTooLargeError)
+		if !ok {
+			t.Fatalf("[%s] store.Store(oversized) = %#v; want *EventTooLargeError", name, err)
+		}
+		if got, want := *tooLarge, (EventTooLargeError{Name: "test.run", Id: "oversized", Size: 75, Limit: 64}); got != want {
+			t.Errorf("[%s] *tooLarge = %#v; want %#v", name, got, want)
+		}
+
+		stored := 0
+		store.Replay("*", EventHandlerFunc(func(*Event) { stored++ }))
+		if got, want := stored, 1; got != want {
+			t.Errorf("[%s] stored = %d; want %d", name, got, want)
+		}
+	}
+}
+
+// newNumberedEvents returns count events numbered consecutively,
+// starting at first.
+func newNumberedEvents(first, count int) []*Event {
+	events := make([]*Event, count)
+	for i := range events {
+		events[i] = NewEvent("test.run").For(newTestAggregate("id")).Add("n", first+i)
+	}
+	return events
+}
+
+func BenchmarkEventsOnDisk_Store(b *testing.B) {
+	filename := filepath.Join(os.TempDir(), fmt.Sprintf("events-bench-store-%d.json", os.Getpid()))
+	defer os.Remove(filename)
+
+	store, err := NewEventsOnDisk(filename, SystemClock)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, event := range newNumberedEvents(0, 100) {
+			if err := store.Store([]*Event{event}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkEventsOnDisk_StoreBatch(b *testing.B) {
+	filename := filepath.Join(os.TempDir(), fmt.Sprintf("events-bench-batch-%d.json", os.Getpid()))
+	defer os.Remove(filename)
+
+	store, err := NewEventsOnDisk(filename, SystemClock)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := store.StoreBatch(newNumberedEvents(0, 100)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestEventsOnDisk_Replay_treatsMissingFileAsEmptyHistory(t *testing.T) {
+	filename := filepath.Join(os.TempDir(), fmt.Sprintf("events-missing-%d", os.Getpid()), "events.json")
+
+	store, err := NewEventsOnDisk(filename, SystemClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := 0
+	if err := store.Replay("*", EventHandlerFunc(func(*Event) { seen++ })); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := seen, 0; got != want {
+		t.Errorf("seen = %d; want %d", got, want)
+	}
+}
+
+func TestEventsOnDisk_Replay_failsIfFileCannotBeRead(t *testing.T) {
+	dir := filepath.Join(os.TempDir(), fmt.Sprintf("events-unreadable-%d", os.Getpid()))
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := NewEventsOnDisk(filepath.Join(dir, "events.json", "nested"), SystemClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "events.json"), []byte{}, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Replay("*", EventHandlerFunc(func(*Event) {})); err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+func TestEventsOnDisk_Replay_restoresMetadata(t *testing.T) {
+	filename := filepath.Join(os.TempDir(), fmt.Sprintf("events-metadata-%d.json", os.Getpid()))
+	defer os.Remove(filename)
+
+	store, err := NewEventsOnDisk(filename, SystemClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event := NewEvent("test.run").For(newTestAggregate("id")).
+		Add("param", "value").
+		WithMeta("client_ip", "127.0.0.1")
+	if err := store.Store([]*Event{event}); err != nil {
+		t.Fatal(err)
+	}
+
+	replayed := []*Event{}
+	if err := store.Replay("id", EventHandlerFunc(func(event *Event) { replayed = append(replayed, event) })); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(replayed), 1; got != want {
+		t.Fatalf("len(replayed) = %d; want %d", got, want)
+	}
+	if got, want := replayed[0].Metadata, map[string]string{"client_ip": "127.0.0.1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("replayed[0].Metadata = %v; want %v", got, want)
+	}
+	if got, want := replayed[0].Payload, map[string]interface{}{"param": "value"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("replayed[0].Payload = %v; want %v", got, want)
+	}
+}
+
+func TestEventsOnDisk_Replay_ignoresTruncatedLastRecord(t *testing.T) {
+	filename := filepath.Join(os.TempDir(), fmt.Sprintf("events-truncated-%d.json", os.Getpid()))
+	defer os.Remove(filename)
+
+	store, err := NewEventsOnDisk(filename, SystemClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject := newTestAggregate("id")
+	if err := store.Store([]*Event{
+		NewEvent("test.run-1").For(subject),
+		NewEvent("test.run-2").For(subject),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	appendToFile(t, filename, `{"id":"event","stream_id":"id","na`)
+
+	seen := []string{}
+	if err := store.Replay("*", EventHandlerFunc(func(event *Event) {
+		seen = append(seen, event.Name)
+	})); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := seen, []string{"test.run-1", "test.run-2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf(`seen = %q; want %q`, got, want)
+	}
+}
+
+func TestEventsOnDisk_Replay_failsOnCorruptRecordInTheMiddle(t *testing.T) {
+	filename := filepath.Join(os.TempDir(), fmt.Sprintf("events-corrupt-%d.json", os.Getpid()))
+	defer os.Remove(filename)
+
+	store, err := NewEventsOnDisk(filename, SystemClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject := newTestAggregate("id")
+	if err := store.Store([]*Event{NewEvent("test.run-1").For(subject)}); err != nil {
+		t.Fatal(err)
+	}
+	appendToFile(t, filename, `{"id":"event","stream_id":"id","na`+"\n")
+	if err := store.Store([]*Event{NewEvent("test.run-2").For(subject)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Replay("*", EventHandlerFunc(func(*Event) {})); err == nil {
+		t.Errorf("store.Replay did not fail")
+	}
+}
+
+func appendToFile(t *testing.T, filename string, data string) {
+	out, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+
+	if _, err := out.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEventsOnDisk_Store_removesTruncatedLastRecord(t *testing.T) {
+	filename := filepath.Join(os.TempDir(), fmt.Sprintf("events-repaired-%d.json", os.Getpid()))
+	defer os.Remove(filename)
+
+	store, err := NewEventsOnDisk(filename, SystemClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject := newTestAggregate("id")
+	if err := store.Store([]*Event{NewEvent("test.run-1").For(subject)}); err != nil {
+		t.Fatal(err)
+	}
+	appendToFile(t, filename, `{"id":"event","stream_id":"id","na`)
+	if err := store.Store([]*Event{NewEvent("test.run-2").For(subject)}); err != nil {
+		t.Fatal(err)
+	}
+
+	seen := []string{}
+	if err := store.Replay("*", EventHandlerFunc(func(event *Event) {
+		seen = append(seen, event.Name)
+	})); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := seen, []string{"test.run-1", "test.run-2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf(`seen = %q; want %q`, got, want)
+	}
+}
+
+func TestEventsOnDisk_Store_keepsValidUnterminatedLastRecord(t *testing.T) {
+	filename := filepath.Join(os.TempDir(), fmt.Sprintf("events-unterminated-%d.json", os.Getpid()))
+	defer os.Remove(filename)
+
+	store, err := NewEventsOnDisk(filename, SystemClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject := newTestAggregate("id")
+	if err := store.Store([]*Event{NewEvent("test.run-1").For(subject)}); err != nil {
+		t.Fatal(err)
+	}
+	appendToFile(t, filename, `{"id":"event","stream_id":"id","name":"test.run-2"}`)
+	if err := store.Store([]*Event{NewEvent("test.run-3").For(subject)}); err != nil {
+		t.Fatal(err)
+	}
+
+	seen := []string{}
+	if err := store.Replay("*", EventHandlerFunc(func(event *Event) {
+		seen = append(seen, event.Name)
+	})); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := seen, []string{"test.run-1", "test.run-2", "test.run-3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf(`seen = %q; want %q`, got, want)
+	}
+}
+
+func TestEventsOnDisk_Compact_removesEventsNotKept(t *testing.T) {
+	filename := filepath.Join(os.TempDir(), fmt.Sprintf("events-compact-%d.json", os.Getpid()))
+	defer os.Remove(filename)
+
+	store, err := NewEventsOnDisk(filename, SystemClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject := newTestAggregate("id")
+	deleted := newTestAggregate("deleted")
+	if err := store.Store([]*Event{
+		NewEvent("test.run-1").For(subject),
+		NewEvent("test.run-1").For(deleted),
+		NewEvent("test.run-2").For(subject),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Compact(func(event *Event) bool {
+		return event.StreamId != deleted.Id()
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	seen := []string{}
+	if err := store.Replay("*", EventHandlerFunc(func(event *Event) {
+		seen = append(seen, event.StreamId+" "+event.Name)
+	})); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := seen, []string{"id test.run-1", "id test.run-2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf(`seen = %q; want %q`, got, want)
+	}
+}
+
+func TestReplayWithProgress_reportsEveryNEvents(t *testing.T) {
+	store := NewEventsInMemory()
+	for i := 0; i < 20; i++ {
+		store.Store([]*Event{NewEvent("test.run").For(newTestAggregate("id"))})
+	}
+
+	seen, reported := 0, []int{}
+	err := ReplayWithProgress(store, "id", EventHandlerFunc(func(*Event) { seen++ }), 5, func(count int) {
+		reported = append(reported, count)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := seen, 20; got != want {
+		t.Errorf("seen = %d; want %d", got, want)
+	}
+
+	if got, want := reported, []int{5, 10, 15, 20}; !reflect.DeepEqual(got, want) {
+		t.Errorf("reported = %v; want %v", got, want)
+	}
+}
+
+func TestCompositeEventStore_EventStoreBehavior(t *testing.T) {
+	setup := func(t *testing.T) EventStore {
+		return NewCompositeEventStore(NewEventsInMemory(), NewEventsInMemory())
+	}
+	suite := NewEventStoreTest(setup)
+	suite.Run(t)
+}
+
+func TestCompositeEventStore_Store_writesToAllStores(t *testing.T) {
+	primary, secondary := NewEventsInMemory(), NewEventsInMemory()
+	store := NewCompositeEventStore(primary, secondary)
+
+	if err := store.Store([]*Event{NewEvent("test.run").For(newTestAggregate("id"))}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(primary.Events()), 1; got != want {
+		t.Errorf("len(primary.Events()) = %d; want %d", got, want)
+	}
+	if got, want := len(secondary.Events()), 1; got != want {
+		t.Errorf("len(secondary.Events()) = %d; want %d", got, want)
+	}
+}
+
+func TestCompositeEventStore_Store_keepsVersionsOfPrimary(t *testing.T) {
+	primary, secondary := NewEventsInMemory(), NewEventsInMemory()
+	secondary.Store([]*Event{
+		NewEvent("test.secondary").For(newTestAggregate("id")),
+		NewEvent("test.secondary").For(newTestAggregate("other")),
+	})
+	store := NewCompositeEventStore(primary, secondary)
+
+	event := NewEvent("test.run").For(newTestAggregate("id"))
+	if err := store.Store([]*Event{event}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := event.StreamVersion, 0; got != want {
+		t.Errorf("event.StreamVersion = %d; want %d", got, want)
+	}
+	if got, want := event.Sequence, int64(1); got != want {
+		t.Errorf("event.Sequence = %d; want %d", got, want)
+	}
+}
+
+func TestCompositeEventStore_Replay_readsFromPrimary(t *testing.T) {
+	primary, secondary := NewEventsInMemory(), NewEventsInMemory()
+	secondary.Store([]*Event{NewEvent("test.secondary").For(newTestAggregate("id"))})
+	store := NewCompositeEventStore(primary, secondary)
+
+	if err := store.Store([]*Event{NewEvent("test.run").For(newTestAggregate("id"))}); err != nil {
+		t.Fatal(err)
+	}
+
+	replayed := []string{}
+	if err := store.Replay("id", EventHandlerFunc(func(event *Event) { replayed = append(replayed, event.Name) })); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := replayed, []string{"test.run"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("replayed = %v; want %v", got, want)
+	}
+}
+
+func TestEventsInMemory_Iterate_canStopEarly(t *testing.T) {
+	store := NewEventsInMemory()
+	subject := newTestAggregate("id")
+	store.Store([]*Event{
+		NewEvent("test.run-1").For(subject),
+		NewEvent("test.run-1").For(newTestAggregate("other")),
+		NewEvent("test.run-2").For(subject),
+		NewEvent("test.run-3").For(subject),
+	})
+
+	events, err := store.Iterate("id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer events.Close()
+
+	seen := []string{}
+	for events.Next() {
+		seen = append(seen, events.Event().Name)
+		if len(seen) == 2 {
+			break
+		}
+	}
+
+	if got, want := seen, []string{"test.run-1", "test.run-2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("seen = %v; want %v", got, want)
+	}
+}
+
+func TestEventsOnDisk_Iterate_canStopEarly(t *testing.T) {
+	filename := filepath.Join(os.TempDir(), fmt.Sprintf("events-iterate-%d.json", os.Getpid()))
+	defer os.Remove(filename)
+
+	store, err := NewEventsOnDisk(filename, SystemClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject := newTestAggregate("id")
+	store.Store([]*Event{
+		NewEvent("test.run-1").For(subject),
+		NewEvent("test.run-2").For(subject),
+		NewEvent("test.run-3").For(subject),
+	})
+
+	events, err := store.Iterate("*")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !events.Next() {
+		t.Fatalf("events.Next() = false; err = %v", events.Err())
+	}
+	if got, want := events.Event().Name, "test.run-1"; got != want {
+		t.Errorf("events.Event().Name = %q; want %q", got, want)
+	}
+
+	if err := events.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if events.Next() {
+		t.Errorf("events.Next() = true after Close")
+	}
+}
+
+func TestEventsOnDisk_Iterate_reportsCorruptRecords(t *testing.T) {
+	filename := filepath.Join(os.TempDir(), fmt.Sprintf("events-iterate-corrupt-%d.json", os.Getpid()))
+	defer os.Remove(filename)
+
+	store, err := NewEventsOnDisk(filename, SystemClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject := newTestAggregate("id")
+	if err := store.Store([]*Event{NewEvent("test.run-1").For(subject)}); err != nil {
+		t.Fatal(err)
+	}
+	appendToFile(t, filename, `{"id":"event","stream_id":"id","na`+"\n")
+	if err := store.Store([]*Event{NewEvent("test.run-2").For(subject)}); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := store.Iterate("id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer events.Close()
+
+	seen := 0
+	for events.Next() {
+		seen++
+	}
+
+	if got, want := seen, 1; got != want {
+		t.Errorf("seen = %d; want %d", got, want)
+	}
+	if events.Err() == nil {
+		t.Errorf("events.Err() = nil; want an error")
+	}
+}
+
+func TestReplaySince_skipsEarlierEvents(t *testing.T) {
+	store := NewEventsInMemory()
+	subject := newTestAggregate("id")
+	store.Store([]*Event{
+		NewEvent("test.run-1").For(subject),
+		NewEvent("test.run-2").For(subject),
+		NewEvent("test.run-3").For(subject),
+	})
+
+	seen := []string{}
+	err := ReplaySince(store, "id", 1, EventHandlerFunc(func(event *Event) {
+		seen = append(seen, event.Name)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := seen, []string{"test.run-2", "test.run-3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("seen = %v; want %v", got, want)
+	}
+}
+
+func TestReplaySince_numbersEventsWithoutStreamVersion(t *testing.T) {
+	store := NewEventsInMemory()
+	subject := newTestAggregate("id")
+	store.Restore([]*Event{
+		NewEvent("test.run-1").For(subject),
+		NewEvent("test.run-2").For(subject),
+		NewEvent("test.run-3").For(subject),
+	})
+
+	seen := []string{}
+	err := ReplaySince(store, "id", 2, EventHandlerFunc(func(event *Event) {
+		seen = append(seen, event.Name)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := seen, []string{"test.run-3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("seen = %v; want %v", got, want)
+	}
+}
+
+func TestReplaySince_skipsEventsBySequenceForAllStreams(t *testing.T) {
+	store := NewEventsInMemory()
+	store.Restore([]*Event{NewEvent("test.legacy").For(newTestAggregate("id"))})
+	store.Store([]*Event{
+		NewEvent("test.run-1").For(newTestAggregate("id")),
+		NewEvent("test.run-2").For(newTestAggregate("other")),
+		NewEvent("test.run-3").For(newTestAggregate("id")),
+	})
+
+	seen := []string{}
+	err := ReplaySince(store, "*", 3, EventHandlerFunc(func(event *Event) {
+		seen = append(seen, event.Name)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := seen, []string{"test.run-2", "test.run-3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("seen = %v; want %v", got, want)
+	}
+}
+
+func TestEventsOnDisk_Store_continuesStreamVersionsOfExistingLog(t *testing.T) {
+	filename := filepath.Join(os.TempDir(), fmt.Sprintf("events-versions-%d.json", os.Getpid()))
+	defer os.Remove(filename)
+
+	subject := newTestAggregate("id")
+	for i := 0; i < 2; i++ {
+		store, err := NewEventsOnDisk(filename, SystemClock)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Store([]*Event{NewEvent("test.run").For(subject)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	store, _ := NewEventsOnDisk(filename, SystemClock)
+	versions := []int{}
+	if err := store.Replay("id", EventHandlerFunc(func(event *Event) {
+		versions = append(versions, event.StreamVersion)
+	})); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := versions, []int{0, 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("versions = %v; want %v", got, want)
+	}
+}
+
+func TestEventsOnDisk_Store_countsLegacyEventsPerStream(t *testing.T) {
+	filename := filepath.Join(os.TempDir(), fmt.Sprintf("events-legacy-%d.json", os.Getpid()))
+	defer os.Remove(filename)
+
+	ioutil.WriteFile(filename, []byte(
+		`{"id":"1","stream_id":"id","name":"test.run"}`+"\n"+
+			`{"id":"2","stream_id":"other","name":"test.run"}`+"\n"+
+			`{"id":"3","stream_id":"id","name":"test.run"}`+"\n"), 0600)
+	store, err := NewEventsOnDisk(filename, SystemClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := NewEvent("test.run").For(newTestAggregate("id"))
+	if err := store.Store([]*Event{event}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := event.StreamVersion, 2; got != want {
+		t.Errorf("event.StreamVersion = %d; want %d", got, want)
+	}
+	if got, want := event.Sequence, int64(4); got != want {
+		t.Errorf("event.Sequence = %d; want %d", got, want)
+	}
+}
+
+// failingMiddleware fails storing events with a given name.
+type failingMiddleware struct {
+	name string
+}
+
+func (self *failingMiddleware) BeforeStore(event *Event) (*Event, error) {
+	if event.Name == self.name {
+		return nil, errors.New("failed")
+	}
+	return event, nil
+}
+
+func (self *failingMiddleware) AfterLoad(event *Event) (*Event, error) { return event, nil }
+
+func TestEventsInMemory_Store_doesNotUseUpVersionsOnFailure(t *testing.T) {
+	store := NewEventsInMemory().Use(&failingMiddleware{name: "test.fail"})
+	subject := newTestAggregate("id")
+	store.Store([]*Event{NewEvent("test.run-1").For(subject)})
+	if err := store.Store([]*Event{NewEvent("test.fail").For(subject)}); err == nil {
+		t.Fatalf("store.Store did not fail")
+	}
+	store.Store([]*Event{NewEvent("test.run-2").For(subject)})
+
+	versions := []string{}
+	store.Replay("*", EventHandlerFunc(func(event *Event) {
+		versions = append(versions, fmt.Sprintf("%d@%d", event.Sequence, event.StreamVersion))
+	}))
+	if got, want := versions, []string{"1@0", "2@1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("versions = %v; want %v", got, want)
+	}
+}
+
+func TestEventsOnDisk_Store_doesNotUseUpVersionsOnFailure(t *testing.T) {
+	filename := filepath.Join(os.TempDir(), fmt.Sprintf("events-failing-%d.json", os.Getpid()))
+	defer os.Remove(filename)
+
+	store, err := NewEventsOnDisk(filename, SystemClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Use(&failingMiddleware{name: "test.fail"})
+	subject := newTestAggregate("id")
+	store.Store([]*Event{NewEvent("test.run-1").For(subject)})
+	if err := store.Store([]*Event{NewEvent("test.fail").For(subject)}); err == nil {
+		t.Fatalf("store.Store did not fail")
+	}
+	store.Store([]*Event{NewEvent("test.run-2").For(subject)})
+
+	versions := []string{}
+	store.Replay("*", EventHandlerFunc(func(event *Event) {
+		versions = append(versions, fmt.Sprintf("%d@%d", event.Sequence, event.StreamVersion))
+	}))
+	if got, want := versions, []string{"1@0", "2@1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("versions = %v; want %v", got, want)
+	}
+}
+
+func TestEventsInMemory_Restore_resetsStoreToSnapshot(t *testing.T) {
+	store := NewEventsInMemory()
+	subject := newTestAggregate("id")
+	store.Store([]*Event{NewEvent("test.run-1").For(subject), NewEvent("test.run-2").For(subject)})
+	replay := func() []string {
+		names := []string{}
+		store.Replay("*", EventHandlerFunc(func(event *Event) {
+			names = append(names, fmt.Sprintf("%s@%d", event.Name, event.StreamVersion))
+		}))
+		return names
+	}
+
+	snapshot := store.Snapshot()
+	want := replay()
+	store.Store([]*Event{NewEvent("test.run-3").For(subject)})
+	store.Restore(snapshot)
+
+	if got := replay(); !reflect.DeepEqual(got, want) {
+		t.Errorf("replay() = %v; want %v", got, want)
+	}
+
+	store.Store([]*Event{NewEvent("test.run-3").For(subject)})
+	if got, want := len(snapshot), 2; got != want {
+		t.Errorf("len(snapshot) = %d; want %d", got, want)
+	}
+	if got, want := store.Events()[2].StreamVersion, 2; got != want {
+		t.Errorf("store.Events()[2].StreamVersion = %d; want %d", got, want)
+	}
+}
+
+func TestEventsInMemory_Snapshot_doesNotAliasEvents(t *testing.T) {
+	store := NewEventsInMemory()
+	store.Store([]*Event{NewEvent("test.run").Add("param", "value")})
+
+	snapshot := store.Snapshot()
+	snapshot[0].Name = "changed"
+	snapshot[0].Payload["param"] = "changed"
+	store.Restore(snapshot)
+	snapshot[0].Name = "changed again"
+
+	if got, want := store.Events()[0].Name, "changed"; got != want {
+		t.Errorf("store.Events()[0].Name = %q; want %q", got, want)
+	}
+
+	original := NewEventsInMemory()
+	original.Store([]*Event{NewEvent("test.run").Add("param", "value")})
+	original.Snapshot()[0].Payload["param"] = "changed"
+	if got, want := original.Events()[0].Payload["param"], "value"; got != want {
+		t.Errorf(`original.Events()[0].Payload["param"] = %v; want %v`, got, want)
+	}
+}
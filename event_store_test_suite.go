@@ -1,6 +1,10 @@
 package ess
 
-import "testing"
+import (
+	"fmt"
+	"testing"
+	"time"
+)
 
 // EventStoreTest encapsulates the tests for the EventStore interface.
 // Any compliant implementation of an EventStore should pass these
@@ -31,6 +35,10 @@ func NewEventStoreTest(setup func(t *testing.T) EventStore) *EventStoreTest {
 func (self *EventStoreTest) Run(t *testing.T) {
 	self.testStoredEventsCanBeReplayedByStreamId(t)
 	self.testStoredEventsCanBeReplayedOverAllStreams(t)
+	self.testStoredEventsKeepCorrelationAndCausation(t)
+	self.testDeletedStreamsAreNotReplayed(t)
+	self.testStreamVersionsIncreasePerStream(t)
+	self.testSequenceIncreasesAcrossStreams(t)
 }
 
 func (self *EventStoreTest) testStoredEventsCanBeReplayedByStreamId(t *testing.T) {
@@ -113,3 +121,158 @@ func (self *EventStoreTest) testStoredEventsCanBeReplayedOverAllStreams(t *testi
 		t.Errorf(`seen[2] = %v; want %v`, got, want)
 	}
 }
+
+func (self *EventStoreTest) testStoredEventsKeepCorrelationAndCausation(t *testing.T) {
+	store := self.SetUp(t)
+	t.Logf("testStoredEventsKeepCorrelationAndCausation %T", store)
+	defer self.TearDown()
+
+	subject := newTestAggregate("id")
+	event := NewEvent("test.run").For(subject)
+	event.CorrelationId = "correlation"
+	event.CausationId = "causation"
+
+	if err := store.Store([]*Event{event}); err != nil {
+		t.Fatal(err)
+	}
+
+	seen := []*Event{}
+	if err := store.Replay(subject.Id(), EventHandlerFunc(func(event *Event) {
+		seen = append(seen, event)
+	})); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(seen), 1; got != want {
+		t.Fatalf(`len(seen) = %v; want %v`, got, want)
+	}
+
+	if got, want := seen[0].CorrelationId, event.CorrelationId; got != want {
+		t.Errorf(`seen[0].CorrelationId = %v; want %v`, got, want)
+	}
+
+	if got, want := seen[0].CausationId, event.CausationId; got != want {
+		t.Errorf(`seen[0].CausationId = %v; want %v`, got, want)
+	}
+}
+
+func (self *EventStoreTest) testDeletedStreamsAreNotReplayed(t *testing.T) {
+	store := self.SetUp(t)
+	t.Logf("testDeletedStreamsAreNotReplayed %T", store)
+	defer self.TearDown()
+
+	subject := newTestAggregate("id")
+	other := newTestAggregate("other")
+
+	history := []*Event{
+		NewEvent("test.run-1").For(subject),
+		NewEvent("test.run-1").For(other),
+		NewEvent("test.run-2").For(subject),
+	}
+
+	deleter, ok := store.(StreamDeleter)
+	if !ok {
+		return
+	}
+
+	if err := store.Store(history); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := deleter.DeleteStream(subject.Id()); err != nil {
+		t.Fatal(err)
+	}
+
+	seen := []string{}
+	if err := store.Replay("*", EventHandlerFunc(func(event *Event) {
+		seen = append(seen, event.StreamId)
+	})); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(seen), 1; got != want {
+		t.Fatalf(`len(seen) = %v; want %v`, got, want)
+	}
+
+	if got, want := seen[0], other.Id(); got != want {
+		t.Errorf(`seen[0] = %v; want %v`, got, want)
+	}
+}
+
+func (self *EventStoreTest) testStreamVersionsIncreasePerStream(t *testing.T) {
+	store := self.SetUp(t)
+	t.Logf("testStreamVersionsIncreasePerStream %T", store)
+	defer self.TearDown()
+
+	subject := newTestAggregate("id")
+	other := newTestAggregate("other")
+
+	if err := store.Store([]*Event{
+		NewEvent("test.run-1").For(subject),
+		NewEvent("test.run-1").For(other),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Store([]*Event{
+		NewEvent("test.run-2").For(subject),
+		NewEvent("test.run-3").For(subject),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	versions := map[string][]int{}
+	if err := store.Replay("*", EventHandlerFunc(func(event *Event) {
+		versions[event.StreamId] = append(versions[event.StreamId], event.StreamVersion)
+	})); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := fmt.Sprint(versions[subject.Id()]), "[0 1 2]"; got != want {
+		t.Errorf(`versions[%q] = %s; want %s`, subject.Id(), got, want)
+	}
+	if got, want := fmt.Sprint(versions[other.Id()]), "[0]"; got != want {
+		t.Errorf(`versions[%q] = %s; want %s`, other.Id(), got, want)
+	}
+}
+
+func (self *EventStoreTest) testSequenceIncreasesAcrossStreams(t *testing.T) {
+	store := self.SetUp(t)
+	t.Logf("testSequenceIncreasesAcrossStreams %T", store)
+	defer self.TearDown()
+
+	clock := &StaticClock{time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)}
+	subject := newTestAggregate("id")
+	other := newTestAggregate("other")
+	batches := [][]*Event{
+		{NewEvent("test.run-1").For(subject), NewEvent("test.run-1").For(other)},
+		{NewEvent("test.run-2").For(subject), NewEvent("test.sync")},
+	}
+	for _, events := range batches {
+		for _, event := range events {
+			event.Occur(clock)
+		}
+		if err := store.Store(events); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sequences := []int64{}
+	if err := store.Replay("*", EventHandlerFunc(func(event *Event) {
+		sequences = append(sequences, event.Sequence)
+	})); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(sequences), 4; got != want {
+		t.Fatalf("len(sequences) = %d; want %d", got, want)
+	}
+	if sequences[0] < 1 {
+		t.Errorf("sequences[0] = %d; want at least 1", sequences[0])
+	}
+	for i := 1; i < len(sequences); i++ {
+		if sequences[i] <= sequences[i-1] {
+			t.Errorf("sequences = %v; want strictly increasing", sequences)
+			break
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package ess
 
 import (
+	"encoding/json"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -59,3 +61,103 @@ func TestEvent_Persist_setsPersistedAtBasedOnClock(t *testing.T) {
 		t.Errorf(`event.PersistedAt = %v; want %v`, got, want)
 	}
 }
+
+func TestEvent_MarshalJSON_usesLowercaseKeys(t *testing.T) {
+	event := NewEvent("test.run").Add("param", "value")
+	event.Id = "event"
+	event.StreamId = "stream"
+	event.OccurredOn = time.Date(2015, 1, 2, 3, 4, 5, 0, time.UTC)
+	event.PersistedAt = time.Date(2015, 1, 2, 3, 4, 6, 0, time.UTC)
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"id":"event","stream_id":"stream","name":"test.run",` +
+		`"occurred_on":"2015-01-02T03:04:05Z","persisted_at":"2015-01-02T03:04:06Z",` +
+		`"payload":{"param":"value"}}`
+	if got := string(data); got != want {
+		t.Errorf(`json.Marshal(event) = %s; want %s`, got, want)
+	}
+}
+
+func TestEvent_UnmarshalJSON_roundTripsEvent(t *testing.T) {
+	event := NewEvent("test.run").Add("param", "value")
+	event.Id = "event"
+	event.StreamId = "stream"
+	event.CorrelationId = "correlation"
+	event.CausationId = "causation"
+	event.OccurredOn = time.Date(2015, 1, 2, 3, 4, 5, 0, time.UTC)
+	event.PersistedAt = time.Date(2015, 1, 2, 3, 4, 6, 0, time.UTC)
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := &Event{}
+	if err := json.Unmarshal(data, decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := decoded, event; !reflect.DeepEqual(got, want) {
+		t.Errorf(`decoded = %#v; want %#v`, got, want)
+	}
+}
+
+func TestEvent_UnmarshalJSON_acceptsLegacyKeys(t *testing.T) {
+	data := `{"Id":"event","StreamId":"stream","Name":"test.run",` +
+		`"OccurredOn":"2015-01-02T03:04:05Z","PersistedAt":"2015-01-02T03:04:06Z",` +
+		`"Payload":{"param":"value"}}`
+
+	event := &Event{}
+	if err := json.Unmarshal([]byte(data), event); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := event.StreamId, "stream"; got != want {
+		t.Errorf(`event.StreamId = %v; want %v`, got, want)
+	}
+
+	if got, want := event.Name, "test.run"; got != want {
+		t.Errorf(`event.Name = %v; want %v`, got, want)
+	}
+
+	if got, want := event.OccurredOn, time.Date(2015, 1, 2, 3, 4, 5, 0, time.UTC); !got.Equal(want) {
+		t.Errorf(`event.OccurredOn = %v; want %v`, got, want)
+	}
+
+	if got, want := event.Payload["param"], "value"; got != want {
+		t.Errorf(`event.Payload["param"] = %v; want %v`, got, want)
+	}
+}
+
+func TestEvent_Persist_keepsTimeOfPersistedEvents(t *testing.T) {
+	persistedAt := time.Date(2015, 1, 2, 3, 4, 5, 0, time.UTC)
+	event := NewEvent("test.run")
+	event.PersistedAt = persistedAt
+	event.Persist(&StaticClock{time.Now()})
+
+	if got, want := event.PersistedAt, persistedAt; !got.Equal(want) {
+		t.Errorf(`event.PersistedAt = %v; want %v`, got, want)
+	}
+}
+
+func TestEvent_AddFields_skipsUnsetOptionalFields(t *testing.T) {
+	definition := NewCommandDefinition("update-profile").
+		Field("name", TrimmedString()).
+		Field("bio", Optional(TrimmedString())).
+		Field("website", Optional(TrimmedString()))
+	command := definition.NewCommand().FromFormPartial(URLValues{
+		"name": {"Admin"},
+		"bio":  {""},
+	})
+
+	event := NewEvent("user.profile-updated").AddFields(command, "name", "bio", "website")
+
+	want := map[string]interface{}{"name": "Admin", "bio": ""}
+	if got := event.Payload; !reflect.DeepEqual(got, want) {
+		t.Errorf("event.Payload = %v; want %v", got, want)
+	}
+}
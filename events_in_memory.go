@@ -2,37 +2,162 @@ package ess
 
 // EventsInMemory is an in-memory implementation of an event store.
 type EventsInMemory struct {
-	events []*Event
+	events      []*Event
+	versions    *streamVersions
+	max         int
+	maxBytes    int
+	middlewares eventMiddlewares
 }
 
 // NewEventsInMemory creates a new instance of this event store
 // holding no events initially.
 func NewEventsInMemory() *EventsInMemory {
 	return &EventsInMemory{
-		events: []*Event{},
+		events:   []*Event{},
+		versions: newStreamVersions(),
 	}
 }
 
-// Store stores the given events in this event store.  It never
-// returns an error.
+// NewEventsInMemoryBounded creates a new instance of this event store
+// which retains at most max events.  Once more than max events have
+// been stored, the oldest events are evicted.
+//
+// Since evicted events are not replayed anymore, aggregates and
+// projections cannot be reconstructed from the full history of
+// events.  Use this store only for tests and demos.
+func NewEventsInMemoryBounded(max int) *EventsInMemory {
+	store := NewEventsInMemory()
+	store.max = max
+	return store
+}
+
+// Use adds middleware to the middlewares which events pass through
+// before they are stored and after they are replayed.
+func (self *EventsInMemory) Use(middleware EventMiddleware) *EventsInMemory {
+	self.middlewares = append(self.middlewares, middleware)
+	return self
+}
+
+// WithMaxEventBytes limits the size of the payload of stored events
+// to n bytes when serialized as JSON, before passing the events to
+// middlewares.  Storing events with a larger payload fails with an
+// *EventTooLargeError.  A limit of zero, the default, disables the
+// check.
+func (self *EventsInMemory) WithMaxEventBytes(n int) *EventsInMemory {
+	self.maxBytes = n
+	return self
+}
+
+// Store stores the given events in this event store, assigning
+// stream versions and sequence numbers to them.  It only returns
+// errors returned by middlewares and *EventTooLargeError, in which
+// case none of the events are stored and no versions are used up.
 func (self *EventsInMemory) Store(events []*Event) error {
-	self.events = append(self.events, events...)
+	if err := checkPayloadSizes(self.maxBytes, events); err != nil {
+		return err
+	}
+
+	self.versions.assign(events)
+	transformed, err := self.middlewares.beforeStore(events)
+	if err != nil {
+		self.versions.rollback(events)
+		return err
+	}
+
+	self.events = append(self.events, transformed...)
+	self.evict()
 	return nil
 }
 
+// evict removes the oldest events if this instance holds more events
+// than allowed.
+func (self *EventsInMemory) evict() {
+	if self.max <= 0 || len(self.events) <= self.max {
+		return
+	}
+
+	excess := len(self.events) - self.max
+	for i := 0; i < excess; i++ {
+		self.events[i] = nil
+	}
+	self.events = self.events[excess:]
+}
+
 // Replay handles all events with a matching stream id using receiver.
-// It never returns an error.
+// It only returns errors returned by middlewares.
 //
 // Use "*" as the stream id to match all events.
 func (self *EventsInMemory) Replay(streamId string, receiver EventHandler) error {
 	for _, event := range self.events {
 		if streamId == "*" || streamId == event.StreamId {
+			event, err := self.middlewares.afterLoad(event)
+			if err != nil {
+				return err
+			}
 			receiver.HandleEvent(event)
 		}
 	}
 	return nil
 }
 
+// DeleteStream removes all events with a matching stream id.  It
+// never returns an error.
+func (self *EventsInMemory) DeleteStream(streamId string) error {
+	kept := []*Event{}
+	for _, event := range self.events {
+		if event.StreamId != streamId {
+			kept = append(kept, event)
+		}
+	}
+	self.events = kept
+	self.versions.forget(streamId)
+	return nil
+}
+
+// Iterate returns an iterator over the events with a matching stream
+// id.  Events stored after calling Iterate are not included.
+//
+// Use "*" as the stream id to match all events.
+func (self *EventsInMemory) Iterate(streamId string) (EventIterator, error) {
+	return &memoryEventIterator{
+		events:      self.events,
+		streamId:    streamId,
+		middlewares: self.middlewares,
+		position:    -1,
+	}, nil
+}
+
+// memoryEventIterator iterates over a slice of events.
+type memoryEventIterator struct {
+	events      []*Event
+	streamId    string
+	middlewares eventMiddlewares
+	position    int
+	event       *Event
+	err         error
+}
+
+func (self *memoryEventIterator) Next() bool {
+	if self.err != nil {
+		return false
+	}
+
+	for self.position++; self.position < len(self.events); self.position++ {
+		event := self.events[self.position]
+		if self.streamId != "*" && self.streamId != event.StreamId {
+			continue
+		}
+
+		self.event, self.err = self.middlewares.afterLoad(event)
+		return self.err == nil
+	}
+	return false
+}
+
+func (self *memoryEventIterator) Event() *Event { return self.event }
+func (self *memoryEventIterator) Err() error    { return self.err }
+func (self *memoryEventIterator) Close() error  { return nil }
+
 // PublishEvent stores event in this instance.  This method is
 // implemented to satisfy the EventPublisher interface.
 //
@@ -40,6 +165,7 @@ func (self *EventsInMemory) Replay(streamId string, receiver EventHandler) error
 // capturing events across aggregates and facilitates testing.
 func (self *EventsInMemory) PublishEvent(event *Event) EventPublisher {
 	self.events = append(self.events, event)
+	self.evict()
 	return self
 }
 
@@ -47,3 +173,29 @@ func (self *EventsInMemory) PublishEvent(event *Event) EventPublisher {
 func (self *EventsInMemory) Events() []*Event {
 	return self.events
 }
+
+// Snapshot returns copies of all events stored by this instance.  Use
+// Restore for resetting the store to the returned events later, e.g.
+// for sharing a common history between test cases.
+func (self *EventsInMemory) Snapshot() []*Event {
+	return copyEvents(self.events)
+}
+
+// Restore replaces all events stored by this instance with copies of
+// events.
+func (self *EventsInMemory) Restore(events []*Event) {
+	self.events = copyEvents(events)
+	self.versions = newStreamVersions()
+	for _, event := range self.events {
+		self.versions.observe(event)
+	}
+}
+
+// copyEvents returns a new slice containing copies of events.
+func copyEvents(events []*Event) []*Event {
+	copied := make([]*Event, len(events))
+	for i, event := range events {
+		copied[i] = event.Copy()
+	}
+	return copied
+}
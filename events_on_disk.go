@@ -1,6 +1,8 @@
 package ess
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
 	"io"
 	"os"
@@ -13,9 +15,18 @@ import (
 // Events are serialized as JSON and appended to a log file.  Storing
 // and replaying events access the disk.  File handles are kept open
 // no longer than necessary.
+//
+// The number of events per stream is read from the log file when
+// events are stored for the first time and tracked in memory
+// afterwards, for assigning stream versions and sequence numbers.
+// Therefore the log file must not be written to by other instances.
 type EventsOnDisk struct {
-	filename string
-	clock    Clock
+	filename    string
+	clock       Clock
+	fsync       bool
+	maxBytes    int
+	middlewares eventMiddlewares
+	versions    *streamVersions
 }
 
 // NewEventsOnDisk returns an new instance appending events to file
@@ -27,24 +38,131 @@ func NewEventsOnDisk(file string, clock Clock) (*EventsOnDisk, error) {
 	}, nil
 }
 
+// WithFsync configures whether Store flushes events to the disk
+// before returning.
+//
+// By default, events are only handed to the operating system, so
+// that events stored right before a crash of the operating system or
+// a power loss can be lost.  Enabling fsync guarantees that stored
+// events have reached the disk, at the cost of considerably reduced
+// throughput, because every call to Store waits for the disk.
+func (self *EventsOnDisk) WithFsync(fsync bool) *EventsOnDisk {
+	self.fsync = fsync
+	return self
+}
+
+// WithMaxEventBytes limits the size of the payload of stored events
+// to n bytes when serialized as JSON, before passing the events to
+// middlewares.  Storing events with a larger payload fails with an
+// *EventTooLargeError.  A limit of zero, the default, disables the
+// check.
+func (self *EventsOnDisk) WithMaxEventBytes(n int) *EventsOnDisk {
+	self.maxBytes = n
+	return self
+}
+
+// Use adds middleware to the middlewares which events pass through
+// before they are written to and after they are read from the log
+// file.
+func (self *EventsOnDisk) Use(middleware EventMiddleware) *EventsOnDisk {
+	self.middlewares = append(self.middlewares, middleware)
+	return self
+}
+
 // Store stores events by serializing them as JSON and appending them
-// to the configured log file.  Intermediate directories are created.
+// to the configured log file, assigning stream versions and sequence
+// numbers to them.  Intermediate directories are created.
+//
+// A truncated record at the end of the log file is removed before
+// appending events.  A last record which is only missing its newline
+// is kept.
 func (self *EventsOnDisk) Store(events []*Event) error {
+	return self.StoreBatch(events)
+}
+
+// StoreBatch stores all events of batches like Store, but opens the
+// log file only once and writes all events at once.  Use it for
+// storing large numbers of events, e.g. when importing historical
+// data.
+//
+// Batches are stored in order.  If storing any event fails, events
+// of earlier batches might have been stored already.  Payload sizes
+// are checked before any event is written, though.
+func (self *EventsOnDisk) StoreBatch(batches ...[]*Event) error {
+	for _, events := range batches {
+		if err := checkPayloadSizes(self.maxBytes, events); err != nil {
+			return err
+		}
+	}
+
 	os.MkdirAll(filepath.Dir(self.filename), 0700)
-	out, err := os.OpenFile(self.filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	out, err := os.OpenFile(self.filename, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0600)
 	if err != nil {
 		return err
 	}
 	defer out.Close()
 
-	enc := json.NewEncoder(out)
-	for _, event := range events {
-		event.Persist(self.clock)
-		if err := enc.Encode(event); err != nil {
+	if err := removeTruncatedRecord(out); err != nil {
+		return err
+	}
+	if err := self.loadVersions(); err != nil {
+		return err
+	}
+
+	// the versions are read from the log file again after a
+	// failure, since any part of the batches might have been
+	// written already
+	written := false
+	defer func() {
+		if !written {
+			self.versions = nil
+		}
+	}()
+
+	buffered := bufio.NewWriter(out)
+	enc := json.NewEncoder(buffered)
+	for _, events := range batches {
+		self.versions.assign(events)
+		for _, event := range events {
+			event.Persist(self.clock)
+		}
+		transformed, err := self.middlewares.beforeStore(events)
+		if err != nil {
 			return err
 		}
+
+		for _, event := range transformed {
+			if err := enc.Encode(event); err != nil {
+				return err
+			}
+		}
 	}
 
+	if err := buffered.Flush(); err != nil {
+		return err
+	}
+	written = true
+
+	if self.fsync {
+		return out.Sync()
+	}
+
+	return nil
+}
+
+// loadVersions reads the number of events per stream from the log
+// file, unless it has been read already.
+func (self *EventsOnDisk) loadVersions() error {
+	if self.versions != nil {
+		return nil
+	}
+
+	versions := newStreamVersions()
+	if err := self.Replay("*", EventHandlerFunc(versions.observe)); err != nil {
+		return err
+	}
+
+	self.versions = versions
 	return nil
 }
 
@@ -53,27 +171,201 @@ func (self *EventsOnDisk) Store(events []*Event) error {
 // Events are deserialized from the log file and then passed to
 // receiver.
 //
+// A truncated record at the end of the log file, as left behind by a
+// write interrupted by a crash, is ignored.  Malformed records
+// anywhere else cause Replay to fail.  A missing log file is treated
+// as an empty history.
+//
 // Use "*" as the streamId to match all events.
 func (self *EventsOnDisk) Replay(streamId string, receiver EventHandler) error {
+	events, err := self.Iterate(streamId)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer events.Close()
+
+	for events.Next() {
+		receiver.HandleEvent(events.Event())
+	}
+
+	return events.Err()
+}
+
+// Iterate returns an iterator reading events matching streamId from
+// the log file.  Events are read lazily, as the iterator advances.
+// The log file is kept open until the iterator is closed.
+//
+// Records are handled like in Replay.
+func (self *EventsOnDisk) Iterate(streamId string) (EventIterator, error) {
 	in, err := os.Open(self.filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return &diskEventIterator{
+		file:        in,
+		lines:       bufio.NewReader(in),
+		streamId:    streamId,
+		middlewares: self.middlewares,
+	}, nil
+}
+
+// diskEventIterator reads events from a log file written by
+// EventsOnDisk.
+type diskEventIterator struct {
+	file        *os.File
+	lines       *bufio.Reader
+	streamId    string
+	middlewares eventMiddlewares
+	event       *Event
+	err         error
+	done        bool
+}
+
+func (self *diskEventIterator) Next() bool {
+	for !self.done {
+		line, readErr := self.lines.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			self.err, self.done = readErr, true
+			return false
+		}
+		self.done = readErr == io.EOF
+
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		event := &Event{}
+		if err := json.Unmarshal(line, event); err != nil {
+			// every complete record ends with a newline
+			if readErr != io.EOF {
+				self.err, self.done = err, true
+			}
+			return false
+		}
+
+		if self.streamId != "*" && self.streamId != event.StreamId {
+			continue
+		}
+
+		if self.event, self.err = self.middlewares.afterLoad(event); self.err != nil {
+			self.done = true
+			return false
+		}
+		return true
+	}
+
+	return false
+}
+
+func (self *diskEventIterator) Event() *Event { return self.event }
+func (self *diskEventIterator) Err() error    { return self.err }
+
+func (self *diskEventIterator) Close() error {
+	self.done = true
+	return self.file.Close()
+}
+
+// DeleteStream removes all events with a matching stream id by
+// rewriting the log file using Compact.
+func (self *EventsOnDisk) DeleteStream(streamId string) error {
+	return self.Compact(func(event *Event) bool {
+		return event.StreamId != streamId
+	})
+}
+
+// Compact rewrites the log file, keeping only events for which keep
+// returns true.  Use this to remove events which are no longer needed,
+// e.g. the events of deleted aggregates.
+//
+// The remaining events are written to a temporary file first, which
+// then replaces the log file.  If compacting is interrupted, the log
+// file is left unchanged.
+func (self *EventsOnDisk) Compact(keep func(event *Event) bool) error {
+	tmp := self.filename + ".compact"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
 	if err != nil {
 		return err
 	}
+	defer os.Remove(tmp)
+	defer out.Close()
 
-	dec := json.NewDecoder(in)
-	for {
-		event := Event{}
-		err := dec.Decode(&event)
-		if err == io.EOF {
-			break
-		} else if err != nil {
+	enc := json.NewEncoder(out)
+	var encodeErr error
+	err = self.Replay("*", EventHandlerFunc(func(event *Event) {
+		if encodeErr == nil && keep(event) {
+			encodeErr = enc.Encode(event)
+		}
+	}))
+	if err != nil {
+		return err
+	}
+	if encodeErr != nil {
+		return encodeErr
+	}
+
+	if err := out.Sync(); err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	self.versions = nil
+	return os.Rename(tmp, self.filename)
+}
+
+// removeTruncatedRecord repairs the last record of file if it does
+// not end with a newline.  A last record which decodes as an event is
+// terminated with a newline, since Replay accepts it as well.  Any
+// other last record is the remainder of an interrupted write and file
+// is truncated after the preceding newline.
+//
+// file needs to be opened for appending.
+func removeTruncatedRecord(file *os.File) error {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, 4096)
+	end := info.Size()
+	start := int64(0)
+	for offset := end; offset > 0; {
+		n := int64(len(buf))
+		if offset < n {
+			n = offset
+		}
+		offset -= n
+
+		if _, err := file.ReadAt(buf[:n], offset); err != nil {
 			return err
 		}
 
-		if streamId == "*" || streamId == event.StreamId {
-			receiver.HandleEvent(&event)
+		if offset+n == end && buf[n-1] == '\n' {
+			return nil
+		}
+
+		if i := bytes.LastIndexByte(buf[:n], '\n'); i >= 0 {
+			start = offset + int64(i) + 1
+			break
 		}
 	}
 
-	return nil
+	if start == end {
+		return nil
+	}
+
+	last := make([]byte, end-start)
+	if _, err := file.ReadAt(last, start); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(last, &Event{}); err == nil {
+		_, err := file.Write([]byte{'\n'})
+		return err
+	}
+
+	return file.Truncate(start)
 }
@@ -0,0 +1,286 @@
+package ess
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// EventsWithSnapshots is a persistent, file-based implementation of
+// an EventStore which keeps all events in memory.  Additionally it
+// implements SnapshotStore, so that aggregates can be loaded from a
+// snapshot of their state and the events stored after it.
+//
+// Events are appended to an event log before they are added to
+// memory, and snapshots are appended to a separate snapshot log.
+// Neither log is rewritten when storing events or saving snapshots.
+// Loading the store reads both logs; replaying events never accesses
+// the disk.  Use Application.WithSnapshots for loading aggregates
+// from the snapshots kept by this store.
+//
+// Consistency guarantees: Store returns only after events have been
+// appended to the event log, SaveSnapshot only after the snapshot
+// has been appended to the snapshot log.  If storing events fails
+// halfway, the events written already are kept.  DeleteStream
+// rewrites both logs to temporary files, which are renamed into
+// place before the snapshots and events are removed from memory.
+// Partially written log entries, e.g. after a crash, cause loading
+// the store to fail.
+type EventsWithSnapshots struct {
+	dir   string
+	clock Clock
+
+	events   []*Event
+	versions *streamVersions
+
+	// snapshots holds the latest snapshot of every aggregate.
+	// Written counts the snapshots in the snapshot log, including
+	// superseded ones.
+	snapshots map[snapshotKey]*Snapshot
+	written   int
+}
+
+// snapshotKey identifies the snapshots of an aggregate.
+type snapshotKey struct {
+	aggregateType string
+	streamId      string
+}
+
+// NewEventsWithSnapshots returns a new instance storing its logs in
+// dir and using clock for marking events as persisted.  Any events
+// and snapshots stored in dir previously are loaded.
+func NewEventsWithSnapshots(dir string, clock Clock) (*EventsWithSnapshots, error) {
+	store := &EventsWithSnapshots{
+		dir:       filepath.Clean(dir),
+		clock:     clock,
+		events:    []*Event{},
+		versions:  newStreamVersions(),
+		snapshots: map[snapshotKey]*Snapshot{},
+	}
+
+	if err := store.load(); err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// eventsFile returns the name of the event log.
+func (self *EventsWithSnapshots) eventsFile() string {
+	return filepath.Join(self.dir, "events.json")
+}
+
+// snapshotsFile returns the name of the snapshot log.
+func (self *EventsWithSnapshots) snapshotsFile() string {
+	return filepath.Join(self.dir, "snapshots.json")
+}
+
+// load reads the event log and the snapshot log into memory.
+func (self *EventsWithSnapshots) load() error {
+	err := readLog(self.eventsFile(), func(dec *json.Decoder) error {
+		event := &Event{}
+		if err := dec.Decode(event); err != nil {
+			return err
+		}
+		self.events = append(self.events, event)
+		self.versions.observe(event)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return readLog(self.snapshotsFile(), func(dec *json.Decoder) error {
+		snapshot := &Snapshot{}
+		if err := dec.Decode(snapshot); err != nil {
+			return err
+		}
+		self.snapshots[snapshotKey{snapshot.AggregateType, snapshot.StreamId}] = snapshot
+		self.written++
+		return nil
+	})
+}
+
+// readLog calls decode until all entries of the log in file have been
+// decoded.  A missing file is treated like an empty log.
+func readLog(file string, decode func(dec *json.Decoder) error) error {
+	in, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	dec := json.NewDecoder(in)
+	for dec.More() {
+		if err := decode(dec); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// appendLog opens the log in file for appending, creating it if
+// necessary.
+func (self *EventsWithSnapshots) appendLog(file string) (*os.File, error) {
+	if err := os.MkdirAll(self.dir, 0700); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+}
+
+// rewriteLog replaces the log in file with the entries written by
+// write.  The entries are written to a temporary file first, which is
+// renamed into place once it has been synced to disk.
+func (self *EventsWithSnapshots) rewriteLog(file string, write func(enc *json.Encoder) error) error {
+	if err := os.MkdirAll(self.dir, 0700); err != nil {
+		return err
+	}
+
+	tmp := file + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if err := write(json.NewEncoder(out)); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, file)
+}
+
+// Store appends events to the event log and keeps them in memory.
+func (self *EventsWithSnapshots) Store(events []*Event) error {
+	out, err := self.appendLog(self.eventsFile())
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	self.versions.assign(events)
+	enc := json.NewEncoder(out)
+	for i, event := range events {
+		event.Persist(self.clock)
+		if err := enc.Encode(event); err != nil {
+			self.versions.rollback(events[i:])
+			self.events = append(self.events, events[:i]...)
+			return err
+		}
+	}
+
+	self.events = append(self.events, events...)
+	return nil
+}
+
+// LoadSnapshot returns the latest snapshot of the aggregate of type
+// aggregateType identified by streamId, or nil if there is none.
+// Snapshots are read from memory.
+func (self *EventsWithSnapshots) LoadSnapshot(aggregateType, streamId string) (*Snapshot, error) {
+	return self.snapshots[snapshotKey{aggregateType, streamId}], nil
+}
+
+// SaveSnapshot appends snapshot to the snapshot log and keeps it in
+// memory.  Once the log contains more than twice as many snapshots as
+// there are aggregates with snapshots, superseded snapshots are
+// removed from the log.
+func (self *EventsWithSnapshots) SaveSnapshot(snapshot *Snapshot) error {
+	out, err := self.appendLog(self.snapshotsFile())
+	if err != nil {
+		return err
+	}
+	err = json.NewEncoder(out).Encode(snapshot)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	self.snapshots[snapshotKey{snapshot.AggregateType, snapshot.StreamId}] = snapshot
+	self.written++
+	if self.written > 2*len(self.snapshots) {
+		return self.compactSnapshots(self.snapshots)
+	}
+
+	return nil
+}
+
+// compactSnapshots replaces the snapshot log with snapshots.
+func (self *EventsWithSnapshots) compactSnapshots(snapshots map[snapshotKey]*Snapshot) error {
+	err := self.rewriteLog(self.snapshotsFile(), func(enc *json.Encoder) error {
+		for _, snapshot := range snapshots {
+			if err := enc.Encode(snapshot); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	self.written = len(snapshots)
+	return nil
+}
+
+// DeleteStream removes all snapshots and events with a matching
+// stream id from the logs and then from memory.  Snapshots are
+// removed first, since they are taken again from the events if
+// rewriting the event log fails.
+func (self *EventsWithSnapshots) DeleteStream(streamId string) error {
+	keptSnapshots := map[snapshotKey]*Snapshot{}
+	for key, snapshot := range self.snapshots {
+		if key.streamId != streamId {
+			keptSnapshots[key] = snapshot
+		}
+	}
+	if err := self.compactSnapshots(keptSnapshots); err != nil {
+		return err
+	}
+	self.snapshots = keptSnapshots
+
+	kept := []*Event{}
+	for _, event := range self.events {
+		if event.StreamId != streamId {
+			kept = append(kept, event)
+		}
+	}
+	err := self.rewriteLog(self.eventsFile(), func(enc *json.Encoder) error {
+		for _, event := range kept {
+			if err := enc.Encode(event); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	self.events = kept
+	self.versions.forget(streamId)
+
+	return nil
+}
+
+// Replay handles all events with a matching stream id using receiver.
+// Events are replayed from memory.
+//
+// Use "*" as the stream id to match all events.
+func (self *EventsWithSnapshots) Replay(streamId string, receiver EventHandler) error {
+	for _, event := range self.events {
+		if streamId == "*" || streamId == event.StreamId {
+			receiver.HandleEvent(event)
+		}
+	}
+	return nil
+}
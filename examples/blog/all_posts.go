@@ -33,8 +33,12 @@ func NewProjectedPostFromEvent(event *ess.Event) *ProjectedPost {
 }
 
 func (self *ProjectedPost) Update(event *ess.Event) *ProjectedPost {
-	self.Title = event.Payload["title"].(string)
-	self.Body = event.Payload["body"].(string)
+	if title, ok := event.Payload["title"].(string); ok {
+		self.Title = title
+	}
+	if body, ok := event.Payload["body"].(string); ok {
+		self.Body = body
+	}
 	self.Paragraphs = strings.Split(
 		strings.NewReplacer("\r\n", "\n").Replace(self.Body),
 		"\n",
@@ -32,12 +32,12 @@ var (
 	SignUp = ess.NewCommandDefinition("sign-up").
 		Id("username", ess.Id()).
 		Field("email", ess.EmailAddress()).
-		Field("password", ess.Password()).
+		SecretField("password", ess.Password()).
 		Target(UserFromCommand)
 
 	LogIn = ess.NewCommandDefinition("login").
 		Id("username", ess.Id()).
-		Field("password", ess.Password()).
+		SecretField("password", ess.Password()).
 		Field("session", ess.TrimmedString()).
 		Target(UserFromCommand)
 
@@ -155,7 +155,7 @@ func (self *PostsResource) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	case "POST":
 		req.ParseForm()
 		req.Form["username"] = []string{currentUser.Username}
-		params := WritePost.FromForm(req)
+		params := WritePost.FromForm(req).GenerateIdWith(ess.RandomHexGenerator{Bytes: 8})
 		result := self.app.Send(params)
 		if err := result.Error(); err != nil {
 			ShowPostFormError(w, params, err)
@@ -7,6 +7,8 @@ type Post struct {
 	id      string
 	written bool
 	author  string
+	title   string
+	body    string
 }
 
 func NewPost(id string) *Post {
@@ -26,6 +28,14 @@ func (self *Post) HandleEvent(event *ess.Event) {
 		if author := event.Payload["author"]; author != nil {
 			self.author = author.(string)
 		}
+		fallthrough
+	case "post.edited":
+		if title, ok := event.Payload["title"].(string); ok {
+			self.title = title
+		}
+		if body, ok := event.Payload["body"].(string); ok {
+			self.body = body
+		}
 	}
 }
 
@@ -72,18 +82,25 @@ func (self *Post) Edit(title, body, reason, username string) error {
 		err.Add("reason", "empty")
 	}
 
-	if err.Ok() {
+	if !err.Ok() {
+		return err.Return()
+	}
+
+	changes := ess.Diff(
+		map[string]string{"title": self.title, "body": self.body},
+		map[string]string{"title": title, "body": body},
+	)
+	if len(changes) > 0 {
 		self.events.PublishEvent(
 			ess.NewEvent("post.edited").
 				For(self).
-				Add("title", title).
-				Add("body", body).
+				AddChanges(changes).
 				Add("author", username).
 				Add("reason", reason),
 		)
 	}
 
-	return err.Return()
+	return nil
 }
 
 func (self *Post) Write(title, body, author string) error {
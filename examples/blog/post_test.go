@@ -0,0 +1,94 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/dhamidi/ess"
+)
+
+func TestWritePost_projectsPost(t *testing.T) {
+	posts := NewAllPostsInMemory()
+	command := WritePost.NewCommand().
+		Set("id", "hello").
+		Set("title", "Hello").
+		Set("body", "World").
+		Set("username", "admin")
+
+	if _, err := WritePost.Simulate(command, nil, posts); err != nil {
+		t.Fatal(err)
+	}
+
+	post, err := posts.ById("hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := post.Title, "Hello"; got != want {
+		t.Errorf("post.Title = %q; want %q", got, want)
+	}
+	if got, want := post.Author, "admin"; got != want {
+		t.Errorf("post.Author = %q; want %q", got, want)
+	}
+}
+
+func TestEditPost_projectsChangedFields(t *testing.T) {
+	posts := NewAllPostsInMemory()
+	history, err := WritePost.Simulate(WritePost.NewCommand().
+		Set("id", "hello").
+		Set("title", "Hello").
+		Set("body", "World").
+		Set("username", "admin"), nil, posts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := EditPost.Simulate(EditPost.NewCommand().
+		Set("id", "hello").
+		Set("title", "Goodbye").
+		Set("body", "World").
+		Set("reason", "typo").
+		Set("username", "admin"), history, posts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(events), 1; got != want {
+		t.Fatalf("len(events) = %d; want %d", got, want)
+	}
+	if _, found := events[0].Payload["body"]; found {
+		t.Errorf("unchanged body in payload: %v", events[0].Payload)
+	}
+
+	post, err := posts.ById("hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := post.Title, "Goodbye"; got != want {
+		t.Errorf("post.Title = %q; want %q", got, want)
+	}
+	if got, want := post.Body, "World"; got != want {
+		t.Errorf("post.Body = %q; want %q", got, want)
+	}
+}
+
+func TestEditPost_emitsNothingForUnchangedPost(t *testing.T) {
+	history := []*ess.Event{
+		ess.NewEvent("post.written").For(NewPost("hello")).
+			Add("title", "Hello").
+			Add("body", "World").
+			Add("author", "admin"),
+	}
+
+	events, err := EditPost.Simulate(EditPost.NewCommand().
+		Set("id", "hello").
+		Set("title", "Hello").
+		Set("body", "World").
+		Set("reason", "typo").
+		Set("username", "admin"), history)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(events), 0; got != want {
+		t.Errorf("len(events) = %d; want %d", got, want)
+	}
+}
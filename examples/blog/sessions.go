@@ -1,19 +1,9 @@
 package main
 
-import (
-	"crypto/rand"
-	"fmt"
-
-	"github.com/dhamidi/ess"
-)
+import "github.com/dhamidi/ess"
 
 func GenerateSessionId() string {
-	id := make([]byte, 16)
-	_, err := rand.Read(id)
-	if err != nil {
-		panic(err)
-	}
-	return fmt.Sprintf("%x", id)
+	return ess.RandomHexGenerator{}.Generate()
 }
 
 type ProjectedUser struct {
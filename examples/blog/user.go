@@ -53,12 +53,12 @@ func (self *User) SignUp(params *ess.Command) error {
 func (self *User) Login(session string, password *ess.BcryptedPassword) error {
 	err := ess.NewValidationError()
 
-	if !self.signedUp {
-		err.Add("user", "not_found")
-	}
-
-	if !password.Matches(self.password) {
-		err.Add("password", "mismatch")
+	// Unknown users and wrong passwords are reported alike, so that
+	// logging in does not reveal which users exist.  The password is
+	// compared in either case, see ess.CompareOrDummy.
+	matches := password.Matches(self.password)
+	if !self.signedUp || !matches {
+		err.Add("password", "invalid_credentials")
 	}
 
 	if err.Ok() {
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/dhamidi/ess"
+)
+
+func TestLogIn_reportsUnknownUserLikeWrongPassword(t *testing.T) {
+	history, err := SignUp.Simulate(SignUp.NewCommand().
+		Set("username", "admin").
+		Set("email", "admin@example.com").
+		Set("password", "secret"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loginErrors := func(username string, history []*ess.Event) map[string][]string {
+		_, err := LogIn.Simulate(LogIn.NewCommand().
+			Set("username", username).
+			Set("password", "wrong").
+			Set("session", "session"), history)
+		verr, ok := err.(*ess.ValidationError)
+		if !ok {
+			t.Fatalf("LogIn(%q) = %v; want *ess.ValidationError", username, err)
+		}
+		return verr.Errors
+	}
+
+	unknown := loginErrors("nobody", nil)
+	wrong := loginErrors("admin", history)
+	if got, want := unknown, wrong; !reflect.DeepEqual(got, want) {
+		t.Errorf("unknown user errors = %v; want %v", got, want)
+	}
+	if got, want := wrong, map[string][]string{"password": {"invalid_credentials"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong password errors = %v; want %v", got, want)
+	}
+}
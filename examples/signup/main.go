@@ -12,7 +12,7 @@ var SignUp = ess.NewCommandDefinition("sign-up").
 	Id("username", ess.Id()).
 	Field("name", ess.TrimmedString()).
 	Field("email", ess.EmailAddress()).
-	Field("password", ess.Password()).
+	SecretField("password", ess.Password()).
 	Target(NewUserFromCommand)
 
 func NewUserFromCommand(command *ess.Command) ess.Aggregate {
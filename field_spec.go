@@ -0,0 +1,83 @@
+package ess
+
+import "sort"
+
+// FieldSpec describes a field of a command, e.g. for rendering forms
+// for sending commands.
+type FieldSpec struct {
+	// Name is the name of the field.
+	Name string
+
+	// Kind describes the kind of input expected by the field,
+	// e.g. "text", "email" or "password".  It is derived from the
+	// field's value and matches the type of the corresponding
+	// HTML input element where possible.
+	Kind string
+
+	// Id is true if the field identifies the command's receiver.
+	Id bool
+}
+
+// FieldSpecs returns descriptions of all fields of commands of this
+// type, ordered by name.  Secret fields are of kind "password".
+func (self *CommandDefinition) FieldSpecs() []FieldSpec {
+	specs := []FieldSpec{}
+	for name, value := range self.Fields {
+		kind := valueKind(value)
+		if self.Secret[name] {
+			kind = "password"
+		}
+
+		specs = append(specs, FieldSpec{
+			Name: name,
+			Kind: kind,
+			Id:   self.isIdField(name),
+		})
+	}
+
+	sort.Slice(specs, func(i, j int) bool {
+		return specs[i].Name < specs[j].Name
+	})
+
+	return specs
+}
+
+// isIdField returns true if the field identified by name is part of
+// the id of the command's receiver.
+func (self *CommandDefinition) isIdField(name string) bool {
+	for _, field := range self.IdFields {
+		if field == name {
+			return true
+		}
+	}
+	return name == self.IdField
+}
+
+// valueKind returns the kind of input accepted by value.  Values of
+// unknown types are of kind "text".
+func valueKind(value Value) string {
+	switch value := value.(type) {
+	case *Email:
+		return "email"
+	case *BcryptedPassword:
+		return "password"
+	case *PhoneNumber:
+		return "tel"
+	case *Date:
+		return "date"
+	case *Time:
+		return "datetime"
+	case *BusinessDate:
+		return "number"
+	case *Choice:
+		return "select"
+	case *StringList, *Tokens:
+		return "list"
+	case *Normalized:
+		return valueKind(value.Inner())
+	case *OptionalValue:
+		return valueKind(value.Inner())
+	}
+
+	return "text"
+}
@@ -0,0 +1,32 @@
+package ess
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCommandDefinition_FieldSpecs_describesFields(t *testing.T) {
+	definition := NewCommandDefinition("sign-up").
+		Id("username", TrimmedString()).
+		Field("email", EmailAddress()).
+		Field("password", &BcryptedPassword{}).
+		SecretField("code", TrimmedString()).
+		Field("role", Enum("admin", "user")).
+		Field("born_on", &Date{}).
+		Field("backup_email", Optional(EmailAddress())).
+		Normalize("email", func(s string) string { return s })
+
+	expected := []FieldSpec{
+		{Name: "backup_email", Kind: "email"},
+		{Name: "born_on", Kind: "date"},
+		{Name: "code", Kind: "password"},
+		{Name: "email", Kind: "email"},
+		{Name: "password", Kind: "password"},
+		{Name: "role", Kind: "select"},
+		{Name: "username", Kind: "text", Id: true},
+	}
+
+	if got, want := definition.FieldSpecs(), expected; !reflect.DeepEqual(got, want) {
+		t.Errorf("definition.FieldSpecs() = %v; want %v", got, want)
+	}
+}
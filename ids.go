@@ -0,0 +1,50 @@
+package ess
+
+import (
+	"crypto/rand"
+	"fmt"
+)
+
+// UUIDGenerator generates random (version 4) UUIDs, e.g.
+// "6ba7b810-9dad-41d1-80b4-00c04fd430c8".
+type UUIDGenerator struct{}
+
+// Generate returns a new random UUID.
+func (self UUIDGenerator) Generate() string {
+	id := randomBytes(16)
+	id[6] = (id[6] & 0x0f) | 0x40
+	id[8] = (id[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:16])
+}
+
+// RandomHexGenerator generates identifiers consisting of random bytes
+// encoded as hexadecimal digits.
+type RandomHexGenerator struct {
+	// Bytes is the number of random bytes per identifier,
+	// defaults to 16.
+	Bytes int
+}
+
+// Generate returns a new random identifier.
+func (self RandomHexGenerator) Generate() string {
+	n := self.Bytes
+	if n <= 0 {
+		n = 16
+	}
+	return fmt.Sprintf("%x", randomBytes(n))
+}
+
+// randomBytes returns n bytes read from crypto/rand.
+func randomBytes(n int) []byte {
+	data := make([]byte, n)
+	if _, err := rand.Read(data); err != nil {
+		panic(err)
+	}
+	return data
+}
+
+// generateId returns a new random identifier consisting of 32
+// hexadecimal digits.
+func generateId() string {
+	return RandomHexGenerator{}.Generate()
+}
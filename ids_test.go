@@ -0,0 +1,53 @@
+package ess
+
+import (
+	"regexp"
+	"testing"
+)
+
+type sequenceGenerator struct{ next []string }
+
+func (self *sequenceGenerator) Generate() string {
+	id := self.next[0]
+	self.next = self.next[1:]
+	return id
+}
+
+func TestCommand_GenerateIdWith_setsEmptyIdField(t *testing.T) {
+	cmd := TestCommand.NewCommand().
+		FromForm(URLValues{}).
+		GenerateIdWith(&sequenceGenerator{next: []string{"generated"}})
+
+	if got, want := cmd.AggregateId(), "generated"; got != want {
+		t.Errorf("cmd.AggregateId() = %q; want %q", got, want)
+	}
+
+	if err := cmd.Validate(); err != nil {
+		t.Errorf("cmd.Validate() = %v; want %v", err, nil)
+	}
+}
+
+func TestCommand_GenerateIdWith_keepsExistingId(t *testing.T) {
+	cmd := TestCommand.NewCommand().
+		Set("id", "given").
+		GenerateIdWith(&sequenceGenerator{next: []string{"generated"}})
+
+	if got, want := cmd.AggregateId(), "given"; got != want {
+		t.Errorf("cmd.AggregateId() = %q; want %q", got, want)
+	}
+}
+
+func TestUUIDGenerator_Generate_returnsVersion4UUIDs(t *testing.T) {
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	id := UUIDGenerator{}.Generate()
+
+	if !uuid.MatchString(id) {
+		t.Errorf("UUIDGenerator{}.Generate() = %q; want UUID", id)
+	}
+}
+
+func TestRandomHexGenerator_Generate_returnsHexDigits(t *testing.T) {
+	if got, want := len(RandomHexGenerator{Bytes: 4}.Generate()), 8; got != want {
+		t.Errorf("len(RandomHexGenerator{Bytes: 4}.Generate()) = %d; want %d", got, want)
+	}
+}
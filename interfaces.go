@@ -2,6 +2,8 @@ package ess
 
 import (
 	"encoding"
+	"io"
+	"net/url"
 	"time"
 )
 
@@ -34,6 +36,13 @@ type Clock interface {
 	Now() time.Time
 }
 
+// IdGenerator is an interface for generating identifiers, e.g. for
+// new aggregates.
+type IdGenerator interface {
+	// Generate returns a new identifier.
+	Generate() string
+}
+
 // Value is defines the interface for converting text into Go values.
 // A value is used for capturing, sanitizing and validating the
 // parameters accepted by commands.
@@ -65,6 +74,49 @@ type CommandHandler interface {
 	HandleCommand(command *Command) error
 }
 
+// CommandMiddleware wraps the processing of commands by an
+// application, e.g. for checking authorization or logging.  It is
+// passed the function processing the command next and returns a
+// function to be called instead.  Returning a result without calling
+// next stops processing the command.
+//
+// Example:
+//
+//	func RequireUser(next func(*ess.Command) *ess.CommandResult) func(*ess.Command) *ess.CommandResult {
+//		return func(command *ess.Command) *ess.CommandResult {
+//			if command.Metadata["user"] == "" {
+//				return ess.NewErrorResult(ErrUnauthorized)
+//			}
+//			return next(command)
+//		}
+//	}
+type CommandMiddleware func(next func(*Command) *CommandResult) func(*Command) *CommandResult
+
+// Authorizer decides whether a command may be processed, e.g. based
+// on a field of the command identifying the acting user.
+type Authorizer interface {
+	// Authorize returns an error if command must not be
+	// processed.
+	Authorize(command *Command) error
+}
+
+// AuthorizerFunc is a wrapper type to allow a function to fulfill
+// the Authorizer interface by calling the function.
+type AuthorizerFunc func(command *Command) error
+
+// Authorize implements the Authorizer interface.
+func (self AuthorizerFunc) Authorize(command *Command) error { return self(command) }
+
+// CommandLister is implemented by aggregates which list the names of
+// the commands they handle.  Commands with other names, which are
+// processed without emitting events, are rejected with
+// ErrCommandNotHandled.
+type CommandLister interface {
+	// KnownCommands returns the names of all commands handled
+	// by the aggregate.
+	KnownCommands() []string
+}
+
 // EventHandler defines the interface for processing events.
 type EventHandler interface {
 	HandleEvent(event *Event)
@@ -77,8 +129,125 @@ type EventHandlerFunc func(event *Event)
 // HandleEvent implements the EventHandler interface.
 func (self EventHandlerFunc) HandleEvent(event *Event) { self(event) }
 
+// FallibleEventHandler defines the interface for processing events
+// in a way that can fail, e.g. when writing to an external system.
+type FallibleEventHandler interface {
+	// TryHandleEvent processes event and returns an error if
+	// processing failed.
+	TryHandleEvent(event *Event) error
+}
+
+// FallibleEventHandlerFunc is a wrapper type to allow a function to
+// fulfill the FallibleEventHandler interface by calling the function.
+type FallibleEventHandlerFunc func(event *Event) error
+
+// TryHandleEvent implements the FallibleEventHandler interface.
+func (self FallibleEventHandlerFunc) TryHandleEvent(event *Event) error { return self(event) }
+
+// Query represents a request for information sent to the
+// application.  Queries never change application state.
+//
+// Queries are routed to their handlers by type, so every kind of
+// query is a type of its own, usually a struct carrying the query's
+// parameters, e.g. RecentPosts{Limit: 10}.
+type Query interface{}
+
+// QueryHandler defines the interface for answering queries, usually
+// implemented by projections.
+type QueryHandler interface {
+	// HandleQuery returns the answer to query or an error if the
+	// query cannot be answered.
+	HandleQuery(query Query) (interface{}, error)
+}
+
+// QueryHandlerFunc is a wrapper type to allow a function to fulfill
+// the QueryHandler interface by calling the function.
+type QueryHandlerFunc func(query Query) (interface{}, error)
+
+// HandleQuery implements the QueryHandler interface.
+func (self QueryHandlerFunc) HandleQuery(query Query) (interface{}, error) { return self(query) }
+
+// ExportableProjection is a projection which can write its current
+// state to a writer, e.g. for making backups.
+//
+// The data written by Export needs to be valid JSON.
+type ExportableProjection interface {
+	EventHandler
+
+	// Export writes the projection's current state as JSON to w.
+	Export(w io.Writer) error
+}
+
+// ImportableProjection is a projection which can restore its state
+// from data previously written by Export.
+type ImportableProjection interface {
+	EventHandler
+
+	// Import replaces the projection's current state with the
+	// state read from r.
+	Import(r io.Reader) error
+}
+
+// CheckpointedProjection is a projection which persists its own
+// state and reports the id of the last event it has handled, so that
+// events handled already do not need to be replayed when the
+// application starts.  See Application.WithCheckpoints.
+type CheckpointedProjection interface {
+	EventHandler
+
+	// Checkpoint returns the id of the last event handled by the
+	// projection.
+	Checkpoint() string
+}
+
+// PersistentProjection is a projection which persists the id of the
+// last event it has handled together with its own state, e.g. in the
+// same database transaction.  Application.Init skips the events up
+// to and including the loaded checkpoint while replaying history.
+type PersistentProjection interface {
+	EventHandler
+
+	// LoadCheckpoint returns the id of the last event handled by
+	// the projection.  If the projection has not handled any
+	// events yet, an empty string is returned.
+	LoadCheckpoint() (string, error)
+}
+
+// LiveProjection is a projection which only handles events as they
+// happen, e.g. because handling an event has side effects outside of
+// the application.  Application.Init does not replay the history
+// through projections which skip replaying.
+type LiveProjection interface {
+	EventHandler
+
+	// SkipsReplay returns true if the projection must not be
+	// passed events while replaying history.
+	SkipsReplay() bool
+}
+
+// ResettableProjection is a projection which can discard its current
+// state, so that it can be rebuilt by replaying the history.
+type ResettableProjection interface {
+	EventHandler
+
+	// Reset discards the projection's current state.
+	Reset() error
+}
+
+// Subscribable is implemented by types that allow receiving events
+// over a channel as they happen.
+type Subscribable interface {
+	// Subscribe returns a channel receiving new events and a
+	// function for cancelling the subscription.
+	Subscribe() (<-chan *Event, func())
+}
+
 // EventStore defines the necessary operations for persisting events
 // and restoring application state from the log of persisted events.
+//
+// Event stores holding resources, e.g. open files, buffers or network
+// connections, should additionally implement io.Closer.  Close is
+// called by Application.Close and should flush any buffered events.
 type EventStore interface {
 	// Store append events to the store in a manner that allows
 	// them to be retrieved by Replay.  The returned error is
@@ -95,6 +264,115 @@ type EventStore interface {
 	Replay(streamId string, receiver EventHandler) error
 }
 
+// StreamDeleter is implemented by event stores which support removing
+// whole streams.
+//
+// This intentionally breaks the immutability of the event log and is
+// meant for cases in which data has to be forgotten, e.g. for legal
+// reasons.
+type StreamDeleter interface {
+	// DeleteStream removes all events belonging to the stream
+	// identified by streamId, so that they are not replayed
+	// anymore.
+	DeleteStream(streamId string) error
+}
+
+// SnapshotStore persists snapshots of aggregates, so that loading an
+// aggregate only requires replaying the events stored after its
+// latest snapshot.  See Application.WithSnapshots.
+//
+// Snapshot stores should implement StreamDeleter as well, so that
+// Application.DeleteStream removes the snapshots of deleted streams.
+type SnapshotStore interface {
+	// LoadSnapshot returns the latest snapshot of the aggregate
+	// of type aggregateType identified by streamId.  If no
+	// snapshot has been saved, nil is returned.
+	LoadSnapshot(aggregateType, streamId string) (*Snapshot, error)
+
+	// SaveSnapshot records snapshot as the latest snapshot of
+	// its aggregate.
+	SaveSnapshot(snapshot *Snapshot) error
+}
+
+// SnapshottableAggregate is an aggregate whose state can be captured
+// in a snapshot and restored from it.
+type SnapshottableAggregate interface {
+	Aggregate
+
+	// MarshalSnapshot encodes the aggregate's current state.
+	MarshalSnapshot() ([]byte, error)
+
+	// UnmarshalSnapshot restores the state encoded by
+	// MarshalSnapshot.
+	UnmarshalSnapshot(data []byte) error
+}
+
+// EventIterator provides access to a sequence of events, one event at
+// a time.
+//
+// Example:
+//
+//	events, err := store.Iterate("*")
+//	if err != nil {
+//		return err
+//	}
+//	defer events.Close()
+//	for events.Next() {
+//		fmt.Println(events.Event().Name)
+//	}
+//	return events.Err()
+type EventIterator interface {
+	// Next advances the iterator to the next event.  It returns
+	// false if there are no more events or an error occurred.
+	Next() bool
+
+	// Event returns the current event.
+	Event() *Event
+
+	// Err returns the error that stopped the iteration, if any.
+	Err() error
+
+	// Close releases any resources held by the iterator.  It is
+	// safe to call Close before the iteration has finished.
+	Close() error
+}
+
+// IterableEventStore is implemented by event stores which provide
+// access to events through an EventIterator, as an alternative to
+// Replay.
+type IterableEventStore interface {
+	// Iterate returns an iterator over the events belonging to
+	// the stream identified by streamId.  Use "*" as the
+	// streamId to iterate over all events.
+	Iterate(streamId string) (EventIterator, error)
+}
+
+// CheckpointStore persists the id of the last event a projection has
+// handled, so that the projection can resume from there after the
+// application has been restarted.
+type CheckpointStore interface {
+	// LoadCheckpoint returns the id of the last event handled by
+	// the projection called name.  If no checkpoint has been
+	// saved, an empty string is returned.
+	LoadCheckpoint(name string) (string, error)
+
+	// SaveCheckpoint records eventId as the last event handled
+	// by the projection called name.
+	SaveCheckpoint(name string, eventId string) error
+}
+
+// DeadLetterStore records events which a projection has failed to
+// handle repeatedly, so that operators can inspect and resolve them.
+type DeadLetterStore interface {
+	// StoreDeadLetter records letter.  Recording a letter for
+	// the same projection and event again has no effect.
+	StoreDeadLetter(letter DeadLetter) error
+
+	// DeadLetters returns all recorded dead letters in the order
+	// in which they have been recorded.
+	DeadLetters() []DeadLetter
+}
+
 // Form defines how to access form values.  This allows commands to
 // fill in parameters automatically.
 //
@@ -105,3 +383,56 @@ type Form interface {
 	// field "field".
 	FormValue(field string) string
 }
+
+// MultiValueForm is a form which provides access to all values
+// submitted for a field, e.g. for multi-selects.
+type MultiValueForm interface {
+	Form
+
+	// FormValues returns all string values associated with the
+	// form field "field".
+	FormValues(field string) []string
+}
+
+// MultiValue is a value that can capture all values submitted for a
+// field through a MultiValueForm.
+type MultiValue interface {
+	Value
+
+	// UnmarshalValues sets this value from all values submitted
+	// for a field.
+	UnmarshalValues(values []string) error
+}
+
+// PartialForm is a form which can tell whether a field has been
+// submitted at all, as opposed to having been submitted empty.
+type PartialForm interface {
+	Form
+
+	// Has returns true if the form contains the field "field".
+	Has(field string) bool
+}
+
+// URLValues adapts url.Values to the MultiValueForm and PartialForm
+// interfaces.  Use
+// it for populating commands from a parsed HTTP request:
+//
+//	req.ParseForm()
+//	command := Definition.FromForm(ess.URLValues(req.Form))
+type URLValues url.Values
+
+// FormValue returns the first value associated with field.
+func (self URLValues) FormValue(field string) string {
+	return url.Values(self).Get(field)
+}
+
+// FormValues returns all values associated with field.
+func (self URLValues) FormValues(field string) []string {
+	return self[field]
+}
+
+// Has returns true if any value is associated with field.
+func (self URLValues) Has(field string) bool {
+	_, found := self[field]
+	return found
+}
@@ -0,0 +1,277 @@
+package ess
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+// JSONSchema returns a JSON Schema object describing the fields of
+// commands of this type, e.g. for generating client-side validation
+// or API documentation.
+//
+// Every field is described as a string, since that is how field
+// values are transmitted.  Constraints such as formats, patterns,
+// allowed values and lengths are derived from the field's value
+// where possible.  Patterns are only included if they accept every
+// input accepted by the value and can be expressed in ECMA-262, the
+// regular expression dialect of JSON Schema.  Fields are required unless they are optional or
+// have a default.  Secret fields are marked as write-only.
+func (self *CommandDefinition) JSONSchema() map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := []string{}
+	for name, value := range self.Fields {
+		property := valueSchema(value)
+		if self.Secret[name] {
+			property["writeOnly"] = true
+		}
+		if text, found := self.Defaults[name]; found {
+			property["default"] = text
+		}
+		properties[name] = property
+
+		if _, optional := value.(*OptionalValue); !optional && self.Defaults[name] == "" {
+			required = append(required, name)
+		}
+	}
+	sort.Strings(required)
+
+	return map[string]interface{}{
+		"$schema":              "http://json-schema.org/draft-07/schema#",
+		"title":                self.Name,
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}
+}
+
+// valueSchema returns the schema of a single field holding value.
+func valueSchema(value Value) map[string]interface{} {
+	schema := map[string]interface{}{"type": "string"}
+
+	switch value := value.(type) {
+	case *String:
+		if value.minLen > 0 {
+			schema["minLength"] = value.minLen
+		}
+		if value.maxLen > 0 {
+			schema["maxLength"] = value.maxLen
+		}
+	case *Identifier:
+		if pattern, ok := ecmaPattern(identifierRegexp); ok {
+			schema["pattern"] = pattern
+		}
+	case *Email:
+		schema["format"] = "email"
+	case *Date:
+		schema["format"] = "date"
+	case *Time:
+		schema["format"] = "date-time"
+	case *Matching:
+		if pattern, ok := ecmaPattern(value.pattern); ok {
+			schema["pattern"] = pattern
+		}
+	case *Choice:
+		if !value.allowUnknown {
+			schema["enum"] = append([]string{}, value.allowed...)
+		}
+	case *OptionalValue:
+		return valueSchema(value.Inner())
+	case *Normalized:
+		return valueSchema(value.Inner())
+	}
+
+	return schema
+}
+
+// ecmaPattern translates pattern, which is matched against input with
+// surrounding whitespace removed, into an equivalent ECMA-262 regular
+// expression matching the untrimmed input.  The second return value
+// is false if pattern cannot be expressed in ECMA-262.
+func ecmaPattern(pattern *regexp.Regexp) (string, bool) {
+	re, err := syntax.Parse(pattern.String(), syntax.Perl)
+	if err != nil {
+		return "", false
+	}
+
+	out := &strings.Builder{}
+	subs := []*syntax.Regexp{re}
+	if re.Op == syntax.OpConcat {
+		subs = re.Sub
+	}
+	anchored := len(subs) >= 2 &&
+		subs[0].Op == syntax.OpBeginText &&
+		subs[len(subs)-1].Op == syntax.OpEndText
+	if anchored {
+		// Whitespace removed by the value before matching is
+		// allowed around the anchored pattern.
+		out.WriteString(`^\s*(?:`)
+		subs = subs[1 : len(subs)-1]
+	}
+	for _, sub := range subs {
+		if !writeECMA(out, sub) {
+			return "", false
+		}
+	}
+	if anchored {
+		out.WriteString(`)\s*$`)
+	}
+
+	return out.String(), true
+}
+
+// writeECMA writes re to out in ECMA-262 syntax.  It returns false if
+// re uses features without an equivalent in ECMA-262, e.g. anchors
+// other than surrounding the whole pattern or multi-line mode.
+func writeECMA(out *strings.Builder, re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpEmptyMatch:
+		out.WriteString("(?:)")
+	case syntax.OpLiteral:
+		for _, r := range re.Rune {
+			if re.Flags&syntax.FoldCase != 0 {
+				folded := []rune{r, r}
+				for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+					folded = append(folded, f, f)
+				}
+				if !writeECMAClass(out, folded) {
+					return false
+				}
+			} else {
+				writeECMARune(out, r, `\.+*?()|[]{}^$/`)
+			}
+		}
+	case syntax.OpCharClass:
+		return writeECMAClass(out, re.Rune)
+	case syntax.OpAnyCharNotNL:
+		// "." also excludes \r, \u2028 and \u2029 in ECMA-262
+		out.WriteString(`[^\n]`)
+	case syntax.OpAnyChar:
+		out.WriteString(`[\s\S]`)
+	case syntax.OpWordBoundary:
+		out.WriteString(`\b`)
+	case syntax.OpNoWordBoundary:
+		out.WriteString(`\B`)
+	case syntax.OpCapture:
+		out.WriteString("(?:")
+		if !writeECMA(out, re.Sub[0]) {
+			return false
+		}
+		out.WriteString(")")
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest, syntax.OpRepeat:
+		sub := re.Sub[0]
+		single := sub.Op == syntax.OpCharClass || sub.Op == syntax.OpAnyChar || sub.Op == syntax.OpAnyCharNotNL ||
+			sub.Op == syntax.OpLiteral && len(sub.Rune) == 1 && sub.Rune[0] <= 0xFFFF
+		if !single {
+			out.WriteString("(?:")
+		}
+		if !writeECMA(out, sub) {
+			return false
+		}
+		if !single {
+			out.WriteString(")")
+		}
+		switch {
+		case re.Op == syntax.OpStar:
+			out.WriteString("*")
+		case re.Op == syntax.OpPlus:
+			out.WriteString("+")
+		case re.Op == syntax.OpQuest:
+			out.WriteString("?")
+		case re.Max < 0:
+			fmt.Fprintf(out, "{%d,}", re.Min)
+		case re.Max == re.Min:
+			fmt.Fprintf(out, "{%d}", re.Min)
+		default:
+			fmt.Fprintf(out, "{%d,%d}", re.Min, re.Max)
+		}
+		if re.Flags&syntax.NonGreedy != 0 {
+			out.WriteString("?")
+		}
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			if !writeECMA(out, sub) {
+				return false
+			}
+		}
+	case syntax.OpAlternate:
+		out.WriteString("(?:")
+		for i, sub := range re.Sub {
+			if i > 0 {
+				out.WriteString("|")
+			}
+			if !writeECMA(out, sub) {
+				return false
+			}
+		}
+		out.WriteString(")")
+	default:
+		return false
+	}
+
+	return true
+}
+
+// writeECMAClass writes the character class consisting of the rune
+// ranges in ranges to out.  Classes extending to unicode.MaxRune,
+// e.g. negated classes, are written as the negation of their
+// complement.  Classes containing characters outside of the Basic
+// Multilingual Plane cannot be written.
+func writeECMAClass(out *strings.Builder, ranges []rune) bool {
+	negated := len(ranges) > 0 && ranges[len(ranges)-1] == unicode.MaxRune
+	if negated {
+		complement := []rune{}
+		next := rune(0)
+		for i := 0; i < len(ranges); i += 2 {
+			if ranges[i] > next {
+				complement = append(complement, next, ranges[i]-1)
+			}
+			next = ranges[i+1] + 1
+		}
+		ranges = complement
+	}
+	if len(ranges) == 0 {
+		return false
+	}
+
+	out.WriteString("[")
+	if negated {
+		out.WriteString("^")
+	}
+	for i := 0; i < len(ranges); i += 2 {
+		lo, hi := ranges[i], ranges[i+1]
+		if hi > 0xFFFF {
+			return false
+		}
+		writeECMARune(out, lo, `\]^-[`)
+		if hi > lo {
+			out.WriteString("-")
+			writeECMARune(out, hi, `\]^-[`)
+		}
+	}
+	out.WriteString("]")
+
+	return true
+}
+
+// writeECMARune writes r to out, escaping it if it is one of special
+// or not printable ASCII.
+func writeECMARune(out *strings.Builder, r rune, special string) {
+	switch {
+	case strings.ContainsRune(special, r):
+		out.WriteString(`\`)
+		out.WriteRune(r)
+	case r > 0xFFFF:
+		high, low := utf16.EncodeRune(r)
+		fmt.Fprintf(out, `\u%04X\u%04X`, high, low)
+	case r < 0x20 || r > 0x7E:
+		fmt.Fprintf(out, `\u%04X`, r)
+	default:
+		out.WriteRune(r)
+	}
+}
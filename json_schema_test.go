@@ -0,0 +1,69 @@
+package ess
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestCommandDefinition_JSONSchema_describesFieldConstraints(t *testing.T) {
+	definition := NewCommandDefinition("sign-up").
+		Id("username", Id()).
+		Field("email", EmailAddress()).
+		Field("role", Enum("admin", "user")).
+		Field("nickname", Optional(TrimmedString())).
+		Normalize("email", func(s string) string { return s })
+
+	schema := definition.JSONSchema()
+	properties := schema["properties"].(map[string]interface{})
+
+	email := properties["email"].(map[string]interface{})
+	if got, want := email["format"], "email"; got != want {
+		t.Errorf(`email["format"] = %v; want %v`, got, want)
+	}
+
+	username := properties["username"].(map[string]interface{})
+	if got, want := username["pattern"], `^\s*(?:[\-0-9a-z]+)\s*$`; got != want {
+		t.Errorf(`username["pattern"] = %v; want %v`, got, want)
+	}
+
+	role := properties["role"].(map[string]interface{})
+	if got, want := role["enum"], []string{"admin", "user"}; !reflect.DeepEqual(got, want) {
+		t.Errorf(`role["enum"] = %v; want %v`, got, want)
+	}
+
+	if got, want := schema["required"], []string{"email", "role", "username"}; !reflect.DeepEqual(got, want) {
+		t.Errorf(`schema["required"] = %v; want %v`, got, want)
+	}
+
+	if _, err := json.Marshal(schema); err != nil {
+		t.Errorf("json.Marshal(schema): %s", err)
+	}
+}
+
+func TestCommandDefinition_JSONSchema_omitsPatternsStricterThanParser(t *testing.T) {
+	definition := NewCommandDefinition("call").
+		Field("phone", Phone()).
+		Field("code", Pattern(regexp.MustCompile(`^[A-Z]{3}-[0-9]{4}$`), "malformed_code")).
+		Field("name", Pattern(regexp.MustCompile(`^\pL+$`), "malformed_name"))
+
+	properties := definition.JSONSchema()["properties"].(map[string]interface{})
+
+	if pattern, found := properties["phone"].(map[string]interface{})["pattern"]; found {
+		t.Errorf(`phone["pattern"] = %v; want none`, pattern)
+	}
+	if pattern, found := properties["name"].(map[string]interface{})["pattern"]; found {
+		t.Errorf(`name["pattern"] = %v; want none`, pattern)
+	}
+
+	code := properties["code"].(map[string]interface{})["pattern"].(string)
+	for _, input := range []string{"ABC-1234", " ABC-1234 "} {
+		if err := Pattern(regexp.MustCompile(`^[A-Z]{3}-[0-9]{4}$`), "malformed_code").UnmarshalText([]byte(input)); err != nil {
+			t.Fatalf("UnmarshalText(%q): %s", input, err)
+		}
+		if !regexp.MustCompile(code).MatchString(input) {
+			t.Errorf("pattern %q does not match %q", code, input)
+		}
+	}
+}
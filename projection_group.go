@@ -0,0 +1,57 @@
+package ess
+
+import "errors"
+
+// ErrNotResettable is returned when resetting a projection group
+// containing members which cannot be reset.
+var ErrNotResettable = errors.New("not_resettable")
+
+// ProjectionGroup is an EventHandler passing events to several
+// handlers, so that they can be registered with an application as a
+// single projection.  Use it for handlers which together maintain one
+// read model, e.g. updating a database and invalidating a cache.
+//
+// Example:
+//
+//	app.WithProjection("orders", ess.NewProjectionGroup(ordersTable, ordersCache))
+type ProjectionGroup struct {
+	members []EventHandler
+}
+
+// NewProjectionGroup returns a new group passing events to members.
+func NewProjectionGroup(members ...EventHandler) *ProjectionGroup {
+	return &ProjectionGroup{
+		members: members,
+	}
+}
+
+// HandleEvent passes event to all members of the group in order.
+func (self *ProjectionGroup) HandleEvent(event *Event) {
+	for _, member := range self.members {
+		member.HandleEvent(event)
+	}
+}
+
+// Reset resets all members of the group in order, returning the
+// first error encountered.
+//
+// If any member does not implement ResettableProjection, no member
+// is reset and ErrNotResettable is returned.
+func (self *ProjectionGroup) Reset() error {
+	resettable := []ResettableProjection{}
+	for _, member := range self.members {
+		projection, ok := member.(ResettableProjection)
+		if !ok {
+			return ErrNotResettable
+		}
+		resettable = append(resettable, projection)
+	}
+
+	for _, projection := range resettable {
+		if err := projection.Reset(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
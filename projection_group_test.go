@@ -0,0 +1,61 @@
+package ess
+
+import (
+	"reflect"
+	"testing"
+)
+
+// resettableProjection counts the events it has handled since it has
+// been reset.
+type resettableProjection struct {
+	count int
+}
+
+func (self *resettableProjection) HandleEvent(*Event) { self.count++ }
+
+func (self *resettableProjection) Reset() error {
+	self.count = 0
+	return nil
+}
+
+func TestProjectionGroup_HandleEvent_passesEventsToAllMembers(t *testing.T) {
+	seen := []string{}
+	group := NewProjectionGroup(
+		EventHandlerFunc(func(event *Event) { seen = append(seen, "db "+event.Name) }),
+		EventHandlerFunc(func(event *Event) { seen = append(seen, "cache "+event.Name) }),
+	)
+	app := NewTestApp().WithProjection("orders", group)
+
+	app.Project(NewEvent("order.placed"))
+
+	if got, want := seen, []string{"db order.placed", "cache order.placed"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("seen = %v; want %v", got, want)
+	}
+}
+
+func TestProjectionGroup_Reset_resetsAllMembers(t *testing.T) {
+	a, b := &resettableProjection{}, &resettableProjection{}
+	group := NewProjectionGroup(a, b)
+	group.HandleEvent(NewEvent("order.placed"))
+
+	if err := group.Reset(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := []int{a.count, b.count}, []int{0, 0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("counts = %v; want %v", got, want)
+	}
+}
+
+func TestProjectionGroup_Reset_failsIfAnyMemberIsNotResettable(t *testing.T) {
+	a := &resettableProjection{}
+	group := NewProjectionGroup(a, EventHandlerFunc(func(*Event) {}))
+	group.HandleEvent(NewEvent("order.placed"))
+
+	if got, want := group.Reset(), ErrNotResettable; got != want {
+		t.Errorf("group.Reset() = %v; want %v", got, want)
+	}
+	if got, want := a.count, 1; got != want {
+		t.Errorf("a.count = %d; want %d", got, want)
+	}
+}
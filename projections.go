@@ -0,0 +1,362 @@
+package ess
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// ProjectionBufferSize is the number of events buffered for
+	// each asynchronous projection.
+	ProjectionBufferSize = 256
+
+	// ProjectionCooldown is the time for which a projection is
+	// skipped after it has exceeded its timeout.
+	ProjectionCooldown = time.Minute
+
+	// ProjectionPendingLimit is the number of events queued for a
+	// projection while it is skipped after exceeding its timeout.
+	ProjectionPendingLimit = 1024
+)
+
+var (
+	// ErrProjectionTimeout is returned when a projection does not
+	// handle an event within the configured timeout.
+	ErrProjectionTimeout = errors.New("projection_timeout")
+
+	// ErrProjectionTripped is returned when an event is not passed
+	// to a projection, because the projection has exceeded its
+	// timeout recently.
+	ErrProjectionTripped = errors.New("projection_tripped")
+
+	// ErrProjectionOverflow is returned when an event is dropped,
+	// because too many events have been queued for a projection
+	// while it was skipped.
+	ErrProjectionOverflow = errors.New("projection_overflow")
+)
+
+// ProjectionStatus describes a projection registered with an
+// application.
+type ProjectionStatus struct {
+	// Name is the name under which the projection has been
+	// registered.
+	Name string
+
+	// Async is true if events are passed to the projection
+	// asynchronously.
+	Async bool
+
+	// Processed is the number of events the projection has
+	// handled.
+	Processed int
+
+	// LastEventId is the id of the last event the projection has
+	// handled.
+	LastEventId string
+}
+
+// projection wraps an event handler registered as a projection and
+// keeps track of the events it has handled.
+type projection struct {
+	name    string
+	handler EventHandler
+	async   bool
+	queue   chan *Event
+	drained chan struct{}
+
+	// closed is true once the queue has been closed.  Events
+	// are queued while holding a read lock, so that the queue is
+	// not closed while sending to it.
+	queueMutex sync.RWMutex
+	closed     bool
+
+	// skipper skips the events up to the projection's recorded
+	// checkpoint while replaying history.
+	skipper checkpointSkipper
+
+	mutex        sync.Mutex
+	processed    int
+	lastEventId  string
+	lastSequence int64
+	cooldown     time.Duration
+
+	// checkpoint is the last checkpoint reported by a
+	// checkpointed handler, and checkpointSequence the sequence of
+	// the checkpoint's event, or zero if it is not known.
+	checkpoint         string
+	checkpointSequence int64
+	trippedUntil       time.Time
+
+	// running is closed once the handler abandoned after
+	// exceeding the timeout returns.
+	running chan struct{}
+
+	// pending are the events skipped while the projection is
+	// tripped, up to pendingLimit events.
+	pending      []*Event
+	pendingLimit int
+}
+
+// newProjection returns a projection passing events to handler.
+func newProjection(name string, handler EventHandler) *projection {
+	return &projection{
+		name:         name,
+		handler:      handler,
+		cooldown:     ProjectionCooldown,
+		pendingLimit: ProjectionPendingLimit,
+	}
+}
+
+// newAsyncProjection returns a projection passing events to handler
+// on a separate goroutine.
+func newAsyncProjection(name string, handler EventHandler) *projection {
+	projection := newProjection(name, handler)
+	projection.async = true
+	projection.queue = make(chan *Event, ProjectionBufferSize)
+	projection.drained = make(chan struct{})
+	go projection.run()
+	return projection
+}
+
+// run passes events from the projection's queue to its handler.
+func (self *projection) run() {
+	defer close(self.drained)
+	for event := range self.queue {
+		self.handle(event)
+	}
+}
+
+// drain stops an asynchronous projection from accepting events and
+// waits until all queued events have been handled.  Calling drain
+// more than once or on a synchronous projection has no effect.
+func (self *projection) drain() {
+	if !self.async {
+		return
+	}
+
+	self.queueMutex.Lock()
+	if !self.closed {
+		self.closed = true
+		close(self.queue)
+	}
+	self.queueMutex.Unlock()
+
+	<-self.drained
+}
+
+// HandleEvent passes event to the projection's handler.  For
+// asynchronous projections, event is queued instead, blocking if the
+// projection's queue is full.  Events passed to an asynchronous
+// projection after it has been drained are dropped.
+func (self *projection) HandleEvent(event *Event) {
+	if !self.async {
+		self.handle(event)
+		return
+	}
+
+	self.queueMutex.RLock()
+	defer self.queueMutex.RUnlock()
+	if self.closed {
+		return
+	}
+	self.queue <- event
+}
+
+// HandleEventWithin passes event to a synchronous projection's
+// handler, waiting at most timeout for the handler to return.
+//
+// If the handler takes longer, ErrProjectionTimeout is returned and
+// the projection is tripped: it is skipped for ProjectionCooldown and
+// until the handler has returned, returning ErrProjectionTripped.
+// Events skipped in the meantime are queued and passed to the
+// handler, in order, before the next event once the projection is no
+// longer tripped.  At most ProjectionPendingLimit events are queued;
+// further events are dropped, returning ErrProjectionOverflow.
+//
+// Asynchronous projections and timeouts of zero or less are handled
+// like HandleEvent.
+func (self *projection) HandleEventWithin(event *Event, timeout time.Duration) error {
+	if self.async || timeout <= 0 {
+		self.HandleEvent(event)
+		return nil
+	}
+
+	self.mutex.Lock()
+	if self.tripped() {
+		defer self.mutex.Unlock()
+		if len(self.pending) >= self.pendingLimit {
+			return ErrProjectionOverflow
+		}
+		self.pending = append(self.pending, event)
+		return ErrProjectionTripped
+	}
+	events := append(self.pending, event)
+	self.pending = nil
+	self.mutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, event := range events {
+			self.handle(event)
+		}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+		return nil
+	case <-timer.C:
+		self.mutex.Lock()
+		defer self.mutex.Unlock()
+		self.trippedUntil = time.Now().Add(self.cooldown)
+		self.running = done
+		return ErrProjectionTimeout
+	}
+}
+
+// tripped returns true if the projection is cooling down after
+// exceeding its timeout or its handler is still running.  The
+// projection's mutex needs to be held when calling this method.
+func (self *projection) tripped() bool {
+	if self.running != nil {
+		select {
+		case <-self.running:
+			self.running = nil
+		default:
+			return true
+		}
+	}
+
+	return time.Now().Before(self.trippedUntil)
+}
+
+// handle passes event to the projection's handler and records having
+// done so.
+func (self *projection) handle(event *Event) {
+	self.handler.HandleEvent(event)
+
+	self.mutex.Lock()
+	self.processed++
+	self.lastEventId = event.Id
+	self.lastSequence = event.Sequence
+	self.mutex.Unlock()
+
+	self.updateCheckpoint()
+}
+
+// updateCheckpoint records the checkpoint reported by the
+// projection's handler, if the handler implements
+// CheckpointedProjection and the checkpoint is the last event passed
+// to the handler.  Since handlers need not be safe for concurrent use,
+// this method may only be called while no events are passed to the
+// handler concurrently.
+func (self *projection) updateCheckpoint() {
+	handler, ok := self.handler.(CheckpointedProjection)
+	if !ok {
+		return
+	}
+	checkpoint := handler.Checkpoint()
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if checkpoint != "" && checkpoint == self.lastEventId {
+		self.checkpoint = checkpoint
+		self.checkpointSequence = self.lastSequence
+	}
+}
+
+// skip returns true if event is to be skipped while replaying history,
+// because it is not later than the projection's checkpoint.  Reaching
+// the checkpoint records the checkpoint's sequence.
+func (self *projection) skip(event *Event) bool {
+	if !self.skipper.skip(event) {
+		return false
+	}
+
+	if event.Id == self.skipper.checkpoint {
+		self.mutex.Lock()
+		defer self.mutex.Unlock()
+		self.checkpoint = event.Id
+		self.checkpointSequence = event.Sequence
+	}
+	return true
+}
+
+// Checkpoint returns the last checkpoint recorded for the projection
+// and the sequence of the checkpoint's event.
+func (self *projection) Checkpoint() (string, int64) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return self.checkpoint, self.checkpointSequence
+}
+
+// live returns true if the projection's handler only handles events
+// as they happen.
+func (self *projection) live() bool {
+	handler, ok := self.handler.(LiveProjection)
+	return ok && handler.SkipsReplay()
+}
+
+// reset discards the state of the projection's handler, if the
+// handler implements ResettableProjection.
+func (self *projection) reset() error {
+	if handler, ok := self.handler.(ResettableProjection); ok {
+		return handler.Reset()
+	}
+	return nil
+}
+
+// Status returns the current status of the projection.
+func (self *projection) Status() ProjectionStatus {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	return ProjectionStatus{
+		Name:        self.name,
+		Async:       self.async,
+		Processed:   self.processed,
+		LastEventId: self.lastEventId,
+	}
+}
+
+// checkpointSkipper skips the events up to and including a checkpoint
+// while replaying history, so that events handled already are not
+// handled again.
+type checkpointSkipper struct {
+	checkpoint string
+	skipping   bool
+}
+
+// skipUntil starts skipping events until the event identified by
+// checkpoint has been seen.  An empty checkpoint skips no events.
+func (self *checkpointSkipper) skipUntil(checkpoint string) {
+	self.checkpoint = checkpoint
+	self.skipping = checkpoint != ""
+}
+
+// skip returns true if event is to be skipped, because it is not
+// later than the checkpoint.
+func (self *checkpointSkipper) skip(event *Event) bool {
+	if !self.skipping {
+		return false
+	}
+
+	self.skipping = event.Id != self.checkpoint
+	return true
+}
+
+// stop stops skipping events.  If the checkpoint has not been seen,
+// all events have been skipped and the checkpoint is returned.
+// Otherwise the empty string is returned.
+func (self *checkpointSkipper) stop() string {
+	if !self.skipping {
+		return ""
+	}
+
+	self.skipping = false
+	return self.checkpoint
+}
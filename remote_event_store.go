@@ -0,0 +1,285 @@
+package ess
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// replayErrorTrailer is the name of the trailer reporting errors
+// encountered while replaying events for a RemoteEventStore.
+const replayErrorTrailer = "X-Replay-Error"
+
+const (
+	// RemoteRetries is the default number of times a request of a
+	// RemoteEventStore is retried after a transient error.
+	RemoteRetries = 3
+
+	// RemoteBackoff is the default time a RemoteEventStore waits
+	// before retrying a request for the first time.  The time
+	// doubles with every retry.
+	RemoteBackoff = 100 * time.Millisecond
+)
+
+// RemoteEventStore is an EventStore accessing an event store served
+// over HTTP by EventStoreHandler.  Use it for sharing a single event
+// store between several processes.
+//
+// Requests failing due to network errors or with one of the status
+// codes 502, 503 and 504 are retried with exponential backoff.  Since
+// a request storing events might have succeeded before the response
+// got lost, retrying can result in events being stored twice.
+type RemoteEventStore struct {
+	url     string
+	client  *http.Client
+	retries int
+	backoff time.Duration
+}
+
+// NewRemoteEventStore returns a new store accessing the event store
+// served at url using client.  If client is nil, http.DefaultClient
+// is used.
+func NewRemoteEventStore(url string, client *http.Client) *RemoteEventStore {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &RemoteEventStore{
+		url:     strings.TrimSuffix(url, "/"),
+		client:  client,
+		retries: RemoteRetries,
+		backoff: RemoteBackoff,
+	}
+}
+
+// WithRetries configures the store to retry failed requests up to
+// retries times, waiting for backoff before the first retry.
+func (self *RemoteEventStore) WithRetries(retries int, backoff time.Duration) *RemoteEventStore {
+	self.retries = retries
+	self.backoff = backoff
+	return self
+}
+
+// Store sends events to the remote store in a single request.  The
+// events' PersistedAt, StreamVersion and Sequence fields are updated
+// with the values recorded by the remote store.
+func (self *RemoteEventStore) Store(events []*Event) error {
+	data, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+
+	response, err := self.do("POST", self.url+"/events", data)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	stored := []*Event{}
+	if err := json.NewDecoder(response.Body).Decode(&stored); err != nil {
+		return err
+	}
+	for i, event := range stored {
+		if i < len(events) {
+			events[i].PersistedAt = event.PersistedAt
+			events[i].StreamVersion = event.StreamVersion
+			events[i].Sequence = event.Sequence
+		}
+	}
+
+	return nil
+}
+
+// Replay requests the events of the stream identified by streamId
+// from the remote store and passes them to receiver as they arrive.
+//
+// Use "*" as the stream id to match all events.
+func (self *RemoteEventStore) Replay(streamId string, receiver EventHandler) error {
+	response, err := self.do("GET", self.url+"/events?stream="+url.QueryEscape(streamId), nil)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	dec := json.NewDecoder(response.Body)
+	for {
+		event := &Event{}
+		if err := dec.Decode(event); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		receiver.HandleEvent(event)
+	}
+
+	if message := response.Trailer.Get(replayErrorTrailer); message != "" {
+		return errors.New(message)
+	}
+
+	return nil
+}
+
+// DeleteStream requests deleting the stream identified by streamId
+// from the remote store.
+func (self *RemoteEventStore) DeleteStream(streamId string) error {
+	response, err := self.do("DELETE", self.url+"/events?stream="+url.QueryEscape(streamId), nil)
+	if err != nil {
+		return err
+	}
+	return response.Body.Close()
+}
+
+// do sends a request, retrying on transient errors.  Responses with
+// a status code other than 2xx are turned into errors.
+func (self *RemoteEventStore) do(method, location string, body []byte) (*http.Response, error) {
+	backoff := self.backoff
+	for attempt := 0; ; attempt++ {
+		response, err := self.send(method, location, body)
+		if err == nil && !isTransientStatus(response.StatusCode) {
+			return response, checkResponse(response)
+		}
+
+		if attempt >= self.retries {
+			if err != nil {
+				return nil, err
+			}
+			return response, checkResponse(response)
+		}
+
+		if response != nil {
+			response.Body.Close()
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// send sends a single request.
+func (self *RemoteEventStore) send(method, location string, body []byte) (*http.Response, error) {
+	request, err := http.NewRequest(method, location, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	return self.client.Do(request)
+}
+
+// isTransientStatus returns true for status codes indicating that
+// retrying the request might succeed.
+func isTransientStatus(status int) bool {
+	switch status {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// checkResponse closes response and returns an error if its status
+// code is not 2xx.
+func checkResponse(response *http.Response) error {
+	if response.StatusCode >= 200 && response.StatusCode <= 299 {
+		return nil
+	}
+
+	defer response.Body.Close()
+	message, _ := ioutil.ReadAll(response.Body)
+	return fmt.Errorf("%s: %s", response.Status, bytes.TrimSpace(message))
+}
+
+// EventStoreHandler serves an event store over HTTP, for use by
+// RemoteEventStore.
+//
+// The following requests are handled:
+//
+//	POST /events              stores the events given as a JSON array
+//	GET /events?stream=ID     returns the stream's events, one per line
+//	DELETE /events?stream=ID  deletes the stream, if store
+//	                          implements StreamDeleter
+type EventStoreHandler struct {
+	store EventStore
+}
+
+// NewEventStoreHandler returns a new handler serving store.
+func NewEventStoreHandler(store EventStore) *EventStoreHandler {
+	return &EventStoreHandler{store: store}
+}
+
+// ServeHTTP implements http.Handler.
+func (self *EventStoreHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != "/events" {
+		http.NotFound(w, req)
+		return
+	}
+
+	switch req.Method {
+	case "POST":
+		self.storeEvents(w, req)
+	case "GET":
+		self.replayEvents(w, req)
+	case "DELETE":
+		deleter, ok := self.store.(StreamDeleter)
+		if !ok {
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, ErrStreamDeletionNotSupported.Error(), http.StatusMethodNotAllowed)
+			return
+		}
+		if err := deleter.DeleteStream(req.URL.Query().Get("stream")); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// storeEvents stores the events contained in the request's body and
+// responds with the stored events.
+func (self *EventStoreHandler) storeEvents(w http.ResponseWriter, req *http.Request) {
+	events := []*Event{}
+	if err := json.NewDecoder(req.Body).Decode(&events); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := self.store.Store(events); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
+
+// replayEvents writes the events of the requested stream to w, one
+// event per line.  Since events are written while they are replayed,
+// errors are reported in the trailer "X-Replay-Error".
+func (self *EventStoreHandler) replayEvents(w http.ResponseWriter, req *http.Request) {
+	stream := req.URL.Query().Get("stream")
+	if stream == "" {
+		http.Error(w, "missing stream", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Trailer", replayErrorTrailer)
+	enc := json.NewEncoder(w)
+	err := self.store.Replay(stream, EventHandlerFunc(func(event *Event) {
+		enc.Encode(event)
+	}))
+	if err != nil {
+		w.Header().Set(replayErrorTrailer, err.Error())
+	}
+}
@@ -0,0 +1,88 @@
+package ess
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRemoteEventStore_EventStoreBehavior(t *testing.T) {
+	var server *httptest.Server
+	setup := func(t *testing.T) EventStore {
+		server = httptest.NewServer(NewEventStoreHandler(NewEventsInMemory()))
+		return NewRemoteEventStore(server.URL, server.Client())
+	}
+
+	suite := NewEventStoreTest(setup)
+	suite.TearDown = func() { server.Close() }
+	suite.Run(t)
+}
+
+func TestRemoteEventStore_Store_retriesTransientErrors(t *testing.T) {
+	failures := 2
+	handler := NewEventStoreHandler(NewEventsInMemory())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		handler.ServeHTTP(w, req)
+	}))
+	defer server.Close()
+
+	store := NewRemoteEventStore(server.URL, server.Client()).WithRetries(2, 0)
+	if err := store.Store([]*Event{NewEvent("test.run").For(newTestAggregate("id"))}); err != nil {
+		t.Fatal(err)
+	}
+
+	seen := 0
+	if err := store.Replay("id", EventHandlerFunc(func(*Event) { seen++ })); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := seen, 1; got != want {
+		t.Errorf("seen = %d; want %d", got, want)
+	}
+}
+
+func TestRemoteEventStore_Store_failsAfterRetries(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	store := NewRemoteEventStore(server.URL, server.Client()).WithRetries(1, 0)
+	if err := store.Store([]*Event{NewEvent("test.run")}); err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+// failingReplayStore fails after replaying its events.
+type failingReplayStore struct {
+	*EventsInMemory
+}
+
+func (self *failingReplayStore) Replay(streamId string, receiver EventHandler) error {
+	self.EventsInMemory.Replay(streamId, receiver)
+	return errors.New("disk on fire")
+}
+
+func TestRemoteEventStore_Replay_reportsRemoteErrors(t *testing.T) {
+	local := &failingReplayStore{NewEventsInMemory()}
+	local.Store([]*Event{NewEvent("test.run").For(newTestAggregate("id"))})
+	server := httptest.NewServer(NewEventStoreHandler(local))
+	defer server.Close()
+
+	seen := 0
+	err := NewRemoteEventStore(server.URL, server.Client()).
+		Replay("id", EventHandlerFunc(func(*Event) { seen++ }))
+
+	if got, want := seen, 1; got != want {
+		t.Errorf("seen = %d; want %d", got, want)
+	}
+	if err == nil || err.Error() != "disk on fire" {
+		t.Errorf("err = %v; want %v", err, "disk on fire")
+	}
+}
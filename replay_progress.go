@@ -0,0 +1,28 @@
+package ess
+
+// ReplayWithProgress replays the events of the stream identified by
+// streamId from store using receiver, like store.Replay.
+//
+// Progress is called with the number of events replayed so far after
+// every n events and once more after the last event, unless it has
+// been called for the last event already.  Use this for reporting the
+// progress of replaying large histories.
+func ReplayWithProgress(store EventStore, streamId string, receiver EventHandler, n int, progress func(count int)) error {
+	count := 0
+	err := store.Replay(streamId, EventHandlerFunc(func(event *Event) {
+		receiver.HandleEvent(event)
+		count++
+		if n > 0 && count%n == 0 {
+			progress(count)
+		}
+	}))
+	if err != nil {
+		return err
+	}
+
+	if n <= 0 || count%n != 0 {
+		progress(count)
+	}
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package ess
+
+import "reflect"
+
+// TestingT is the subset of testing.T used for reporting failures.
+type TestingT interface {
+	Errorf(format string, args ...interface{})
+}
+
+// ScenarioTester is a harness for testing aggregates in terms of
+// events and commands.  A scenario consists of a history of events
+// given to the aggregate, a command sent to it and the expected
+// outcome.
+//
+// Example:
+//
+//	ess.NewScenarioTester(t, NewUser("admin")).
+//		Given(ess.NewEvent("user.signed-up").Add("email", "admin@example.com")).
+//		When(SignUp.NewCommand().Set("username", "admin")).
+//		ThenError(func(err error) bool { return err != nil })
+//
+// This type is public so that aggregates outside of this package can
+// be tested.
+type ScenarioTester struct {
+	// Clock is used for acknowledging commands.  It defaults to
+	// SystemClock.
+	Clock Clock
+
+	t         TestingT
+	aggregate Aggregate
+	events    *EventsInMemory
+	err       error
+}
+
+// NewScenarioTester returns a new scenario for aggregate, reporting
+// failures to t.
+func NewScenarioTester(t TestingT, aggregate Aggregate) *ScenarioTester {
+	return &ScenarioTester{
+		Clock:     SystemClock,
+		t:         t,
+		aggregate: aggregate,
+		events:    NewEventsInMemory(),
+	}
+}
+
+// Given passes events to the aggregate, in order to reconstruct its
+// state.
+func (self *ScenarioTester) Given(events ...*Event) *ScenarioTester {
+	for _, event := range events {
+		self.aggregate.HandleEvent(event)
+	}
+	return self
+}
+
+// When sends command to the aggregate, recording any emitted events
+// and the error returned by the aggregate.
+func (self *ScenarioTester) When(command *Command) *ScenarioTester {
+	command.Acknowledge(self.Clock)
+	command.receiver = self.aggregate
+	self.aggregate.PublishWith(self.events)
+	self.err = command.Execute()
+	return self
+}
+
+// ThenEvents fails the test unless the aggregate processed the
+// command successfully and emitted events matching expected.  Events
+// are compared by stream id, name and payload.
+func (self *ScenarioTester) ThenEvents(expected ...*Event) *ScenarioTester {
+	if self.err != nil {
+		self.t.Errorf("unexpected error: %s", self.err)
+		return self
+	}
+
+	emitted := self.events.Events()
+	if got, want := len(emitted), len(expected); got != want {
+		self.t.Errorf("len(emitted) = %d; want %d", got, want)
+		return self
+	}
+
+	for i, event := range emitted {
+		if got, want := event.StreamId, expected[i].StreamId; got != want {
+			self.t.Errorf("emitted[%d].StreamId = %q; want %q", i, got, want)
+		}
+		if got, want := event.Name, expected[i].Name; got != want {
+			self.t.Errorf("emitted[%d].Name = %q; want %q", i, got, want)
+		}
+		if got, want := event.Payload, expected[i].Payload; !reflect.DeepEqual(got, want) {
+			self.t.Errorf("emitted[%d].Payload = %v; want %v", i, got, want)
+		}
+	}
+
+	return self
+}
+
+// ThenError fails the test unless the error returned by the
+// aggregate satisfies matcher.
+func (self *ScenarioTester) ThenError(matcher func(err error) bool) *ScenarioTester {
+	if !matcher(self.err) {
+		self.t.Errorf("error %v does not match", self.err)
+	}
+	return self
+}
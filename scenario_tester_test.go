@@ -0,0 +1,58 @@
+package ess
+
+import (
+	"errors"
+	"testing"
+)
+
+type failureRecorder struct{ failures int }
+
+func (self *failureRecorder) Errorf(format string, args ...interface{}) { self.failures++ }
+
+func TestScenarioTester_ThenEvents_passesForMatchingEvents(t *testing.T) {
+	seen := 0
+	aggregate := newTestAggregate("test")
+	aggregate.onEvent = func(*Event) { seen++ }
+	aggregate.onCommand = func(agg *testAggregate) {
+		agg.events.PublishEvent(NewEvent("test.run").For(agg).Add("seen", seen))
+	}
+
+	NewScenarioTester(t, aggregate).
+		Given(NewEvent("test.run"), NewEvent("test.run")).
+		When(TestCommand.NewCommand()).
+		ThenEvents(NewEvent("test.run").For(aggregate).Add("seen", 2))
+}
+
+func TestScenarioTester_ThenEvents_failsForDifferentEvents(t *testing.T) {
+	failures := &failureRecorder{}
+	aggregate := newTestAggregate("test")
+	aggregate.onCommand = func(agg *testAggregate) {
+		agg.events.PublishEvent(NewEvent("test.run").For(agg))
+	}
+
+	NewScenarioTester(failures, aggregate).
+		When(TestCommand.NewCommand()).
+		ThenEvents(NewEvent("test.other").For(aggregate))
+
+	if got, want := failures.failures, 1; got != want {
+		t.Errorf("failures.failures = %d; want %d", got, want)
+	}
+}
+
+func TestScenarioTester_ThenError_matchesReturnedError(t *testing.T) {
+	failure := errors.New("failure")
+	aggregate := newTestAggregate("test").FailWith(failure)
+
+	NewScenarioTester(t, aggregate).
+		When(TestCommand.NewCommand()).
+		ThenError(func(err error) bool { return err == failure })
+
+	failures := &failureRecorder{}
+	NewScenarioTester(failures, aggregate).
+		When(TestCommand.NewCommand()).
+		ThenEvents()
+
+	if got, want := failures.failures, 1; got != want {
+		t.Errorf("failures.failures = %d; want %d", got, want)
+	}
+}
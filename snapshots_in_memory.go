@@ -0,0 +1,67 @@
+package ess
+
+import "sync"
+
+// Snapshot is the state of an aggregate after the first Version
+// events of its stream have been applied to it.
+type Snapshot struct {
+	// AggregateType identifies the type of the aggregate, so that
+	// aggregates of different types sharing a stream id do not
+	// share snapshots.
+	AggregateType string `json:"aggregate_type"`
+
+	// StreamId is the id of the aggregate's stream.
+	StreamId string `json:"stream_id"`
+
+	// Version is the number of events applied to the aggregate.
+	Version int `json:"version"`
+
+	// Data is the aggregate's state as returned by
+	// SnapshottableAggregate.MarshalSnapshot.
+	Data []byte `json:"data"`
+}
+
+// SnapshotsInMemory is an in-memory implementation of a
+// SnapshotStore.  Since snapshots are lost when the process exits,
+// use it only for tests and demos.
+type SnapshotsInMemory struct {
+	mutex     sync.Mutex
+	snapshots map[string]map[string]*Snapshot
+}
+
+// NewSnapshotsInMemory creates a new instance of this snapshot store
+// holding no snapshots initially.
+func NewSnapshotsInMemory() *SnapshotsInMemory {
+	return &SnapshotsInMemory{
+		snapshots: map[string]map[string]*Snapshot{},
+	}
+}
+
+// LoadSnapshot returns the snapshot saved for the aggregate of type
+// aggregateType identified by streamId.  It never returns an error.
+func (self *SnapshotsInMemory) LoadSnapshot(aggregateType, streamId string) (*Snapshot, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return self.snapshots[streamId][aggregateType], nil
+}
+
+// SaveSnapshot records snapshot as the latest snapshot of its
+// aggregate.  It never returns an error.
+func (self *SnapshotsInMemory) SaveSnapshot(snapshot *Snapshot) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if self.snapshots[snapshot.StreamId] == nil {
+		self.snapshots[snapshot.StreamId] = map[string]*Snapshot{}
+	}
+	self.snapshots[snapshot.StreamId][snapshot.AggregateType] = snapshot
+	return nil
+}
+
+// DeleteStream removes all snapshots of aggregates identified by
+// streamId.  It never returns an error.
+func (self *SnapshotsInMemory) DeleteStream(streamId string) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	delete(self.snapshots, streamId)
+	return nil
+}
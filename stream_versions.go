@@ -0,0 +1,147 @@
+package ess
+
+// streamVersions tracks the number of events stored per stream and
+// in total, for assigning stream versions and sequence numbers to
+// events.
+type streamVersions struct {
+	streams  map[string]int
+	sequence int64
+}
+
+// newStreamVersions returns versions for a store holding no events.
+func newStreamVersions() *streamVersions {
+	return &streamVersions{
+		streams: map[string]int{},
+	}
+}
+
+// assign sets the sequence number of every event to the next
+// sequence number and the stream version of every event with a
+// stream id to the number of events stored for its stream before
+// it.
+func (self *streamVersions) assign(events []*Event) {
+	for _, event := range events {
+		self.sequence++
+		event.Sequence = self.sequence
+
+		if event.StreamId == "" {
+			continue
+		}
+
+		event.StreamVersion = self.streams[event.StreamId]
+		self.streams[event.StreamId]++
+	}
+}
+
+// rollback undoes assigning versions to events, which must be the
+// events passed to the last call of assign, e.g. because storing them
+// failed.
+func (self *streamVersions) rollback(events []*Event) {
+	for _, event := range events {
+		self.sequence--
+		event.Sequence = 0
+
+		if event.StreamId == "" {
+			continue
+		}
+
+		event.StreamVersion = 0
+		self.streams[event.StreamId]--
+		if self.streams[event.StreamId] <= 0 {
+			delete(self.streams, event.StreamId)
+		}
+	}
+}
+
+// observe records event as having been stored already.  Events
+// stored without a sequence number still count towards the sequence,
+// and events stored without a stream version, which have a stream
+// version of zero, still count towards the version of their stream.
+func (self *streamVersions) observe(event *Event) {
+	if event.Sequence > self.sequence {
+		self.sequence = event.Sequence
+	} else if event.Sequence == 0 {
+		self.sequence++
+	}
+
+	if event.StreamId == "" {
+		return
+	}
+
+	if event.StreamVersion >= self.streams[event.StreamId] {
+		self.streams[event.StreamId] = event.StreamVersion + 1
+	} else if event.StreamVersion == 0 {
+		self.streams[event.StreamId]++
+	}
+}
+
+// forget discards the version of the stream identified by streamId.
+// The sequence is not affected, so that sequence numbers are never
+// reused.
+func (self *streamVersions) forget(streamId string) {
+	delete(self.streams, streamId)
+}
+
+// ReplaySince replays the events of the stream identified by streamId
+// from store using receiver, like store.Replay, but skips all events
+// with a stream version lower than version.
+//
+// Events stored without a stream version, which have a stream version
+// of zero, are numbered by their position in their stream while
+// replaying, so that they are not skipped in place of the events
+// actually preceding version.
+//
+// Use this for catching up with a stream from a known version, e.g.
+// the version of a snapshot of an aggregate.
+//
+// If streamId is "*", version is compared to the events' Sequence
+// instead, skipping all events with a lower sequence.  Events stored
+// without a sequence are numbered by their position in the store.
+func ReplaySince(store EventStore, streamId string, version int, receiver EventHandler) error {
+	if streamId == "*" {
+		return replaySinceSequence(store, int64(version), receiver)
+	}
+
+	next := map[string]int{}
+	return store.Replay(streamId, EventHandlerFunc(func(event *Event) {
+		current := event.StreamVersion
+		if current < next[event.StreamId] {
+			current = next[event.StreamId]
+		}
+		next[event.StreamId] = current + 1
+
+		if current >= version {
+			receiver.HandleEvent(event)
+		}
+	}))
+}
+
+// replaySinceSequence replays all events from store with a sequence
+// of at least sequence using receiver.
+func replaySinceSequence(store EventStore, sequence int64, receiver EventHandler) error {
+	next := int64(1)
+	return store.Replay("*", EventHandlerFunc(func(event *Event) {
+		current := event.Sequence
+		if current < next {
+			current = next
+		}
+		next = current + 1
+
+		if current >= sequence {
+			receiver.HandleEvent(event)
+		}
+	}))
+}
+
+// eventsSince is an event store replaying only the events with a
+// stream version or sequence of at least since, using ReplaySince.
+type eventsSince struct {
+	EventStore
+	since int
+}
+
+// Replay replays the events of the stream identified by streamId
+// from the underlying store, skipping events before self.since.
+func (self *eventsSince) Replay(streamId string, receiver EventHandler) error {
+	return ReplaySince(self.EventStore, streamId, self.since, receiver)
+}
@@ -0,0 +1,61 @@
+package ess
+
+import "sync"
+
+// SubscriptionBufferSize is the number of events buffered for each
+// subscriber.
+const SubscriptionBufferSize = 64
+
+// subscriptions manages channels receiving newly stored events.
+//
+// Events are delivered without blocking: if a subscriber's buffer is
+// full, the event is dropped for that subscriber.  Subscribers that
+// cannot afford to lose events should keep up with the rate of
+// events or replay the event store instead.
+type subscriptions struct {
+	mutex    sync.Mutex
+	channels map[chan *Event]bool
+}
+
+func newSubscriptions() *subscriptions {
+	return &subscriptions{
+		channels: map[chan *Event]bool{},
+	}
+}
+
+// Subscribe returns a new channel receiving published events and a
+// function for cancelling the subscription.  Cancelling the
+// subscription closes the channel.
+func (self *subscriptions) Subscribe() (<-chan *Event, func()) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	events := make(chan *Event, SubscriptionBufferSize)
+	self.channels[events] = true
+
+	once := sync.Once{}
+	unsubscribe := func() {
+		once.Do(func() {
+			self.mutex.Lock()
+			defer self.mutex.Unlock()
+			delete(self.channels, events)
+			close(events)
+		})
+	}
+
+	return events, unsubscribe
+}
+
+// HandleEvent delivers event to all subscribers, dropping the event
+// for subscribers whose buffer is full.
+func (self *subscriptions) HandleEvent(event *Event) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	for events := range self.channels {
+		select {
+		case events <- event:
+		default:
+		}
+	}
+}
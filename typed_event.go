@@ -0,0 +1,46 @@
+package ess
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// NewTypedEvent returns a new event called name with data as its
+// payload.  Data is converted into the event's payload by encoding
+// it as JSON, so it needs to be encoded as a JSON object, e.g. a
+// struct with exported fields.
+//
+// Use DecodePayload for obtaining the data from the event.
+//
+// NewTypedEvent panics if data cannot be encoded as a JSON object.
+func NewTypedEvent[T any](name string, data T) *Event {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		panic(fmt.Sprintf("ess: NewTypedEvent(%q): %s", name, err))
+	}
+
+	event := NewEvent(name)
+	if err := json.Unmarshal(encoded, &event.Payload); err != nil {
+		panic(fmt.Sprintf("ess: NewTypedEvent(%q): %s", name, err))
+	}
+	if event.Payload == nil {
+		event.Payload = map[string]interface{}{}
+	}
+
+	return event
+}
+
+// DecodePayload converts the payload of event into a value of type T
+// by encoding the payload as JSON and decoding it into the value.
+// It works with events created by NewTypedEvent as well as with
+// events read from an event store.
+func DecodePayload[T any](event *Event) (T, error) {
+	var data T
+	encoded, err := json.Marshal(event.Payload)
+	if err != nil {
+		return data, err
+	}
+
+	err = json.Unmarshal(encoded, &data)
+	return data, err
+}
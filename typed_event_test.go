@@ -0,0 +1,63 @@
+package ess
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testSignedUp struct {
+	Username string    `json:"username"`
+	Roles    []string  `json:"roles"`
+	Age      int       `json:"age"`
+	At       time.Time `json:"at"`
+}
+
+func TestNewTypedEvent_roundTripsPayload(t *testing.T) {
+	data := testSignedUp{Username: "admin", Roles: []string{"admin"}, Age: 42, At: TheTime}
+	event := NewTypedEvent("user.signed-up", data)
+
+	if got, want := event.Payload["username"], "admin"; got != want {
+		t.Errorf(`event.Payload["username"] = %v; want %v`, got, want)
+	}
+
+	decoded, err := DecodePayload[testSignedUp](event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := decoded, data; !reflect.DeepEqual(got, want) {
+		t.Errorf("decoded = %#v; want %#v", got, want)
+	}
+}
+
+func TestDecodePayload_decodesStoredEvents(t *testing.T) {
+	data := testSignedUp{Username: "admin", Roles: []string{"admin", "editor"}, Age: 42, At: TheTime}
+	filename := filepath.Join(os.TempDir(), fmt.Sprintf("events-typed-%d.json", os.Getpid()))
+	defer os.Remove(filename)
+	store, err := NewEventsOnDisk(filename, SystemClock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Store([]*Event{NewTypedEvent("user.signed-up", data).For(newTestAggregate("admin"))}); err != nil {
+		t.Fatal(err)
+	}
+
+	replayed := []testSignedUp{}
+	err = store.Replay("admin", EventHandlerFunc(func(event *Event) {
+		decoded, err := DecodePayload[testSignedUp](event)
+		if err != nil {
+			t.Fatal(err)
+		}
+		replayed = append(replayed, decoded)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := replayed, []testSignedUp{data}; !reflect.DeepEqual(got, want) {
+		t.Errorf("replayed = %#v; want %#v", got, want)
+	}
+}
@@ -2,22 +2,60 @@ package ess
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"sort"
+	"strings"
 )
 
+// ErrorDetail is a structured description of a single validation
+// error.
+type ErrorDetail struct {
+	// Code is a machine readable identifier of the error,
+	// e.g. "too_short".
+	Code string `json:"code"`
+
+	// Args are the parameters of the error, e.g. the minimum
+	// length of a field.
+	Args []interface{} `json:"args,omitempty"`
+
+	// Message is the default human readable description of the
+	// error.
+	Message string `json:"message"`
+}
+
+// NewErrorDetail returns a new error detail for code and args.  Its
+// default message consists of code followed by args.  Use
+// ValidationError.Localize for rendering messages meant for users.
+func NewErrorDetail(code string, args ...interface{}) *ErrorDetail {
+	return &ErrorDetail{
+		Code:    code,
+		Args:    args,
+		Message: strings.TrimSpace(fmt.Sprintln(append([]interface{}{code}, args...)...)),
+	}
+}
+
 // ValidationError captures errors about the values of a command's
 // parameter or the state of a whole aggregate.
 //
 // Return errors of this type by the methods handling commands in your
 // aggregates.
+//
+// Fields are reported in the order in which errors have first been
+// added for them.
 type ValidationError struct {
 	Errors map[string][]string `json:"error"`
+
+	fields  []string
+	details map[string][]*ErrorDetail
 }
 
 // NewValidationError returns a new, empty validation error.
 func NewValidationError() *ValidationError {
 	return &ValidationError{
-		Errors: map[string][]string{},
+		Errors:  map[string][]string{},
+		details: map[string][]*ErrorDetail{},
 	}
 }
 
@@ -26,25 +64,132 @@ func (self *ValidationError) Ok() bool { return len(self.Errors) == 0 }
 
 // Add records an error for field using desc as the error description.
 func (self *ValidationError) Add(field string, desc string) *ValidationError {
-	self.Errors[field] = append(self.Errors[field], desc)
+	return self.addDetail(field, &ErrorDetail{Code: desc, Message: desc})
+}
+
+// AddCode records an error for field identified by code with the
+// parameters args.  The code is recorded in Errors, the full details
+// of the error are available through Details.
+//
+// Example:
+//
+//	err.AddCode("password", "too_short", 8)
+func (self *ValidationError) AddCode(field string, code string, args ...interface{}) *ValidationError {
+	return self.addDetail(field, NewErrorDetail(code, args...))
+}
+
+// addDetail records detail as an error for field.
+func (self *ValidationError) addDetail(field string, detail *ErrorDetail) *ValidationError {
+	if _, found := self.Errors[field]; !found {
+		self.fields = append(self.fields, field)
+	}
+	if self.details == nil {
+		self.details = map[string][]*ErrorDetail{}
+	}
+	self.Errors[field] = append(self.Errors[field], detail.Code)
+	self.details[field] = append(self.details[field], detail)
 	return self
 }
 
+// Remove discards all errors recorded for field.
+func (self *ValidationError) Remove(field string) *ValidationError {
+	delete(self.Errors, field)
+	delete(self.details, field)
+	for i, recorded := range self.fields {
+		if recorded == field {
+			self.fields = append(self.fields[:i:i], self.fields[i+1:]...)
+			break
+		}
+	}
+	return self
+}
+
+// Details returns structured descriptions of all errors recorded for
+// field.  Errors added to Errors directly are described using their
+// description as code and message.
+func (self *ValidationError) Details(field string) []*ErrorDetail {
+	if details := self.details[field]; len(details) == len(self.Errors[field]) {
+		return details
+	}
+
+	details := []*ErrorDetail{}
+	for _, desc := range self.Errors[field] {
+		details = append(details, &ErrorDetail{Code: desc, Message: desc})
+	}
+	return details
+}
+
+// Localize renders the errors recorded for every field as human
+// readable messages using messages, which maps error codes to format
+// strings in the user's language.  The format strings are passed the
+// errors' arguments.  Errors whose code is missing from messages are
+// rendered as their code.
+//
+// Example:
+//
+//	german := map[string]string{"too_short": "muss mindestens %d Zeichen lang sein"}
+//	messages := err.Localize(german)
+func (self *ValidationError) Localize(messages map[string]string) map[string][]string {
+	localized := map[string][]string{}
+	for _, field := range self.Fields() {
+		for _, detail := range self.Details(field) {
+			message := detail.Code
+			if format, found := messages[detail.Code]; found {
+				message = fmt.Sprintf(format, detail.Args...)
+			}
+			localized[field] = append(localized[field], message)
+		}
+	}
+
+	return localized
+}
+
+// Fields returns the names of all fields for which errors have been
+// recorded, in the order in which the first error for each field has
+// been added.  Fields added to Errors directly are returned last, in
+// alphabetical order.
+func (self *ValidationError) Fields() []string {
+	fields := []string{}
+	seen := map[string]bool{}
+	for _, field := range self.fields {
+		if _, found := self.Errors[field]; found && !seen[field] {
+			fields = append(fields, field)
+			seen[field] = true
+		}
+	}
+
+	unordered := []string{}
+	for field := range self.Errors {
+		if !seen[field] {
+			unordered = append(unordered, field)
+		}
+	}
+	sort.Strings(unordered)
+
+	return append(fields, unordered...)
+}
+
 // Merge records errors from err into this instance.
 //
 // If err is a ValidationError, all recorded errors for all fields
 // from err are merged into this instance.
 //
 // Otherwise err's string representation is recorded in the field
-// $all.
+// $all.  Merging nil has no effect.
 func (self *ValidationError) Merge(err error) *ValidationError {
+	if err == nil {
+		return self
+	}
+
 	verr, ok := err.(*ValidationError)
 	if !ok {
 		return self.Add("$all", err.Error())
 	}
 
-	for field, errors := range verr.Errors {
-		self.Errors[field] = append(self.Errors[field], errors...)
+	for _, field := range verr.Fields() {
+		for _, detail := range verr.Details(field) {
+			self.addDetail(field, detail)
+		}
 	}
 
 	return self
@@ -75,7 +220,8 @@ func (self *ValidationError) Return() error {
 // Error implements the error interface.
 func (self *ValidationError) Error() string {
 	out := new(bytes.Buffer)
-	for field, errors := range self.Errors {
+	for _, field := range self.Fields() {
+		errors := self.Errors[field]
 		fmt.Fprintf(out, "%s: ", field)
 		for i, desc := range errors {
 			fmt.Fprintf(out, "%s", desc)
@@ -87,3 +233,75 @@ func (self *ValidationError) Error() string {
 	}
 	return out.String()
 }
+
+// MarshalJSON implements json.Marshaler.  Fields are encoded in the
+// order returned by Fields.
+//
+// The key "error" maps field names to the recorded error
+// descriptions, the key "details" maps field names to the structured
+// descriptions returned by Details.
+func (self *ValidationError) MarshalJSON() ([]byte, error) {
+	out := bytes.NewBufferString(`{"error":`)
+	err := self.marshalFields(out, func(field string) interface{} {
+		return self.Errors[field]
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out.WriteString(`,"details":`)
+	err = self.marshalFields(out, func(field string) interface{} {
+		return self.Details(field)
+	})
+	if err != nil {
+		return nil, err
+	}
+	out.WriteString("}")
+
+	return out.Bytes(), nil
+}
+
+// marshalFields writes a JSON object to out, mapping every field to
+// the value returned by valueOf.
+func (self *ValidationError) marshalFields(out *bytes.Buffer, valueOf func(field string) interface{}) error {
+	out.WriteString("{")
+	for i, field := range self.Fields() {
+		if i > 0 {
+			out.WriteString(",")
+		}
+
+		key, err := json.Marshal(field)
+		if err != nil {
+			return err
+		}
+		value, err := json.Marshal(valueOf(field))
+		if err != nil {
+			return err
+		}
+
+		out.Write(key)
+		out.WriteString(":")
+		out.Write(value)
+	}
+	out.WriteString("}")
+
+	return nil
+}
+
+// StatusCode returns the HTTP status code for reporting this error,
+// 422 Unprocessable Entity.
+func (self *ValidationError) StatusCode() int {
+	return 422
+}
+
+// WriteHTTP writes this error as a JSON response to w, using the
+// status code returned by StatusCode.
+//
+// The response body is encoded using MarshalJSON:
+//
+//	{"error":{"email":["empty"]},"details":{"email":[{"code":"empty","message":"empty"}]}}
+func (self *ValidationError) WriteHTTP(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(self.StatusCode())
+	return json.NewEncoder(w).Encode(self)
+}
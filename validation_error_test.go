@@ -1,7 +1,11 @@
 package ess
 
 import (
+	"encoding/json"
 	"errors"
+	"net/http/httptest"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -44,3 +48,144 @@ func TestValidationError_Return_returnsSelfIfErrorIsNotOk(t *testing.T) {
 		t.Errorf(`err.Return() = %v; want %v`, got, want)
 	}
 }
+
+func TestValidationError_Merge_ignoresNil(t *testing.T) {
+	err := NewValidationError().Add("field", "error").Merge(nil)
+	if got, want := len(err.Errors), 1; got != want {
+		t.Errorf(`len(err.Errors) = %v; want %v`, got, want)
+	}
+}
+
+func TestValidationError_WriteHTTP_writesErrorsAsJSON(t *testing.T) {
+	err := NewValidationError().
+		Add("email", "empty").
+		Add("password", "too_short").
+		Add("password", "too_common")
+	w := httptest.NewRecorder()
+
+	if err := err.WriteHTTP(w); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := w.Code, err.StatusCode(); got != want {
+		t.Errorf(`w.Code = %v; want %v`, got, want)
+	}
+
+	if got, want := w.Header().Get("Content-Type"), "application/json"; got != want {
+		t.Errorf(`w.Header().Get("Content-Type") = %v; want %v`, got, want)
+	}
+
+	want := `{"error":{"email":["empty"],"password":["too_short","too_common"]},` +
+		`"details":{"email":[{"code":"empty","message":"empty"}],` +
+		`"password":[{"code":"too_short","message":"too_short"},{"code":"too_common","message":"too_common"}]}}` + "\n"
+	if got := w.Body.String(); got != want {
+		t.Errorf(`w.Body.String() = %v; want %v`, got, want)
+	}
+}
+
+func TestValidationError_StatusCode_returnsUnprocessableEntity(t *testing.T) {
+	if got, want := NewValidationError().StatusCode(), 422; got != want {
+		t.Errorf(`NewValidationError().StatusCode() = %v; want %v`, got, want)
+	}
+}
+
+func TestValidationError_Error_reportsFieldsInOrderOfAddition(t *testing.T) {
+	for i := 0; i < 10; i++ {
+		err := NewValidationError().
+			Add("zebra", "empty").
+			Add("apple", "invalid").
+			Add("mango", "too_long").
+			Add("zebra", "too_short")
+
+		if got, want := err.Error(), "zebra: empty, too_short; apple: invalid; mango: too_long; "; got != want {
+			t.Fatalf(`err.Error() = %q; want %q`, got, want)
+		}
+
+		data, jsonErr := json.Marshal(err)
+		if jsonErr != nil {
+			t.Fatal(jsonErr)
+		}
+
+		want := `{"error":{"zebra":["empty","too_short"],"apple":["invalid"],"mango":["too_long"]},`
+		if got := string(data); !strings.HasPrefix(got, want) {
+			t.Fatalf(`json.Marshal(err) = %s; want %s`, got, want)
+		}
+	}
+}
+
+func TestValidationError_Merge_keepsOrderOfMergedFields(t *testing.T) {
+	other := NewValidationError().Add("b", "error").Add("a", "error")
+	err := NewValidationError().Add("c", "error").Merge(other)
+
+	if got, want := err.Fields(), []string{"c", "b", "a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf(`err.Fields() = %v; want %v`, got, want)
+	}
+}
+
+func TestValidationError_Remove_discardsAllRecordsOfField(t *testing.T) {
+	err := NewValidationError().
+		AddCode("id", "too_short", 8).
+		Add("name", "empty").
+		Remove("id").
+		Add("id", "empty")
+
+	if got, want := err.Fields(), []string{"name", "id"}; !reflect.DeepEqual(got, want) {
+		t.Errorf(`err.Fields() = %v; want %v`, got, want)
+	}
+	if got, want := err.Details("id"), []*ErrorDetail{{Code: "empty", Message: "empty"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf(`err.Details("id") = %v; want %v`, got, want)
+	}
+}
+
+func TestValidationError_AddCode_recordsStructuredErrors(t *testing.T) {
+	err := NewValidationError().
+		AddCode("password", "too_short", 8).
+		AddCode("email", "unknown_domain", "example.com").
+		Add("name", "empty")
+
+	if got, want := err.Errors["password"], []string{"too_short"}; !reflect.DeepEqual(got, want) {
+		t.Errorf(`err.Errors["password"] = %v; want %v`, got, want)
+	}
+
+	data, jsonErr := json.Marshal(err)
+	if jsonErr != nil {
+		t.Fatal(jsonErr)
+	}
+
+	want := `{"error":{"password":["too_short"],"email":["unknown_domain"],"name":["empty"]},` +
+		`"details":{"password":[{"code":"too_short","args":[8],"message":"too_short 8"}],` +
+		`"email":[{"code":"unknown_domain","args":["example.com"],"message":"unknown_domain example.com"}],` +
+		`"name":[{"code":"empty","message":"empty"}]}}`
+	if got := string(data); got != want {
+		t.Errorf(`json.Marshal(err) = %s; want %s`, got, want)
+	}
+}
+
+func TestValidationError_Merge_keepsStructuredErrors(t *testing.T) {
+	other := NewValidationError().AddCode("password", "too_short", 8)
+	err := NewValidationError().Merge(other)
+
+	if got, want := err.Details("password"), other.Details("password"); !reflect.DeepEqual(got, want) {
+		t.Errorf(`err.Details("password") = %v; want %v`, got, want)
+	}
+}
+
+func TestValidationError_Localize_rendersCodesFromCatalog(t *testing.T) {
+	err := NewValidationError().
+		AddCode("password", "too_short", 8).
+		AddCode("email", "malformed_email").
+		Add("name", "empty")
+	catalog := map[string]string{
+		"too_short": "muss mindestens %d Zeichen lang sein",
+		"empty":     "darf nicht leer sein",
+	}
+
+	want := map[string][]string{
+		"password": {"muss mindestens 8 Zeichen lang sein"},
+		"email":    {"malformed_email"},
+		"name":     {"darf nicht leer sein"},
+	}
+	if got := err.Localize(catalog); !reflect.DeepEqual(got, want) {
+		t.Errorf("err.Localize(catalog) = %v; want %v", got, want)
+	}
+}
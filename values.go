@@ -1,11 +1,17 @@
 package ess
 
 import (
+	"encoding"
 	"errors"
+	"fmt"
 	"net/mail"
+	"reflect"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"golang.org/x/crypto/bcrypt"
 )
@@ -16,6 +22,8 @@ type String struct {
 	original  string
 	sanitized string
 	sanitizer func(string) string
+	minLen    int
+	maxLen    int
 }
 
 // TrimmedString constructs a string value which removes initial and
@@ -35,11 +43,81 @@ func StringValue(str string) *String {
 	}
 }
 
+// SanitizedString constructs a string value which applies all of
+// sanitizers to the initial string, in the given order.
+//
+// Example:
+//
+//	SanitizedString(StripControl, strings.TrimSpace, CollapseSpaces, Lowercase)
+func SanitizedString(sanitizers ...func(string) string) *String {
+	return &String{
+		sanitizer: func(s string) string {
+			for _, sanitize := range sanitizers {
+				s = sanitize(s)
+			}
+			return s
+		},
+	}
+}
+
+// Lowercase is a sanitizer for use with SanitizedString which maps
+// all letters of s to lower case.
+func Lowercase(s string) string {
+	return strings.ToLower(s)
+}
+
+// CollapseSpaces is a sanitizer for use with SanitizedString which
+// replaces every run of whitespace in s with a single space and
+// removes leading and trailing whitespace.
+func CollapseSpaces(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// StripControl is a sanitizer for use with SanitizedString which
+// removes all control characters, including newlines and tabs, from
+// s.
+func StripControl(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// MinLen configures the string to reject sanitized input shorter
+// than n characters.
+func (self *String) MinLen(n int) *String {
+	self.minLen = n
+	return self
+}
+
+// MaxLen configures the string to reject sanitized input longer than
+// n characters.  A value of zero or less means no limit.
+func (self *String) MaxLen(n int) *String {
+	self.maxLen = n
+	return self
+}
+
 // UnmarshalText accepts data as the string's content and applies and
 // internal sanitization function to data.
+//
+// The length of the sanitized string is measured in characters, not
+// bytes.  ErrTooShort and ErrTooLong are returned if it is outside
+// the bounds configured with MinLen and MaxLen.
 func (self *String) UnmarshalText(data []byte) error {
-	self.original = string(data)
-	self.sanitized = self.sanitizer(self.original)
+	original := string(data)
+	sanitized := self.sanitizer(original)
+	length := utf8.RuneCountInString(sanitized)
+	if length < self.minLen {
+		return ErrTooShort
+	}
+	if self.maxLen > 0 && length > self.maxLen {
+		return ErrTooLong
+	}
+
+	self.original = original
+	self.sanitized = sanitized
 	return nil
 }
 
@@ -52,6 +130,8 @@ func (self *String) Copy() Value {
 		sanitized: self.sanitized,
 		original:  self.original,
 		sanitizer: self.sanitizer,
+		minLen:    self.minLen,
+		maxLen:    self.maxLen,
 	}
 }
 
@@ -70,8 +150,49 @@ func (self Time) Copy() Value {
 	return &Time{self.Time}
 }
 
+// DateFormat is the format used for parsing and formatting dates.
+const DateFormat = "2006-01-02"
+
+// Date is an implementation of Value for handling calendar days,
+// e.g. birthdays.  It works with dates formatted according to
+// DateFormat.  Parsed dates are at midnight UTC.
+type Date struct {
+	time.Time
+}
+
+// UnmarshalText parses data as a date.  It returns ErrMalformedDate
+// if data is not a valid date.
+func (self *Date) UnmarshalText(data []byte) error {
+	date, err := time.Parse(DateFormat, strings.TrimSpace(string(data)))
+	if err != nil {
+		return ErrMalformedDate
+	}
+
+	self.Time = date
+	return nil
+}
+
+// String returns the date formatted according to DateFormat or the
+// empty string if no date has been set.
+func (self Date) String() string {
+	if self.Time.IsZero() {
+		return ""
+	}
+
+	return self.Time.Format(DateFormat)
+}
+
+func (self Date) Copy() Value {
+	return &Date{self.Time}
+}
+
 var (
-	identifierRegexp = regexp.MustCompile(`^[-a-z0-9]+$`)
+	identifierRegexp  = regexp.MustCompile(`^[-a-z0-9]+$`)
+	measurementRegexp = regexp.MustCompile(`^([-+]?[0-9]*\.?[0-9]+)\s*([^\s0-9]+)$`)
+	phoneNumberRegexp = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+	moneyRegexp       = regexp.MustCompile(`^([-+]?[0-9]+)(?:\.([0-9]+))?(?:\s+([A-Za-z]{3}))?$`)
+	extensionRegexp   = regexp.MustCompile(`(?i)\s*(?:ext\.?|x|#)\s*([0-9]{1,6})$`)
+	localeRegexp      = regexp.MustCompile(`^([a-z]{2,3})(?:-([a-z]{4}))?(?:-([a-z]{2}|[0-9]{3}))?((?:-(?:[a-z0-9]{5,8}|[0-9][a-z0-9]{3}))*)$`)
 
 	// ErrMalformedIdentifier is returned when parsing an
 	// identifier fails.
@@ -80,6 +201,70 @@ var (
 	// ErrEmpty is returned when a non-empty input string is
 	// expected.
 	ErrEmpty = errors.New("empty")
+
+	// ErrTooShort is returned when parsing a string shorter than
+	// the configured minimum length.
+	ErrTooShort = errors.New("too_short")
+
+	// ErrTooLong is returned when parsing a string longer than the
+	// configured maximum length.
+	ErrTooLong = errors.New("too_long")
+
+	// ErrMalformedDate is returned when parsing a date fails.
+	ErrMalformedDate = errors.New("malformed_date")
+
+	// ErrMalformedDuration is returned when parsing a duration
+	// fails.
+	ErrMalformedDuration = errors.New("malformed_duration")
+
+	// ErrNegativeDuration is returned when parsing a negative
+	// duration where only positive durations are accepted.
+	ErrNegativeDuration = errors.New("negative_duration")
+
+	// ErrMalformedMeasurement is returned when parsing a
+	// measurement fails.
+	ErrMalformedMeasurement = errors.New("malformed_measurement")
+
+	// ErrUnknownUnit is returned when parsing a measurement in a
+	// unit which is not supported.
+	ErrUnknownUnit = errors.New("unknown_unit")
+
+	// ErrNotAllowed is returned when parsing a value that is not
+	// among the allowed values.
+	ErrNotAllowed = errors.New("not_allowed")
+
+	// ErrInvalidGTIN is returned when parsing a global trade item
+	// number fails.
+	ErrInvalidGTIN = errors.New("invalid_gtin")
+
+	// ErrMalformedPhoneNumber is returned when parsing a phone
+	// number fails.
+	ErrMalformedPhoneNumber = errors.New("malformed_phone_number")
+
+	// ErrMalformedMoney is returned when parsing a monetary
+	// amount fails.
+	ErrMalformedMoney = errors.New("malformed_money")
+
+	// ErrTooManyDecimals is returned when parsing a monetary
+	// amount with more than two decimal places.
+	ErrTooManyDecimals = errors.New("too_many_decimals")
+
+	// ErrMissingCurrency is returned when parsing a monetary
+	// amount without a currency if no default currency has been
+	// configured.
+	ErrMissingCurrency = errors.New("missing_currency")
+
+	// ErrMalformedBusinessDays is returned when parsing a number
+	// of business days fails.
+	ErrMalformedBusinessDays = errors.New("malformed_business_days")
+
+	// ErrUnknownCountry is returned when parsing a country code
+	// which is not an assigned ISO 3166-1 alpha-2 code.
+	ErrUnknownCountry = errors.New("unknown_country")
+
+	// ErrMalformedLocale is returned when parsing a locale which
+	// is not a well-formed BCP 47 language tag.
+	ErrMalformedLocale = errors.New("malformed_locale")
 )
 
 // Identifier is a value for handling parameters that serve as
@@ -148,6 +333,78 @@ func (self *Email) Copy() Value {
 // EmailAddress returns a new, empty email value.
 func EmailAddress() *Email { return &Email{} }
 
+// PhoneNumber is an implementation of Value for handling phone
+// numbers in international format, e.g. "+49 (30) 123-456 ext. 12".
+//
+// Formatting characters are removed and numbers starting with "00"
+// are treated as starting with "+".  The resulting number needs to
+// consist of a "+" followed by 7 to 15 digits, as defined by E.164.
+// An extension, introduced by "ext", "x" or "#", is kept separately.
+type PhoneNumber struct {
+	number    string
+	extension string
+}
+
+// Phone returns a new, empty phone number value.
+func Phone() *PhoneNumber { return &PhoneNumber{} }
+
+// UnmarshalText parses data as a phone number.  It returns
+// ErrMalformedPhoneNumber if data does not contain a valid number.
+func (self *PhoneNumber) UnmarshalText(data []byte) error {
+	input := strings.TrimSpace(string(data))
+	extension := ""
+	if match := extensionRegexp.FindStringSubmatchIndex(input); match != nil {
+		extension = input[match[2]:match[3]]
+		input = input[:match[0]]
+	}
+
+	number := strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '-', '.', '/', '(', ')':
+			return -1
+		}
+		return r
+	}, input)
+	if strings.HasPrefix(number, "00") {
+		number = "+" + number[2:]
+	}
+
+	if !phoneNumberRegexp.MatchString(number) {
+		return ErrMalformedPhoneNumber
+	}
+
+	self.number = number
+	self.extension = extension
+	return nil
+}
+
+// Number returns the phone number without its extension, e.g.
+// "+4930123456".
+func (self *PhoneNumber) Number() string {
+	return self.number
+}
+
+// Extension returns the phone number's extension or the empty string.
+func (self *PhoneNumber) Extension() string {
+	return self.extension
+}
+
+// String returns the normalized phone number, followed by ";ext="
+// and the extension if the number has one.
+func (self *PhoneNumber) String() string {
+	if self.extension == "" {
+		return self.number
+	}
+	return self.number + ";ext=" + self.extension
+}
+
+func (self *PhoneNumber) Copy() Value {
+	return &PhoneNumber{
+		number:    self.number,
+		extension: self.extension,
+	}
+}
+
 // BcryptedPassword is an implementation for securely handling
 // password parameters.  It uses the bcrypt algorithm for hashing
 // passwords.
@@ -167,7 +424,7 @@ func (self *BcryptedPassword) UnmarshalText(data []byte) error {
 		return err
 	}
 
-	self.plain = append(self.plain, data...)
+	self.plain = append([]byte{}, data...)
 	self.bytes = bytes
 	return nil
 }
@@ -176,13 +433,1001 @@ func (self *BcryptedPassword) UnmarshalText(data []byte) error {
 // plain text anymore.
 func (self *BcryptedPassword) Copy() Value { return &BcryptedPassword{bytes: self.bytes} }
 
+// copyPlainText copies the password including its plain text, so
+// that copies of commands, e.g. when retrying them, can still check
+// whether the password matches.
+func (self *BcryptedPassword) copyPlainText() Value {
+	return &BcryptedPassword{
+		plain: append([]byte{}, self.plain...),
+		bytes: self.bytes,
+	}
+}
+
 // String returns the hashed password as a string.
 func (self *BcryptedPassword) String() string { return string(self.bytes) }
 
-// Matches returns true if this password matches hashedPassword.
+// Matches returns true if this password matches hashedPassword.  It
+// uses CompareOrDummy, so that it takes the same time if
+// hashedPassword is empty, e.g. because the user does not exist.
 func (self *BcryptedPassword) Matches(hashedPassword string) bool {
-	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), self.plain) == nil
+	return CompareOrDummy(hashedPassword, self.plain)
+}
+
+var (
+	// compareHashAndPassword compares passwords with bcrypt.  It
+	// is a variable so that tests can observe comparisons.
+	compareHashAndPassword = bcrypt.CompareHashAndPassword
+
+	// dummyHash is compared against by CompareOrDummy.  It is
+	// generated when the package is initialized, so that the first
+	// comparison takes no longer than later ones.
+	dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+)
+
+// CompareOrDummy returns true if plain matches the bcrypt hash
+// hashed.  If hashed is empty, plain is compared against a dummy hash
+// instead and false is returned.
+//
+// Comparing passwords with bcrypt is deliberately slow.  Skipping the
+// comparison if there is no hash, e.g. when logging in as a user that
+// does not exist, makes such attempts measurably faster and lets an
+// attacker find out which accounts exist.  Always comparing a
+// password, even against a dummy hash of the same cost, prevents
+// this.
+func CompareOrDummy(hashed string, plain []byte) bool {
+	if hashed == "" {
+		compareHashAndPassword(dummyHash, plain)
+		return false
+	}
+
+	return compareHashAndPassword([]byte(hashed), plain) == nil
 }
 
 // Password returns a new, empty BcryptedPassword.
 func Password() *BcryptedPassword { return &BcryptedPassword{} }
+
+// Tokens is an implementation of Value for handling lists of tokens
+// separated by whitespace, e.g. "admin editor".
+//
+// Every token is parsed using a copy of an inner value.  Duplicate
+// tokens are removed, keeping the position of their first
+// occurrence.
+type Tokens struct {
+	inner  Value
+	tokens []string
+}
+
+// TokenList returns a new, empty list of tokens which parses every
+// token using inner.
+func TokenList(inner Value) *Tokens {
+	return &Tokens{
+		inner:  inner,
+		tokens: []string{},
+	}
+}
+
+// UnmarshalText splits data on whitespace and parses every token
+// using the inner value.  The first error encountered while parsing
+// a token is returned.
+func (self *Tokens) UnmarshalText(data []byte) error {
+	tokens := []string{}
+	seen := map[string]bool{}
+	for _, field := range strings.Fields(string(data)) {
+		token := self.inner.Copy()
+		if err := token.UnmarshalText([]byte(field)); err != nil {
+			return err
+		}
+
+		str := token.String()
+		if seen[str] {
+			continue
+		}
+		seen[str] = true
+		tokens = append(tokens, str)
+	}
+
+	self.tokens = tokens
+	return nil
+}
+
+// Tokens returns a copy of the parsed tokens in the order they were
+// given.
+func (self *Tokens) Tokens() []string {
+	return append([]string{}, self.tokens...)
+}
+
+// String returns the parsed tokens separated by a single space.
+func (self *Tokens) String() string {
+	return strings.Join(self.tokens, " ")
+}
+
+func (self *Tokens) Copy() Value {
+	return &Tokens{
+		inner:  self.inner.Copy(),
+		tokens: append([]string{}, self.tokens...),
+	}
+}
+
+// BusinessDate is an implementation of Value for handling dates
+// given relative to the current date in business days, e.g. "5bd"
+// for five business days from now.
+//
+// Saturdays, Sundays and the configured holidays are not considered
+// business days.
+type BusinessDate struct {
+	clock    Clock
+	holidays []time.Time
+	date     time.Time
+}
+
+// BusinessDays returns a new business date which uses clock for
+// determining the current date and skips holidays.
+func BusinessDays(clock Clock, holidays []time.Time) *BusinessDate {
+	return &BusinessDate{
+		clock:    clock,
+		holidays: holidays,
+	}
+}
+
+// UnmarshalText parses data as a non-negative number of business days
+// followed by "bd" and resolves it to a date, relative to the
+// current date.  It returns ErrMalformedBusinessDays if data cannot
+// be parsed.
+func (self *BusinessDate) UnmarshalText(data []byte) error {
+	text := strings.TrimSpace(string(data))
+	if !strings.HasSuffix(text, "bd") {
+		return ErrMalformedBusinessDays
+	}
+
+	days, err := strconv.Atoi(strings.TrimSuffix(text, "bd"))
+	if err != nil || days < 0 {
+		return ErrMalformedBusinessDays
+	}
+
+	now := self.clock.Now()
+	date := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	for days > 0 {
+		date = date.AddDate(0, 0, 1)
+		if self.isBusinessDay(date) {
+			days--
+		}
+	}
+
+	self.date = date
+	return nil
+}
+
+// isBusinessDay returns true if date is neither on a weekend nor a
+// holiday.
+func (self *BusinessDate) isBusinessDay(date time.Time) bool {
+	switch date.Weekday() {
+	case time.Saturday, time.Sunday:
+		return false
+	}
+
+	year, month, day := date.Date()
+	for _, holiday := range self.holidays {
+		y, m, d := holiday.Date()
+		if y == year && m == month && d == day {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Time returns the resolved date at midnight.
+func (self *BusinessDate) Time() time.Time {
+	return self.date
+}
+
+// String returns the resolved date formatted according to
+// DateFormat.
+func (self *BusinessDate) String() string {
+	if self.date.IsZero() {
+		return ""
+	}
+
+	return self.date.Format(DateFormat)
+}
+
+func (self *BusinessDate) Copy() Value {
+	return &BusinessDate{
+		clock:    self.clock,
+		holidays: self.holidays,
+		date:     self.date,
+	}
+}
+
+// Duration is an implementation of Value for handling durations, e.g.
+// "15m" or "1h30m".  It accepts any duration understood by
+// time.ParseDuration.
+//
+// Negative durations are rejected, unless explicitly allowed.
+type Duration struct {
+	duration      time.Duration
+	allowNegative bool
+}
+
+// Interval returns a new, empty duration which rejects negative
+// durations.
+func Interval() *Duration {
+	return &Duration{}
+}
+
+// AllowNegative configures this value to accept negative durations.
+func (self *Duration) AllowNegative() *Duration {
+	self.allowNegative = true
+	return self
+}
+
+// UnmarshalText parses data as a duration.  It returns
+// ErrMalformedDuration if data is not a valid duration and
+// ErrNegativeDuration if data is a negative duration that is not
+// allowed.
+func (self *Duration) UnmarshalText(data []byte) error {
+	duration, err := time.ParseDuration(strings.TrimSpace(string(data)))
+	if err != nil {
+		return ErrMalformedDuration
+	}
+
+	if duration < 0 && !self.allowNegative {
+		return ErrNegativeDuration
+	}
+
+	self.duration = duration
+	return nil
+}
+
+// Duration returns the parsed duration.
+func (self *Duration) Duration() time.Duration {
+	return self.duration
+}
+
+func (self *Duration) String() string {
+	return self.duration.String()
+}
+
+func (self *Duration) Copy() Value {
+	return &Duration{
+		duration:      self.duration,
+		allowNegative: self.allowNegative,
+	}
+}
+
+// Quantity is an implementation of Value for handling measurements
+// consisting of a number and a unit, e.g. "2.5kg" or "500 g".
+//
+// Measurements are converted to a base unit using the factors
+// configured for each supported unit.
+type Quantity struct {
+	baseUnit string
+	units    map[string]float64
+	value    float64
+}
+
+// Measurement returns a new, empty quantity measured in baseUnit.
+// The map units maps every supported unit to the factor for
+// converting it into baseUnit.  The base unit itself is always
+// supported.
+//
+// Example:
+//
+//	weight := Measurement("g", map[string]float64{"kg": 1000})
+func Measurement(baseUnit string, units map[string]float64) *Quantity {
+	return &Quantity{
+		baseUnit: baseUnit,
+		units:    units,
+	}
+}
+
+// UnmarshalText parses data as a number followed by a unit.  It
+// returns ErrMalformedMeasurement if data cannot be parsed and
+// ErrUnknownUnit if the unit is not supported.
+func (self *Quantity) UnmarshalText(data []byte) error {
+	matches := measurementRegexp.FindStringSubmatch(strings.TrimSpace(string(data)))
+	if matches == nil {
+		return ErrMalformedMeasurement
+	}
+
+	value, err := strconv.ParseFloat(matches[1], 64)
+	if err != nil {
+		return ErrMalformedMeasurement
+	}
+
+	factor, found := self.units[matches[2]]
+	if !found && matches[2] == self.baseUnit {
+		factor, found = 1, true
+	}
+	if !found {
+		return ErrUnknownUnit
+	}
+
+	self.value = value * factor
+	return nil
+}
+
+// Value returns the measurement converted to the base unit.
+func (self *Quantity) Value() float64 {
+	return self.value
+}
+
+// String returns the measurement in the base unit, e.g. "2500g".
+func (self *Quantity) String() string {
+	return strconv.FormatFloat(self.value, 'f', -1, 64) + self.baseUnit
+}
+
+func (self *Quantity) Copy() Value {
+	return &Quantity{
+		baseUnit: self.baseUnit,
+		units:    self.units,
+		value:    self.value,
+	}
+}
+
+// Choice is an implementation of Value for handling parameters which
+// accept only a fixed set of values, e.g. the status of a post.
+// Values are compared case sensitively.
+//
+// For forward compatibility, a choice can be configured to accept
+// unknown values as well, flagging them as unknown.
+type Choice struct {
+	allowed      []string
+	value        string
+	known        bool
+	allowUnknown bool
+}
+
+// Enum returns a new, empty choice accepting only the values given in
+// allowed.
+func Enum(allowed ...string) *Choice {
+	return &Choice{
+		allowed: allowed,
+	}
+}
+
+// AllowUnknown configures this choice to accept values which are not
+// among the allowed values.  Use IsKnown to find out whether the
+// parsed value is among the allowed values.
+func (self *Choice) AllowUnknown() *Choice {
+	self.allowUnknown = true
+	return self
+}
+
+// UnmarshalText accepts data with surrounding whitespace removed if
+// it is one of the allowed values.  It returns ErrNotAllowed
+// otherwise, unless unknown values are allowed.
+func (self *Choice) UnmarshalText(data []byte) error {
+	value := strings.TrimSpace(string(data))
+	for _, allowed := range self.allowed {
+		if value == allowed {
+			self.value = value
+			self.known = true
+			return nil
+		}
+	}
+
+	if !self.allowUnknown {
+		return ErrNotAllowed
+	}
+
+	self.value = value
+	self.known = false
+	return nil
+}
+
+// IsKnown returns true if the parsed value is one of the allowed
+// values.
+func (self *Choice) IsKnown() bool {
+	return self.known
+}
+
+// Allowed returns the values accepted by this choice.
+func (self *Choice) Allowed() []string {
+	return self.allowed
+}
+
+func (self *Choice) String() string {
+	return self.value
+}
+
+func (self *Choice) Copy() Value {
+	return &Choice{
+		allowed:      self.allowed,
+		value:        self.value,
+		known:        self.known,
+		allowUnknown: self.allowUnknown,
+	}
+}
+
+// FlagSet is an implementation of Value for handling sets of named
+// flags, e.g. permissions.  It implements MultiValue, so that flags
+// can be submitted as a group of checkboxes.
+//
+// Every flag corresponds to a bit, in the order in which the flags
+// have been named, so that the set can be stored as a bitmask.  At
+// most 64 flags are supported.
+type FlagSet struct {
+	names []string
+	set   uint64
+}
+
+// Flags returns a new, empty set of flags accepting the flags given
+// in names.  The first flag corresponds to the lowest bit.
+func Flags(names ...string) *FlagSet {
+	if len(names) > 64 {
+		panic("ess: too many flags")
+	}
+
+	return &FlagSet{
+		names: names,
+	}
+}
+
+// UnmarshalText sets the flags named in the comma separated list in
+// data.  It returns ErrNotAllowed if any name is not a known flag.
+func (self *FlagSet) UnmarshalText(data []byte) error {
+	return self.UnmarshalValues(strings.Split(string(data), ","))
+}
+
+// UnmarshalValues sets the flags named in values.  Surrounding
+// whitespace is removed and empty values are ignored.
+func (self *FlagSet) UnmarshalValues(values []string) error {
+	set := uint64(0)
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+
+		bit := self.bit(value)
+		if bit < 0 {
+			return ErrNotAllowed
+		}
+		set |= 1 << uint(bit)
+	}
+
+	self.set = set
+	return nil
+}
+
+// bit returns the bit corresponding to the flag name or -1 if name is
+// not a known flag.
+func (self *FlagSet) bit(name string) int {
+	for i, known := range self.names {
+		if known == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Has returns true if the flag name is set.
+func (self *FlagSet) Has(name string) bool {
+	bit := self.bit(name)
+	return bit >= 0 && self.set&(1<<uint(bit)) != 0
+}
+
+// Strings returns the names of the flags that are set, in the order
+// in which the flags have been named.
+func (self *FlagSet) Strings() []string {
+	names := []string{}
+	for i, name := range self.names {
+		if self.set&(1<<uint(i)) != 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Uint returns the flags that are set as a bitmask.
+func (self *FlagSet) Uint() uint64 {
+	return self.set
+}
+
+// String returns the names of the flags that are set separated by
+// commas, in the order in which the flags have been named.
+func (self *FlagSet) String() string {
+	return strings.Join(self.Strings(), ",")
+}
+
+func (self *FlagSet) Copy() Value {
+	return &FlagSet{
+		names: self.names,
+		set:   self.set,
+	}
+}
+
+// StringList is an implementation of Value for handling parameters
+// which are submitted multiple times, e.g. multi-selects or lists of
+// tags.  It implements MultiValue.
+//
+// Surrounding whitespace is removed from every string and empty
+// strings are ignored.
+type StringList struct {
+	strings []string
+}
+
+// List returns a new, empty list of strings.
+func List() *StringList {
+	return &StringList{
+		strings: []string{},
+	}
+}
+
+// UnmarshalText sets the list to the comma separated strings in data.
+func (self *StringList) UnmarshalText(data []byte) error {
+	return self.UnmarshalValues(strings.Split(string(data), ","))
+}
+
+// UnmarshalValues sets the list to values.
+func (self *StringList) UnmarshalValues(values []string) error {
+	list := []string{}
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			list = append(list, value)
+		}
+	}
+
+	self.strings = list
+	return nil
+}
+
+// Strings returns the strings in this list.
+func (self *StringList) Strings() []string {
+	return self.strings
+}
+
+// String returns the strings in this list separated by commas.
+func (self *StringList) String() string {
+	return strings.Join(self.strings, ",")
+}
+
+func (self *StringList) Copy() Value {
+	return &StringList{
+		strings: append([]string{}, self.strings...),
+	}
+}
+
+// Normalized is an implementation of Value which applies a
+// normalization function to the string representation of another
+// value, e.g. for lowercasing usernames.
+type Normalized struct {
+	inner      Value
+	normalize  func(string) string
+	normalized string
+}
+
+// NormalizedValue returns a new value which parses data using inner
+// and normalizes the result using fn.
+func NormalizedValue(inner Value, fn func(string) string) *Normalized {
+	return &Normalized{
+		inner:      inner,
+		normalize:  fn,
+		normalized: fn(inner.String()),
+	}
+}
+
+// UnmarshalText parses data using the inner value and normalizes the
+// result.  Errors returned by the inner value are passed through.
+func (self *Normalized) UnmarshalText(data []byte) error {
+	if err := self.inner.UnmarshalText(data); err != nil {
+		return err
+	}
+
+	self.normalized = self.normalize(self.inner.String())
+	return nil
+}
+
+// Inner returns the wrapped value.
+func (self *Normalized) Inner() Value {
+	return self.inner
+}
+
+// String returns the normalized string representation of the inner
+// value.
+func (self *Normalized) String() string {
+	return self.normalized
+}
+
+func (self *Normalized) Copy() Value {
+	return &Normalized{
+		inner:      self.inner.Copy(),
+		normalize:  self.normalize,
+		normalized: self.normalized,
+	}
+}
+
+// OptionalValue is an implementation of Value for fields which do
+// not need to be provided.  It wraps another value and keeps track of
+// whether the field has been set, so that a field which has not been
+// provided can be distinguished from a field provided empty.  Empty
+// input is not validated by the inner value, so that an optional
+// field may be provided empty even if its inner value rejects empty
+// input, e.g. an optional email address.
+//
+// Since FromForm sets all fields of a command, use FromFormPartial
+// for leaving optional fields unset which are missing from a form.
+type OptionalValue struct {
+	inner Value
+	set   bool
+	empty bool
+}
+
+// Optional returns a new, unset optional value wrapping inner.
+func Optional(inner Value) *OptionalValue {
+	return &OptionalValue{
+		inner: inner,
+	}
+}
+
+// UnmarshalText parses data using the inner value and marks the
+// value as set, even if data is empty.  Empty data is not passed to
+// the inner value.  Errors returned by the inner value are passed
+// through, leaving the value unchanged.
+func (self *OptionalValue) UnmarshalText(data []byte) error {
+	if len(data) == 0 {
+		self.set = true
+		self.empty = true
+		return nil
+	}
+
+	if err := self.inner.UnmarshalText(data); err != nil {
+		return err
+	}
+
+	self.set = true
+	self.empty = false
+	return nil
+}
+
+// IsSet returns true if the value has been set.
+func (self *OptionalValue) IsSet() bool {
+	return self.set
+}
+
+// Inner returns the wrapped value.
+func (self *OptionalValue) Inner() Value {
+	return self.inner
+}
+
+// String returns the string representation of the inner value if the
+// value has been set to non-empty input and the empty string
+// otherwise.
+func (self *OptionalValue) String() string {
+	if !self.set || self.empty {
+		return ""
+	}
+	return self.inner.String()
+}
+
+// Copy copies the value, including its inner value.
+func (self *OptionalValue) Copy() Value {
+	return &OptionalValue{
+		inner: self.inner.Copy(),
+		set:   self.set,
+		empty: self.empty,
+	}
+}
+
+// GlobalTradeItemNumber is an implementation of Value for handling
+// barcodes of retail products, such as EAN-13 or UPC-A codes.  It
+// accepts GTIN-8, GTIN-12, GTIN-13 and GTIN-14 numbers with a valid
+// check digit and normalizes them to GTIN-14.
+type GlobalTradeItemNumber struct {
+	gtin string
+}
+
+// GTIN returns a new, empty global trade item number.
+func GTIN() *GlobalTradeItemNumber {
+	return &GlobalTradeItemNumber{}
+}
+
+// UnmarshalText returns ErrInvalidGTIN if data is not a valid global
+// trade item number.
+func (self *GlobalTradeItemNumber) UnmarshalText(data []byte) error {
+	gtin := strings.TrimSpace(string(data))
+	switch len(gtin) {
+	case 8, 12, 13, 14:
+	default:
+		return ErrInvalidGTIN
+	}
+
+	sum := 0
+	for i := len(gtin) - 1; i >= 0; i-- {
+		digit := gtin[i]
+		if digit < '0' || digit > '9' {
+			return ErrInvalidGTIN
+		}
+
+		// counting from the right, starting with the check
+		// digit, digits are weighted with 1 and 3 alternately
+		weight := 1
+		if (len(gtin)-i)%2 == 0 {
+			weight = 3
+		}
+		sum += int(digit-'0') * weight
+	}
+
+	if sum%10 != 0 {
+		return ErrInvalidGTIN
+	}
+
+	self.gtin = strings.Repeat("0", 14-len(gtin)) + gtin
+	return nil
+}
+
+// String returns the number as GTIN-14.
+func (self *GlobalTradeItemNumber) String() string {
+	return self.gtin
+}
+
+func (self *GlobalTradeItemNumber) Copy() Value {
+	return &GlobalTradeItemNumber{gtin: self.gtin}
+}
+
+// Matching is an implementation of Value for handling strings which
+// need to match a regular expression, e.g. product codes.
+type Matching struct {
+	pattern *regexp.Regexp
+	err     error
+	value   string
+}
+
+// Pattern returns a new, empty value accepting strings that match
+// pattern.  Parsing a string which does not match pattern fails with
+// an error described by errCode.
+//
+// Example:
+//
+//	ProductCode = ess.Pattern(regexp.MustCompile(`^[A-Z]{3}-[0-9]{4}$`), "malformed_product_code")
+func Pattern(pattern *regexp.Regexp, errCode string) *Matching {
+	return &Matching{
+		pattern: pattern,
+		err:     errors.New(errCode),
+	}
+}
+
+// UnmarshalText removes surrounding whitespace from data and accepts
+// the result if it matches the value's pattern.
+func (self *Matching) UnmarshalText(data []byte) error {
+	value := strings.TrimSpace(string(data))
+	if !self.pattern.MatchString(value) {
+		return self.err
+	}
+
+	self.value = value
+	return nil
+}
+
+// Err returns the error returned for strings not matching the
+// pattern.
+func (self *Matching) Err() error {
+	return self.err
+}
+
+func (self *Matching) String() string {
+	return self.value
+}
+
+func (self *Matching) Copy() Value {
+	return &Matching{
+		pattern: self.pattern,
+		err:     self.err,
+		value:   self.value,
+	}
+}
+
+// TextCodec is implemented by types that can be converted to and
+// from text, e.g. domain types defined outside of this package.
+type TextCodec interface {
+	encoding.TextMarshaler
+	encoding.TextUnmarshaler
+}
+
+// Text is an implementation of Value adapting a TextCodec.
+type Text struct {
+	codec TextCodec
+}
+
+// FromTextCodec returns a value parsing and formatting input using
+// codec.  Codec needs to be a pointer, so that copies of the value
+// can be created.
+//
+// Example:
+//
+//	Address = ess.FromTextCodec(&net.IP{})
+func FromTextCodec(codec TextCodec) *Text {
+	return &Text{codec: codec}
+}
+
+// UnmarshalText passes data to the underlying codec.
+func (self *Text) UnmarshalText(data []byte) error {
+	return self.codec.UnmarshalText(data)
+}
+
+// Codec returns the underlying codec.
+func (self *Text) Codec() TextCodec {
+	return self.codec
+}
+
+// String returns the text produced by the underlying codec or the
+// empty string if the codec fails.
+func (self *Text) String() string {
+	data, err := self.codec.MarshalText()
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// Copy returns a new value holding a shallow copy of the underlying
+// codec.
+func (self *Text) Copy() Value {
+	original := reflect.ValueOf(self.codec)
+	if original.Kind() != reflect.Ptr || original.IsNil() {
+		return &Text{codec: self.codec}
+	}
+
+	codec := reflect.New(original.Elem().Type())
+	codec.Elem().Set(original.Elem())
+	return &Text{codec: codec.Interface().(TextCodec)}
+}
+
+// Money is an implementation of Value for handling monetary amounts,
+// e.g. "12.34 USD".  Amounts are stored as an integer number of minor
+// units, e.g. cents, to avoid rounding errors.  At most two decimal
+// places are accepted.
+type Money struct {
+	defaultCurrency string
+	amount          int64
+	currency        string
+}
+
+// MoneyIn returns a new, empty monetary value.  Amounts given without
+// a currency are assumed to be in defaultCurrency.  If
+// defaultCurrency is empty, a currency is required.
+func MoneyIn(defaultCurrency string) *Money {
+	return &Money{defaultCurrency: strings.ToUpper(defaultCurrency)}
+}
+
+// UnmarshalText parses data as an amount, optionally followed by a
+// three letter currency code.
+func (self *Money) UnmarshalText(data []byte) error {
+	match := moneyRegexp.FindStringSubmatch(strings.TrimSpace(string(data)))
+	if match == nil {
+		return ErrMalformedMoney
+	}
+
+	units, decimals, currency := match[1], match[2], strings.ToUpper(match[3])
+	if len(decimals) > 2 {
+		return ErrTooManyDecimals
+	}
+	if currency == "" {
+		currency = self.defaultCurrency
+	}
+	if currency == "" {
+		return ErrMissingCurrency
+	}
+
+	minor := (decimals + "00")[:2]
+	amount, err := strconv.ParseInt(units+minor, 10, 64)
+	if err != nil {
+		return ErrMalformedMoney
+	}
+
+	self.amount = amount
+	self.currency = currency
+	return nil
+}
+
+// Amount returns the amount in minor units, e.g. 1234 for "12.34".
+func (self *Money) Amount() int64 {
+	return self.amount
+}
+
+// Currency returns the currency code, e.g. "USD".
+func (self *Money) Currency() string {
+	return self.currency
+}
+
+// String returns the amount with two decimal places followed by the
+// currency, e.g. "12.34 USD".
+func (self *Money) String() string {
+	if self.currency == "" {
+		return ""
+	}
+
+	sign, amount := "", self.amount
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+	return fmt.Sprintf("%s%d.%02d %s", sign, amount/100, amount%100, self.currency)
+}
+
+func (self *Money) Copy() Value {
+	return &Money{
+		defaultCurrency: self.defaultCurrency,
+		amount:          self.amount,
+		currency:        self.currency,
+	}
+}
+
+// Country is an implementation of Value for handling ISO 3166-1
+// alpha-2 country codes, e.g. "DE".  Codes are accepted in any case
+// and normalized to upper case.
+type Country struct {
+	code string
+}
+
+// CountryCode returns a new, empty country code.
+func CountryCode() *Country {
+	return &Country{}
+}
+
+// UnmarshalText returns ErrUnknownCountry if data is not an assigned
+// country code.
+func (self *Country) UnmarshalText(data []byte) error {
+	code := strings.ToUpper(strings.TrimSpace(string(data)))
+	if !countryCodes[code] {
+		return ErrUnknownCountry
+	}
+
+	self.code = code
+	return nil
+}
+
+// String returns the country code in upper case.
+func (self *Country) String() string {
+	return self.code
+}
+
+func (self *Country) Copy() Value {
+	return &Country{code: self.code}
+}
+
+// Locale is an implementation of Value for handling BCP 47 language
+// tags consisting of a language and optional script, region and
+// variant subtags, e.g. "en-US" or "zh-Hant-TW".  Only the format
+// of the tag is checked.  Underscores are accepted as separators.
+//
+// Tags are normalized to the canonical case of each subtag: lower
+// case languages and variants, title case scripts and upper case
+// regions.
+type Locale struct {
+	tag string
+}
+
+// LocaleCode returns a new, empty locale.
+func LocaleCode() *Locale {
+	return &Locale{}
+}
+
+// UnmarshalText returns ErrMalformedLocale if data is not a
+// well-formed language tag.
+func (self *Locale) UnmarshalText(data []byte) error {
+	tag := strings.ToLower(strings.Replace(strings.TrimSpace(string(data)), "_", "-", -1))
+	match := localeRegexp.FindStringSubmatch(tag)
+	if match == nil {
+		return ErrMalformedLocale
+	}
+
+	normalized := match[1]
+	if script := match[2]; script != "" {
+		normalized += "-" + strings.ToUpper(script[:1]) + script[1:]
+	}
+	if region := match[3]; region != "" {
+		normalized += "-" + strings.ToUpper(region)
+	}
+	self.tag = normalized + match[4]
+	return nil
+}
+
+// String returns the normalized language tag.
+func (self *Locale) String() string {
+	return self.tag
+}
+
+func (self *Locale) Copy() Value {
+	return &Locale{tag: self.tag}
+}
@@ -0,0 +1,760 @@
+package ess
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokens_UnmarshalText_removesDuplicateTokens(t *testing.T) {
+	value := TokenList(Id())
+	if err := value.UnmarshalText([]byte("  admin editor\tadmin\nviewer editor ")); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"admin", "editor", "viewer"}
+	got := value.Tokens()
+	if len(got) != len(want) {
+		t.Fatalf(`value.Tokens() = %v; want %v`, got, want)
+	}
+
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf(`value.Tokens()[%d] = %v; want %v`, i, got[i], want[i])
+		}
+	}
+}
+
+func TestTokens_UnmarshalText_validatesEveryToken(t *testing.T) {
+	value := TokenList(Id())
+	if got, want := value.UnmarshalText([]byte("admin Editor")), ErrMalformedIdentifier; got != want {
+		t.Errorf(`value.UnmarshalText("admin Editor") = %v; want %v`, got, want)
+	}
+}
+
+func TestTokens_Copy_copiesTokens(t *testing.T) {
+	value := TokenList(Id())
+	if err := value.UnmarshalText([]byte("admin editor")); err != nil {
+		t.Fatal(err)
+	}
+
+	copied := value.Copy().(*Tokens)
+	copied.Tokens()[0] = "changed"
+
+	if got, want := value.Tokens()[0], "admin"; got != want {
+		t.Errorf(`value.Tokens()[0] = %v; want %v`, got, want)
+	}
+}
+
+func TestTokens_Tokens_returnsCopy(t *testing.T) {
+	value := TokenList(Id())
+	if err := value.UnmarshalText([]byte("admin editor")); err != nil {
+		t.Fatal(err)
+	}
+
+	value.Tokens()[0] = "changed"
+
+	if got, want := value.String(), "admin editor"; got != want {
+		t.Errorf(`value.String() = %q; want %q`, got, want)
+	}
+}
+
+func TestBusinessDate_UnmarshalText_skipsWeekends(t *testing.T) {
+	friday := &StaticClock{time.Date(2015, 6, 5, 14, 30, 0, 0, time.UTC)}
+	value := BusinessDays(friday, nil)
+	if err := value.UnmarshalText([]byte("2bd")); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := value.Time(), time.Date(2015, 6, 9, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf(`value.Time() = %v; want %v`, got, want)
+	}
+}
+
+func TestBusinessDate_UnmarshalText_skipsHolidays(t *testing.T) {
+	friday := &StaticClock{time.Date(2015, 6, 5, 14, 30, 0, 0, time.UTC)}
+	holidays := []time.Time{time.Date(2015, 6, 8, 0, 0, 0, 0, time.UTC)}
+	value := BusinessDays(friday, holidays)
+	if err := value.UnmarshalText([]byte("2bd")); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := value.String(), "2015-06-10"; got != want {
+		t.Errorf(`value.String() = %v; want %v`, got, want)
+	}
+}
+
+func TestBusinessDate_UnmarshalText_rejectsMalformedInput(t *testing.T) {
+	value := BusinessDays(&StaticClock{TheTime}, nil)
+	for _, input := range []string{"", "5", "bd", "-1bd", "5d"} {
+		if got, want := value.UnmarshalText([]byte(input)), ErrMalformedBusinessDays; got != want {
+			t.Errorf(`value.UnmarshalText(%q) = %v; want %v`, input, got, want)
+		}
+	}
+}
+
+func TestDate_UnmarshalText_parsesDate(t *testing.T) {
+	value := &Date{}
+	if err := value.UnmarshalText([]byte("2015-06-05")); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := value.Time, time.Date(2015, 6, 5, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf(`value.Time = %v; want %v`, got, want)
+	}
+
+	if got, want := value.String(), "2015-06-05"; got != want {
+		t.Errorf(`value.String() = %v; want %v`, got, want)
+	}
+}
+
+func TestDate_UnmarshalText_rejectsMalformedInput(t *testing.T) {
+	value := &Date{}
+	for _, input := range []string{"", "05.06.2015", "2015-6-5", "2015-06-05T00:00:00Z", "2015-13-01"} {
+		if got, want := value.UnmarshalText([]byte(input)), ErrMalformedDate; got != want {
+			t.Errorf(`value.UnmarshalText(%q) = %v; want %v`, input, got, want)
+		}
+	}
+}
+
+func TestDate_UnmarshalText_handlesLeapDays(t *testing.T) {
+	value := &Date{}
+	if err := value.UnmarshalText([]byte("2016-02-29")); err != nil {
+		t.Errorf(`value.UnmarshalText("2016-02-29") = %v; want %v`, err, nil)
+	}
+
+	if got, want := value.UnmarshalText([]byte("2015-02-29")), ErrMalformedDate; got != want {
+		t.Errorf(`value.UnmarshalText("2015-02-29") = %v; want %v`, got, want)
+	}
+}
+
+func TestDuration_UnmarshalText_parsesDuration(t *testing.T) {
+	value := Interval()
+	if err := value.UnmarshalText([]byte("1h30m")); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := value.Duration(), 90*time.Minute; got != want {
+		t.Errorf(`value.Duration() = %v; want %v`, got, want)
+	}
+
+	roundTripped := Interval()
+	if err := roundTripped.UnmarshalText([]byte(value.String())); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := roundTripped.Duration(), value.Duration(); got != want {
+		t.Errorf(`roundTripped.Duration() = %v; want %v`, got, want)
+	}
+}
+
+func TestDuration_UnmarshalText_rejectsMalformedInput(t *testing.T) {
+	value := Interval()
+	for _, input := range []string{"", "15", "fifteen minutes", "15x"} {
+		if got, want := value.UnmarshalText([]byte(input)), ErrMalformedDuration; got != want {
+			t.Errorf(`value.UnmarshalText(%q) = %v; want %v`, input, got, want)
+		}
+	}
+}
+
+func TestDuration_UnmarshalText_rejectsNegativeDurations(t *testing.T) {
+	if got, want := Interval().UnmarshalText([]byte("-15m")), ErrNegativeDuration; got != want {
+		t.Errorf(`Interval().UnmarshalText("-15m") = %v; want %v`, got, want)
+	}
+
+	value := Interval().AllowNegative()
+	if err := value.UnmarshalText([]byte("-15m")); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := value.Copy().(*Duration).Duration(), -15*time.Minute; got != want {
+		t.Errorf(`value.Copy().(*Duration).Duration() = %v; want %v`, got, want)
+	}
+}
+
+func TestQuantity_UnmarshalText_convertsToBaseUnit(t *testing.T) {
+	value := Measurement("g", map[string]float64{"kg": 1000, "mg": 0.001})
+	for input, want := range map[string]float64{
+		"2.5kg":  2500,
+		"500 g":  500,
+		"250mg":  0.25,
+		".5 kg ": 500,
+	} {
+		if err := value.UnmarshalText([]byte(input)); err != nil {
+			t.Errorf(`value.UnmarshalText(%q) = %v; want %v`, input, err, nil)
+			continue
+		}
+
+		if got := value.Value(); got != want {
+			t.Errorf(`value.Value() = %v; want %v [input=%q]`, got, want, input)
+		}
+	}
+
+	if err := value.UnmarshalText([]byte("0.5kg")); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := value.String(), "500g"; got != want {
+		t.Errorf(`value.String() = %v; want %v`, got, want)
+	}
+}
+
+func TestQuantity_UnmarshalText_rejectsUnknownUnits(t *testing.T) {
+	value := Measurement("g", map[string]float64{"kg": 1000})
+	if got, want := value.UnmarshalText([]byte("2lb")), ErrUnknownUnit; got != want {
+		t.Errorf(`value.UnmarshalText("2lb") = %v; want %v`, got, want)
+	}
+
+	if got, want := value.UnmarshalText([]byte("kg")), ErrMalformedMeasurement; got != want {
+		t.Errorf(`value.UnmarshalText("kg") = %v; want %v`, got, want)
+	}
+}
+
+func TestChoice_UnmarshalText_acceptsAllowedValues(t *testing.T) {
+	value := Enum("draft", "published", "archived")
+	if err := value.UnmarshalText([]byte(" published\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := value.Copy().String(), "published"; got != want {
+		t.Errorf(`value.Copy().String() = %v; want %v`, got, want)
+	}
+}
+
+func TestChoice_UnmarshalText_rejectsOtherValues(t *testing.T) {
+	value := Enum("draft", "published", "archived").Copy()
+	for _, input := range []string{"", "deleted", "Draft", "PUBLISHED"} {
+		if got, want := value.UnmarshalText([]byte(input)), ErrNotAllowed; got != want {
+			t.Errorf(`value.UnmarshalText(%q) = %v; want %v`, input, got, want)
+		}
+	}
+}
+
+func TestStringList_UnmarshalText_splitsOnCommas(t *testing.T) {
+	value := List()
+	if err := value.UnmarshalText([]byte("go, events,,")); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := value.String(), "go,events"; got != want {
+		t.Errorf(`value.String() = %v; want %v`, got, want)
+	}
+}
+
+func TestStringList_Copy_copiesStrings(t *testing.T) {
+	value := List()
+	if err := value.UnmarshalValues([]string{"go", "events"}); err != nil {
+		t.Fatal(err)
+	}
+
+	copied := value.Copy().(*StringList)
+	copied.Strings()[0] = "changed"
+
+	if got, want := value.Strings()[0], "go"; got != want {
+		t.Errorf(`value.Strings()[0] = %v; want %v`, got, want)
+	}
+}
+
+func TestGlobalTradeItemNumber_UnmarshalText_normalizesToGTIN14(t *testing.T) {
+	for input, want := range map[string]string{
+		"4006381333931":  "04006381333931",
+		"96385074":       "00000096385074",
+		"036000291452":   "00036000291452",
+		"10614141000415": "10614141000415",
+	} {
+		value := GTIN()
+		if err := value.UnmarshalText([]byte(input)); err != nil {
+			t.Errorf(`value.UnmarshalText(%q) = %v; want %v`, input, err, nil)
+			continue
+		}
+
+		if got := value.String(); got != want {
+			t.Errorf(`value.String() = %v; want %v [input=%q]`, got, want, input)
+		}
+	}
+}
+
+func TestGlobalTradeItemNumber_UnmarshalText_rejectsInvalidNumbers(t *testing.T) {
+	value := GTIN()
+	for _, input := range []string{"", "4006381333932", "400638133393", "400638133393a", "123456789"} {
+		if got, want := value.UnmarshalText([]byte(input)), ErrInvalidGTIN; got != want {
+			t.Errorf(`value.UnmarshalText(%q) = %v; want %v`, input, got, want)
+		}
+	}
+}
+
+func TestChoice_UnmarshalText_flagsUnknownValuesIfAllowed(t *testing.T) {
+	value := Enum("draft", "published").AllowUnknown()
+	if err := value.UnmarshalText([]byte("scheduled")); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := value.String(), "scheduled"; got != want {
+		t.Errorf(`value.String() = %v; want %v`, got, want)
+	}
+
+	if got, want := value.IsKnown(), false; got != want {
+		t.Errorf(`value.IsKnown() = %v; want %v`, got, want)
+	}
+
+	if err := value.UnmarshalText([]byte("draft")); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := value.Copy().(*Choice).IsKnown(), true; got != want {
+		t.Errorf(`value.Copy().(*Choice).IsKnown() = %v; want %v`, got, want)
+	}
+}
+
+func TestMatching_UnmarshalText_acceptsMatchingInput(t *testing.T) {
+	value := Pattern(regexp.MustCompile(`^[A-Z]{3}-[0-9]{4}$`), "malformed_product_code")
+	if err := value.UnmarshalText([]byte(" ABC-1234\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := value.String(), "ABC-1234"; got != want {
+		t.Errorf(`value.String() = %v; want %v`, got, want)
+	}
+}
+
+func TestMatching_UnmarshalText_rejectsOtherInput(t *testing.T) {
+	value := Pattern(regexp.MustCompile(`^[A-Z]{3}-[0-9]{4}$`), "malformed_product_code").Copy()
+	err := value.UnmarshalText([]byte("abc-1234"))
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if got, want := err.Error(), "malformed_product_code"; got != want {
+		t.Errorf(`err.Error() = %v; want %v`, got, want)
+	}
+}
+
+func TestMatching_canBeUsedAsCommandField(t *testing.T) {
+	definition := NewCommandDefinition("test").
+		Field("code", Pattern(regexp.MustCompile(`^[A-Z]{3}-[0-9]{4}$`), "malformed_product_code"))
+
+	err := definition.NewCommand().Set("code", "invalid").Validate().(*ValidationError)
+	if got, want := err.Errors["code"], []string{"malformed_product_code"}; !reflect.DeepEqual(got, want) {
+		t.Errorf(`err.Errors["code"] = %v; want %v`, got, want)
+	}
+
+	if err := definition.NewCommand().Set("code", "ABC-1234").Validate(); err != nil {
+		t.Errorf(`Validate() = %v; want %v`, err, nil)
+	}
+}
+
+func TestString_UnmarshalText_countsCharactersNotBytes(t *testing.T) {
+	value := TrimmedString().MinLen(2).MaxLen(3)
+
+	if err := value.UnmarshalText([]byte(" äöü ")); err != nil {
+		t.Fatalf(`UnmarshalText("äöü") = %v; want %v`, err, nil)
+	}
+	if got, want := value.String(), "äöü"; got != want {
+		t.Errorf(`value.String() = %q; want %q`, got, want)
+	}
+
+	if got, want := value.UnmarshalText([]byte("ä")), ErrTooShort; got != want {
+		t.Errorf(`UnmarshalText("ä") = %v; want %v`, got, want)
+	}
+	if got, want := value.UnmarshalText([]byte("äöüß")), ErrTooLong; got != want {
+		t.Errorf(`UnmarshalText("äöüß") = %v; want %v`, got, want)
+	}
+}
+
+func TestString_Copy_keepsLengthLimits(t *testing.T) {
+	value := TrimmedString().MinLen(2).MaxLen(3).Copy()
+
+	if got, want := value.UnmarshalText([]byte("a")), ErrTooShort; got != want {
+		t.Errorf(`UnmarshalText("a") = %v; want %v`, got, want)
+	}
+	if got, want := value.UnmarshalText([]byte("abcd")), ErrTooLong; got != want {
+		t.Errorf(`UnmarshalText("abcd") = %v; want %v`, got, want)
+	}
+}
+
+func TestSanitizedString_UnmarshalText_appliesSanitizersInOrder(t *testing.T) {
+	value := SanitizedString(StripControl, CollapseSpaces, Lowercase)
+
+	if err := value.UnmarshalText([]byte("  Hello\x00,\t  WORLD \n")); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := value.String(), "hello, world"; got != want {
+		t.Errorf(`value.String() = %q; want %q`, got, want)
+	}
+}
+
+func TestSanitizedString_UnmarshalText_respectsOrder(t *testing.T) {
+	value := SanitizedString(CollapseSpaces, StripControl)
+
+	if err := value.UnmarshalText([]byte("a\tb")); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := value.String(), "a b"; got != want {
+		t.Errorf(`value.String() = %q; want %q`, got, want)
+	}
+}
+
+func TestSanitizedString_Copy_keepsSanitizers(t *testing.T) {
+	value := SanitizedString(strings.TrimSpace, Lowercase).Copy()
+
+	if err := value.UnmarshalText([]byte(" ADMIN ")); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := value.String(), "admin"; got != want {
+		t.Errorf(`value.String() = %q; want %q`, got, want)
+	}
+}
+
+type testPoint struct {
+	X, Y int
+}
+
+func (self testPoint) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("%d,%d", self.X, self.Y)), nil
+}
+
+func (self *testPoint) UnmarshalText(data []byte) error {
+	_, err := fmt.Sscanf(string(data), "%d,%d", &self.X, &self.Y)
+	return err
+}
+
+func TestText_canBeUsedAsCommandField(t *testing.T) {
+	definition := NewCommandDefinition("test").
+		Field("position", FromTextCodec(&testPoint{}))
+
+	first := definition.NewCommand().Set("position", "1,2")
+	second := definition.NewCommand().Set("position", "3,4")
+	if err := first.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := first.Get("position").String(), "1,2"; got != want {
+		t.Errorf(`first.Get("position").String() = %q; want %q`, got, want)
+	}
+	if got, want := *second.Get("position").(*Text).Codec().(*testPoint), (testPoint{3, 4}); got != want {
+		t.Errorf(`second position = %v; want %v`, got, want)
+	}
+
+	if definition.NewCommand().Set("position", "invalid").Validate() == nil {
+		t.Errorf("expected an error for malformed input")
+	}
+}
+
+func TestPhoneNumber_UnmarshalText_removesFormatting(t *testing.T) {
+	testcases := map[string]string{
+		"+49 (30) 123-456":        "+4930123456",
+		" 0049 30 / 123.456 ":     "+4930123456",
+		"+1 555 123 4567 ext. 12": "+15551234567;ext=12",
+		"+1-555-123-4567 x9":      "+15551234567;ext=9",
+	}
+
+	for input, expected := range testcases {
+		value := Phone()
+		if err := value.UnmarshalText([]byte(input)); err != nil {
+			t.Errorf("UnmarshalText(%q) = %v; want %v", input, err, nil)
+			continue
+		}
+
+		if got, want := value.String(), expected; got != want {
+			t.Errorf("UnmarshalText(%q): value.String() = %q; want %q", input, got, want)
+		}
+	}
+}
+
+func TestPhoneNumber_UnmarshalText_rejectsInvalidNumbers(t *testing.T) {
+	for _, input := range []string{"", "030 123456", "+49 30 CALL-ME", "+0 123 456 789", "+1 23", "+1234567890123456"} {
+		if got, want := Phone().UnmarshalText([]byte(input)), ErrMalformedPhoneNumber; got != want {
+			t.Errorf("UnmarshalText(%q) = %v; want %v", input, got, want)
+		}
+	}
+}
+
+func TestPhoneNumber_Copy_copiesNumber(t *testing.T) {
+	value := Phone()
+	if err := value.UnmarshalText([]byte("+49 30 123456 #7")); err != nil {
+		t.Fatal(err)
+	}
+
+	copied := value.Copy().(*PhoneNumber)
+	if got, want := copied.Number(), "+4930123456"; got != want {
+		t.Errorf("copied.Number() = %q; want %q", got, want)
+	}
+	if got, want := copied.Extension(), "7"; got != want {
+		t.Errorf("copied.Extension() = %q; want %q", got, want)
+	}
+}
+
+func TestMoney_UnmarshalText_parsesMinorUnits(t *testing.T) {
+	testcases := map[string]struct {
+		amount   int64
+		currency string
+	}{
+		"12.34 USD": {1234, "USD"},
+		"12.3 eur":  {1230, "EUR"},
+		"12":        {1200, "CHF"},
+		"-0.05":     {-5, "CHF"},
+	}
+
+	for input, expected := range testcases {
+		value := MoneyIn("chf")
+		if err := value.UnmarshalText([]byte(input)); err != nil {
+			t.Errorf("UnmarshalText(%q) = %v; want %v", input, err, nil)
+			continue
+		}
+
+		if got, want := value.Amount(), expected.amount; got != want {
+			t.Errorf("UnmarshalText(%q): value.Amount() = %d; want %d", input, got, want)
+		}
+		if got, want := value.Currency(), expected.currency; got != want {
+			t.Errorf("UnmarshalText(%q): value.Currency() = %q; want %q", input, got, want)
+		}
+	}
+}
+
+func TestMoney_UnmarshalText_rejectsMoreThanTwoDecimals(t *testing.T) {
+	if got, want := MoneyIn("USD").UnmarshalText([]byte("12.345")), ErrTooManyDecimals; got != want {
+		t.Errorf(`UnmarshalText("12.345") = %v; want %v`, got, want)
+	}
+}
+
+func TestMoney_UnmarshalText_requiresCurrencyWithoutDefault(t *testing.T) {
+	if got, want := MoneyIn("").UnmarshalText([]byte("12.34")), ErrMissingCurrency; got != want {
+		t.Errorf(`UnmarshalText("12.34") = %v; want %v`, got, want)
+	}
+}
+
+func TestMoney_UnmarshalText_rejectsMalformedAmounts(t *testing.T) {
+	for _, input := range []string{"", "USD", "12.34 US", "1,000.00 USD", "12.34USD"} {
+		if got, want := MoneyIn("USD").UnmarshalText([]byte(input)), ErrMalformedMoney; got != want {
+			t.Errorf("UnmarshalText(%q) = %v; want %v", input, got, want)
+		}
+	}
+}
+
+func TestMoney_String_roundTrips(t *testing.T) {
+	for _, input := range []string{"12.34 USD", "0.05 EUR", "-7.50 CHF"} {
+		value := MoneyIn("")
+		if err := value.UnmarshalText([]byte(input)); err != nil {
+			t.Fatal(err)
+		}
+
+		copied := MoneyIn("")
+		if err := copied.UnmarshalText([]byte(value.Copy().String())); err != nil {
+			t.Fatal(err)
+		}
+
+		if got, want := copied.String(), input; got != want {
+			t.Errorf("copied.String() = %q; want %q", got, want)
+		}
+	}
+}
+
+func TestFlagSet_UnmarshalText_acceptsCombinations(t *testing.T) {
+	testcases := []struct {
+		input  string
+		output string
+		mask   uint64
+	}{
+		{"read", "read", 1},
+		{"write, read", "read,write", 3},
+		{"admin,read", "read,admin", 5},
+		{"admin,write,read,write", "read,write,admin", 7},
+	}
+
+	for _, testcase := range testcases {
+		value := Flags("read", "write", "admin")
+		if err := value.UnmarshalText([]byte(testcase.input)); err != nil {
+			t.Errorf("UnmarshalText(%q): %s", testcase.input, err)
+			continue
+		}
+
+		if got, want := value.Copy().String(), testcase.output; got != want {
+			t.Errorf(`UnmarshalText(%q): value.Copy().String() = %q; want %q`, testcase.input, got, want)
+		}
+		if got, want := value.Uint(), testcase.mask; got != want {
+			t.Errorf(`UnmarshalText(%q): value.Uint() = %d; want %d`, testcase.input, got, want)
+		}
+	}
+}
+
+func TestFlagSet_UnmarshalText_rejectsUnknownFlags(t *testing.T) {
+	value := Flags("read", "write", "admin")
+	for _, input := range []string{"delete", "read,Write", "read;write"} {
+		if got, want := value.UnmarshalText([]byte(input)), ErrNotAllowed; got != want {
+			t.Errorf(`value.UnmarshalText(%q) = %v; want %v`, input, got, want)
+		}
+	}
+}
+
+func TestFlagSet_UnmarshalText_acceptsEmptyInput(t *testing.T) {
+	value := Flags("read", "write", "admin")
+	value.UnmarshalText([]byte("read"))
+	if err := value.UnmarshalText([]byte("")); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := value.Uint(), uint64(0); got != want {
+		t.Errorf(`value.Uint() = %d; want %d`, got, want)
+	}
+	if got, want := value.Strings(), []string{}; !reflect.DeepEqual(got, want) {
+		t.Errorf(`value.Strings() = %q; want %q`, got, want)
+	}
+	if got, want := value.Has("read"), false; got != want {
+		t.Errorf(`value.Has("read") = %v; want %v`, got, want)
+	}
+}
+
+func TestOptionalValue_UnmarshalText_behavesLikeInnerValue(t *testing.T) {
+	value := Optional(TrimmedString().MaxLen(3))
+	if got, want := value.IsSet(), false; got != want {
+		t.Errorf(`value.IsSet() = %v; want %v`, got, want)
+	}
+
+	if err := value.UnmarshalText([]byte(" abc ")); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := value.Copy().String(), "abc"; got != want {
+		t.Errorf(`value.Copy().String() = %q; want %q`, got, want)
+	}
+	if got, want := value.UnmarshalText([]byte("abcd")), ErrTooLong; got != want {
+		t.Errorf(`value.UnmarshalText("abcd") = %v; want %v`, got, want)
+	}
+}
+
+func TestOptionalValue_UnmarshalText_marksEmptyInputAsSet(t *testing.T) {
+	value := Optional(TrimmedString())
+	if err := value.UnmarshalText([]byte("")); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := value.IsSet(), true; got != want {
+		t.Errorf(`value.IsSet() = %v; want %v`, got, want)
+	}
+}
+
+func TestOptionalValue_UnmarshalText_acceptsEmptyInputRejectedByInnerValue(t *testing.T) {
+	value := Optional(EmailAddress())
+	if err := value.UnmarshalText([]byte("admin@example.com")); err != nil {
+		t.Fatal(err)
+	}
+	if err := value.UnmarshalText([]byte("")); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := value.IsSet(), true; got != want {
+		t.Errorf(`value.IsSet() = %v; want %v`, got, want)
+	}
+	if got, want := value.String(), ""; got != want {
+		t.Errorf(`value.String() = %q; want %q`, got, want)
+	}
+}
+
+func TestCompareOrDummy_comparesAgainstDummyHashIfHashIsMissing(t *testing.T) {
+	compared := [][]byte{}
+	defer func(compare func([]byte, []byte) error) { compareHashAndPassword = compare }(compareHashAndPassword)
+	compareHashAndPassword = func(hashed, plain []byte) error {
+		compared = append(compared, hashed)
+		return nil
+	}
+
+	if got, want := CompareOrDummy("", []byte("secret")), false; got != want {
+		t.Errorf(`CompareOrDummy("", "secret") = %v; want %v`, got, want)
+	}
+
+	if got, want := len(compared), 1; got != want {
+		t.Fatalf("len(compared) = %d; want %d", got, want)
+	}
+	if len(compared[0]) == 0 {
+		t.Errorf("compared against an empty hash")
+	}
+}
+
+func TestCompareOrDummy_comparesAgainstGivenHash(t *testing.T) {
+	password := Password()
+	if err := password.UnmarshalText([]byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := CompareOrDummy(password.String(), []byte("secret")), true; got != want {
+		t.Errorf(`CompareOrDummy(hash, "secret") = %v; want %v`, got, want)
+	}
+	if got, want := CompareOrDummy(password.String(), []byte("other")), false; got != want {
+		t.Errorf(`CompareOrDummy(hash, "other") = %v; want %v`, got, want)
+	}
+}
+
+func TestBcryptedPassword_Copy_dropsPlainText(t *testing.T) {
+	password := Password()
+	if err := password.UnmarshalText([]byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+
+	copied := password.Copy().(*BcryptedPassword)
+	if got, want := copied.Matches(password.String()), false; got != want {
+		t.Errorf(`copied.Matches(hash) = %v; want %v`, got, want)
+	}
+}
+
+func TestCountry_UnmarshalText_normalizesCase(t *testing.T) {
+	for input, want := range map[string]string{
+		"DE":   "DE",
+		"us":   "US",
+		" Gb ": "GB",
+	} {
+		value := CountryCode()
+		if err := value.UnmarshalText([]byte(input)); err != nil {
+			t.Errorf(`value.UnmarshalText(%q) = %v; want %v`, input, err, nil)
+			continue
+		}
+
+		if got := value.String(); got != want {
+			t.Errorf(`value.String() = %v; want %v [input=%q]`, got, want, input)
+		}
+	}
+}
+
+func TestCountry_UnmarshalText_rejectsUnknownCodes(t *testing.T) {
+	value := CountryCode()
+	for _, input := range []string{"", "XX", "UK", "DEU", "D"} {
+		if got, want := value.UnmarshalText([]byte(input)), ErrUnknownCountry; got != want {
+			t.Errorf(`value.UnmarshalText(%q) = %v; want %v`, input, got, want)
+		}
+	}
+}
+
+func TestLocale_UnmarshalText_normalizesCase(t *testing.T) {
+	for input, want := range map[string]string{
+		"en":             "en",
+		"EN-us":          "en-US",
+		"pt_br":          "pt-BR",
+		"zh-hant-tw":     "zh-Hant-TW",
+		"es-419":         "es-419",
+		"de-CH-1996":     "de-CH-1996",
+		"sl-Rozaj-Biske": "sl-rozaj-biske",
+	} {
+		value := LocaleCode()
+		if err := value.UnmarshalText([]byte(input)); err != nil {
+			t.Errorf(`value.UnmarshalText(%q) = %v; want %v`, input, err, nil)
+			continue
+		}
+
+		if got := value.String(); got != want {
+			t.Errorf(`value.String() = %v; want %v [input=%q]`, got, want, input)
+		}
+	}
+}
+
+func TestLocale_UnmarshalText_rejectsMalformedTags(t *testing.T) {
+	value := LocaleCode()
+	for _, input := range []string{"", "e", "english", "en-", "en-USA", "en US", "12-US"} {
+		if got, want := value.UnmarshalText([]byte(input)), ErrMalformedLocale; got != want {
+			t.Errorf(`value.UnmarshalText(%q) = %v; want %v`, input, got, want)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package ess
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// WebhookBufferSize is the number of events buffered by a
+	// WebhookProjection before events are dropped.
+	WebhookBufferSize = 64
+
+	// WebhookRetries is the default number of times delivering
+	// an event is retried.
+	WebhookRetries = 3
+
+	// WebhookBackoff is the default time to wait before retrying
+	// to deliver an event for the first time.  The time doubles
+	// with every retry.
+	WebhookBackoff = 100 * time.Millisecond
+)
+
+// WebhookProjection forwards events to an external service by
+// POSTing them as JSON to a URL.
+//
+// Events are delivered on a separate goroutine, so that handling an
+// event never blocks sending commands.  Up to WebhookBufferSize
+// events are buffered; events arriving while the buffer is full are
+// dropped.  Failed deliveries are retried with exponential backoff
+// and logged once all attempts have failed.
+//
+// The projection implements LiveProjection, so that Application.Init
+// does not deliver the application's history again on every start.
+type WebhookProjection struct {
+	url     string
+	client  *http.Client
+	names   map[string]bool
+	logger  *log.Logger
+	retries int
+	backoff time.Duration
+
+	queue  chan *Event
+	done   sync.WaitGroup
+	mutex  sync.Mutex
+	closed bool
+}
+
+// NewWebhookProjection returns a new projection POSTing events to url
+// using client.  If client is nil, http.DefaultClient is used.
+//
+// Only events with one of the given names are delivered.  If no names
+// are given, all events are delivered.
+func NewWebhookProjection(url string, client *http.Client, names ...string) *WebhookProjection {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	projection := &WebhookProjection{
+		url:     url,
+		client:  client,
+		names:   map[string]bool{},
+		logger:  log.New(os.Stderr, "webhook ", log.LstdFlags),
+		retries: WebhookRetries,
+		backoff: WebhookBackoff,
+		queue:   make(chan *Event, WebhookBufferSize),
+	}
+	for _, name := range names {
+		projection.names[name] = true
+	}
+
+	projection.done.Add(1)
+	go projection.run()
+
+	return projection
+}
+
+// WithLogger sets the logger used for reporting failed deliveries to
+// logger.
+func (self *WebhookProjection) WithLogger(logger *log.Logger) *WebhookProjection {
+	self.logger = logger
+	return self
+}
+
+// WithRetries configures the projection to retry delivering an event
+// up to retries times, waiting for backoff before the first retry.
+func (self *WebhookProjection) WithRetries(retries int, backoff time.Duration) *WebhookProjection {
+	self.retries = retries
+	self.backoff = backoff
+	return self
+}
+
+// SkipsReplay implements LiveProjection.  Only events happening
+// after the projection has been registered are delivered.
+func (self *WebhookProjection) SkipsReplay() bool { return true }
+
+// HandleEvent queues event for delivery if its name matches.  Events
+// handled after the projection has been closed are dropped.
+func (self *WebhookProjection) HandleEvent(event *Event) {
+	if len(self.names) > 0 && !self.names[event.Name] {
+		return
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if self.closed {
+		self.logger.Printf("DROP %s %s: projection closed", event.Name, event.Id)
+		return
+	}
+
+	select {
+	case self.queue <- event:
+	default:
+		self.logger.Printf("DROP %s %s: queue full", event.Name, event.Id)
+	}
+}
+
+// Close stops accepting events and waits until all queued events
+// have been delivered.  Calling Close more than once has no effect.
+func (self *WebhookProjection) Close() error {
+	self.mutex.Lock()
+	if !self.closed {
+		self.closed = true
+		close(self.queue)
+	}
+	self.mutex.Unlock()
+
+	self.done.Wait()
+	return nil
+}
+
+// run delivers queued events until the queue is closed.
+func (self *WebhookProjection) run() {
+	defer self.done.Done()
+
+	for event := range self.queue {
+		if err := self.deliver(event); err != nil {
+			self.logger.Printf("FAIL %s %s: %s", event.Name, event.Id, err)
+		}
+	}
+}
+
+// deliver POSTs event to the projection's URL, retrying on failure.
+func (self *WebhookProjection) deliver(event *Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	backoff := self.backoff
+	for attempt := 0; ; attempt++ {
+		err = self.post(data)
+		if err == nil || attempt >= self.retries {
+			return err
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// post sends data to the projection's URL once.
+func (self *WebhookProjection) post(data []byte) error {
+	response, err := self.client.Post(self.url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", response.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package ess
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// webhookReceiver records the names of events POSTed to it.
+type webhookReceiver struct {
+	mutex    sync.Mutex
+	failures int
+	names    []string
+}
+
+func (self *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if self.failures > 0 {
+		self.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	event := &Event{}
+	if err := json.NewDecoder(req.Body).Decode(event); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	self.names = append(self.names, event.Name)
+}
+
+func TestWebhookProjection_HandleEvent_deliversMatchingEvents(t *testing.T) {
+	receiver := &webhookReceiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	projection := NewWebhookProjection(server.URL, server.Client(), "user.signed-up", "user.deleted")
+	projection.HandleEvent(NewEvent("user.signed-up"))
+	projection.HandleEvent(NewEvent("user.logged-in"))
+	projection.HandleEvent(NewEvent("user.deleted"))
+	projection.Close()
+
+	if got, want := receiver.names, []string{"user.signed-up", "user.deleted"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("receiver.names = %v; want %v", got, want)
+	}
+}
+
+func TestWebhookProjection_HandleEvent_retriesFailedDeliveries(t *testing.T) {
+	receiver := &webhookReceiver{failures: 2}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	projection := NewWebhookProjection(server.URL, server.Client()).WithRetries(2, 0)
+	projection.HandleEvent(NewEvent("user.signed-up"))
+	projection.Close()
+
+	if got, want := receiver.names, []string{"user.signed-up"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("receiver.names = %v; want %v", got, want)
+	}
+}
+
+func TestWebhookProjection_HandleEvent_logsFailures(t *testing.T) {
+	receiver := &webhookReceiver{failures: 2}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	lines := []string{}
+	projection := NewWebhookProjection(server.URL, server.Client()).
+		WithRetries(1, 0).
+		WithLogger(log.New(NewLineWriter(&lines), "", 0))
+	projection.HandleEvent(NewEvent("user.signed-up"))
+	projection.Close()
+
+	if got, want := len(receiver.names), 0; got != want {
+		t.Errorf("len(receiver.names) = %d; want %d", got, want)
+	}
+
+	if got, want := len(lines), 1; got != want {
+		t.Fatalf("len(lines) = %d; want %d", got, want)
+	}
+}
+
+func TestWebhookProjection_HandleEvent_dropsEventsAfterClose(t *testing.T) {
+	receiver := &webhookReceiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	lines := []string{}
+	projection := NewWebhookProjection(server.URL, server.Client()).
+		WithLogger(log.New(NewLineWriter(&lines), "", 0))
+	projection.Close()
+	projection.HandleEvent(NewEvent("user.signed-up"))
+
+	if got, want := len(lines), 1; got != want {
+		t.Errorf("len(lines) = %d; want %d", got, want)
+	}
+}
+
+func TestWebhookProjection_isNotPassedHistoryByInit(t *testing.T) {
+	receiver := &webhookReceiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	store := NewEventsInMemory()
+	store.Store([]*Event{NewEvent("user.signed-up")})
+	projection := NewWebhookProjection(server.URL, server.Client())
+	app := NewTestApp().WithStore(store).WithProjection("webhook", projection)
+	if err := app.Init(); err != nil {
+		t.Fatal(err)
+	}
+	app.Project(NewEvent("user.deleted"))
+	projection.Close()
+
+	if got, want := receiver.names, []string{"user.deleted"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("receiver.names = %v; want %v", got, want)
+	}
+}